@@ -1,16 +1,26 @@
 package main
 
 import (
+	"context"
+	"log"
+	"matching-service/api-server/docs"
+	"matching-service/api-server/internal/auth"
+	"matching-service/api-server/internal/friendsync"
 	"matching-service/api-server/internal/handlers"
+	"matching-service/api-server/internal/mail"
 	"matching-service/api-server/internal/middleware"
+	"matching-service/api-server/internal/models"
 	"matching-service/api-server/internal/repository"
 	"matching-service/api-server/internal/services"
 	"matching-service/api-server/pkg/database"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
-	"github.com/swaggo/swag/example/basic/docs"
 )
 
 // @title          Matching Service API
@@ -37,26 +47,106 @@ func main() {
 
 	db := database.GetDB()
 
+	keys, err := auth.LoadKeySet()
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+	log.Printf("Signing tokens with key %s", keys.ActiveKeyID())
+
+	// Revoked access tokens are shared with the websocket-server through
+	// Redis; without it revocations only hold within this process
+	var client *redis.Client
+	var denyList auth.DenyList
+	var userAttempts, clientAttempts auth.AttemptLimiter
+	if redisHost := os.Getenv("REDIS_HOST"); redisHost != "" {
+		client = redis.NewClient(&redis.Options{Addr: redisHost + ":" + os.Getenv("REDIS_PORT")})
+		denyList = auth.NewRedisDenyList(client)
+		userAttempts = auth.NewRedisAttemptLimiter(client, "login_attempts:user:", services.UsernameAttemptPolicy)
+		clientAttempts = auth.NewRedisAttemptLimiter(client, "login_attempts:ip:", services.ClientAttemptPolicy)
+	} else {
+		log.Println("REDIS_HOST is not set, revoked tokens and failed logins are only known to this process")
+		denyList = auth.NewMemoryDenyList()
+		userAttempts = auth.NewMemoryAttemptLimiter(services.UsernameAttemptPolicy)
+		clientAttempts = auth.NewMemoryAttemptLimiter(services.ClientAttemptPolicy)
+	}
+
 	userRepo := repository.NewUserRepo(db)
-	userService := services.NewUserService(userRepo)
-	userHandler := handlers.NewUserHandler(userService)
+	refreshTokenRepo := repository.NewRefreshTokenRepo(db)
+	tokenService := services.NewTokenService(userRepo, refreshTokenRepo, keys, denyList)
+	// Account emails are sent in the background, off the request path
+	mailQueue := mail.NewQueue(mail.LoadMailer(), 100, mail.SendTimeout)
+	go mailQueue.Run(context.Background())
+	accountService := services.NewAccountService(userRepo, repository.NewActionTokenRepo(db), refreshTokenRepo, keys, denyList, mailQueue, services.LoadBaseURL())
+	requireVerifiedEmail := os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true"
+	loginThrottle := services.NewLoginThrottle(userAttempts, clientAttempts, repository.NewAuditRepo(db))
+	userService := services.NewUserService(userRepo, tokenService, accountService, loginThrottle, requireVerifiedEmail)
+	userHandler := handlers.NewUserHandler(userService, tokenService, keys, denyList)
+	accountHandler := handlers.NewAccountHandler(accountService, userService)
+	friendService := services.NewFriendService(userRepo, repository.NewFriendRequestRepo(db))
+	friendHandler := handlers.NewFriendHandler(friendService)
+
+	// Keep the friend sets the websocket-server reads from Redis in sync
+	// with user_friends
+	if client != nil {
+		ctx := context.Background()
+		store := friendsync.NewRedisFriendStore(client)
+		go friendsync.NewRelay(repository.NewOutboxRepo(db), store, 100).Run(ctx, time.Second)
+		go friendsync.NewReconciler(userRepo, store).Run(ctx, friendsync.LoadReconcileInterval())
+	} else {
+		log.Println("REDIS_HOST is not set, friendships are not synced to Redis")
+	}
 
 	r := gin.Default()
+	// Failed logins are counted per client address, which X-Forwarded-For
+	// may only set when sent by one of TRUSTED_PROXIES
+	var trustedProxies []string
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		trustedProxies = strings.Split(proxies, ",")
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// Swagger documentation route
 	docs.SwaggerInfo.BasePath = "/api/v1"
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// nginx auth_request target for the websocket gateway
+	r.GET("/verify", userHandler.Verify)
+	// Public keys the websocket-server verifies tokens with
+	r.GET("/.well-known/jwks.json", handlers.NewJWKSHandler(keys).JWKS)
+
 	v1 := r.Group("/api/v1")
 
 	{
 		v1.POST("/register", userHandler.Register)
 		v1.POST("/login", userHandler.Login)
+		v1.POST("/refresh", userHandler.Refresh)
+		v1.POST("/email/verify", accountHandler.VerifyEmail)
+		v1.POST("/password/forgot", accountHandler.ForgotPassword)
+		v1.POST("/password/reset", accountHandler.ResetPassword)
 
 		authorized := v1.Group("/")
-		authorized.Use(middleware.AuthMiddleware())
+		authorized.Use(middleware.AuthMiddleware(keys, denyList))
 		{
-			authorized.GET("/profile", userHandler.GetProfile)
+			authorized.GET("/profile", middleware.RequireScope(auth.ScopeProfile), userHandler.GetProfile)
+			authorized.POST("/logout", userHandler.Logout)
+			authorized.POST("/email/verification", accountHandler.SendVerification)
+
+			friends := authorized.Group("/")
+			friends.Use(middleware.RequireScope(auth.ScopeFriends))
+			friends.GET("/friends", friendHandler.ListFriends)
+			friends.DELETE("/friends/:id", friendHandler.RemoveFriend)
+			friends.GET("/friends/requests", friendHandler.ListFriendRequests)
+			friends.POST("/friends/requests", friendHandler.SendFriendRequest)
+			friends.POST("/friends/requests/:id/accept", friendHandler.AcceptFriendRequest)
+			friends.POST("/friends/requests/:id/decline", friendHandler.DeclineFriendRequest)
+			friends.DELETE("/friends/requests/:id", friendHandler.CancelFriendRequest)
+			friends.GET("/users/search", friendHandler.SearchUsers)
+
+			admin := authorized.Group("/admin")
+			admin.Use(middleware.RequireRole(models.RoleAdmin))
+			admin.PUT("/users/:id/roles", userHandler.SetRoles)
 		}
 	}
 
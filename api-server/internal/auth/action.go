@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+// Purposes of action tokens. A purpose is the token's audience, so an
+// action token is never accepted as an access token or for another action.
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposePasswordReset     = "password_reset"
+)
+
+// GenerateActionToken issues a token letting the user perform one action,
+// e.g. from a link in an email, until ttl has passed. Its jti must be
+// recorded to make it single-use.
+func (s *KeySet) GenerateActionToken(userID, purpose string, ttl time.Duration) (string, *jwt.RegisteredClaims, error) {
+	now := time.Now()
+	claims := &jwt.RegisteredClaims{
+		ID:        uuid.New().String(),
+		Issuer:    s.Issuer,
+		Audience:  jwt.ClaimStrings{purpose},
+		Subject:   userID,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+	token, err := s.sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
+
+func (s *KeySet) ValidateActionToken(tokenString, purpose string) (*jwt.RegisteredClaims, error) {
+	claims := &jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.keyfunc)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if !claims.VerifyIssuer(s.Issuer, true) || !claims.VerifyAudience(purpose, true) {
+		return nil, errors.New("token is not meant for this action")
+	}
+	if claims.ID == "" || claims.Subject == "" || claims.ExpiresAt == nil {
+		return nil, errors.New("token has no jti, subject or expiry")
+	}
+	return claims, nil
+}
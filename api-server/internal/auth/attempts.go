@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// AttemptPolicy is how failed attempts are slowed down. The first
+// FreeAttempts failures cost nothing, each later one locks the key for
+// twice as long as the previous, from BaseDelay up to MaxDelay. Failures
+// are forgotten Window after the last one.
+type AttemptPolicy struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Window       time.Duration
+}
+
+// Delay is how long the key is locked after its nth failure.
+func (p AttemptPolicy) Delay(failures int) time.Duration {
+	over := failures - p.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < over && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// AttemptResult is the state of a key after a failed attempt.
+type AttemptResult struct {
+	Failures int
+	Delay    time.Duration
+	// LockStarted is set by the failure that first locks the key
+	LockStarted bool
+	// MaxLocked is set while the delay is the policy's MaxDelay
+	MaxLocked bool
+}
+
+// AttemptLimiter counts the failed attempts of a key, e.g. a username or a
+// client address, and tells how long it must wait before the next one.
+type AttemptLimiter interface {
+	// Wait returns how long the key is still locked, zero when it may try.
+	Wait(ctx context.Context, key string) (time.Duration, error)
+	Fail(ctx context.Context, key string) (AttemptResult, error)
+	Reset(ctx context.Context, key string) error
+}
+
+func (p AttemptPolicy) result(failures int) AttemptResult {
+	delay := p.Delay(failures)
+	return AttemptResult{
+		Failures:    failures,
+		Delay:       delay,
+		LockStarted: delay > 0 && p.Delay(failures-1) == 0,
+		MaxLocked:   delay > 0 && delay >= p.MaxDelay,
+	}
+}
+
+// ttl keeps the counter at least as long as the lock it holds.
+func (p AttemptPolicy) ttl(delay time.Duration) time.Duration {
+	return max(p.Window, delay)
+}
+
+type redisAttemptLimiter struct {
+	client *redis.Client
+	prefix string
+	policy AttemptPolicy
+}
+
+// NewRedisAttemptLimiter keeps the counters in Redis hashes under prefix, so
+// that every instance of the api-server shares them.
+func NewRedisAttemptLimiter(client *redis.Client, prefix string, policy AttemptPolicy) AttemptLimiter {
+	return &redisAttemptLimiter{client: client, prefix: prefix, policy: policy}
+}
+
+func (l *redisAttemptLimiter) Wait(ctx context.Context, key string) (time.Duration, error) {
+	until, err := l.client.HGet(ctx, l.prefix+key, "locked_until").Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading attempts of %s: %w", key, err)
+	}
+	return max(time.Until(time.UnixMilli(until)), 0), nil
+}
+
+func (l *redisAttemptLimiter) Fail(ctx context.Context, key string) (AttemptResult, error) {
+	failures, err := l.client.HIncrBy(ctx, l.prefix+key, "failures", 1).Result()
+	if err != nil {
+		return AttemptResult{}, fmt.Errorf("error counting attempt of %s: %w", key, err)
+	}
+	result := l.policy.result(int(failures))
+
+	pipe := l.client.TxPipeline()
+	if result.Delay > 0 {
+		until := time.Now().Add(result.Delay).UnixMilli()
+		pipe.HSet(ctx, l.prefix+key, "locked_until", strconv.FormatInt(until, 10))
+	}
+	pipe.PExpire(ctx, l.prefix+key, l.policy.ttl(result.Delay))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return AttemptResult{}, fmt.Errorf("error locking %s: %w", key, err)
+	}
+	return result, nil
+}
+
+func (l *redisAttemptLimiter) Reset(ctx context.Context, key string) error {
+	if err := l.client.Del(ctx, l.prefix+key).Err(); err != nil {
+		return fmt.Errorf("error resetting attempts of %s: %w", key, err)
+	}
+	return nil
+}
+
+type attempts struct {
+	failures    int
+	lockedUntil time.Time
+	expiresAt   time.Time
+}
+
+// memoryAttemptLimiter only covers this process; use it without Redis.
+type memoryAttemptLimiter struct {
+	mu       sync.Mutex
+	policy   AttemptPolicy
+	attempts map[string]*attempts
+}
+
+func NewMemoryAttemptLimiter(policy AttemptPolicy) AttemptLimiter {
+	return &memoryAttemptLimiter{policy: policy, attempts: map[string]*attempts{}}
+}
+
+func (l *memoryAttemptLimiter) Wait(ctx context.Context, key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	a, ok := l.attempts[key]
+	if !ok {
+		return 0, nil
+	}
+	return max(time.Until(a.lockedUntil), 0), nil
+}
+
+func (l *memoryAttemptLimiter) Fail(ctx context.Context, key string) (AttemptResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for k, a := range l.attempts {
+		if !a.expiresAt.After(now) {
+			delete(l.attempts, k)
+		}
+	}
+
+	a, ok := l.attempts[key]
+	if !ok {
+		a = &attempts{}
+		l.attempts[key] = a
+	}
+	a.failures++
+	result := l.policy.result(a.failures)
+	if result.Delay > 0 {
+		a.lockedUntil = now.Add(result.Delay)
+	}
+	a.expiresAt = now.Add(l.policy.ttl(result.Delay))
+	return result, nil
+}
+
+func (l *memoryAttemptLimiter) Reset(ctx context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, key)
+	return nil
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DenyList holds the IDs (jti) of access tokens revoked before they
+// expire. An entry only needs to outlive the token it revokes.
+type DenyList interface {
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// revokedPrefix is shared with websocket-server/pkg/redis/keys.go, so that
+// WebSocket upgrades honour the revocations too.
+const revokedPrefix = "revoked_jti:"
+
+type redisDenyList struct {
+	client *redis.Client
+}
+
+func NewRedisDenyList(client *redis.Client) DenyList {
+	return &redisDenyList{client: client}
+}
+
+func (d *redisDenyList) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	if err := d.client.Set(ctx, revokedPrefix+jti, 1, ttl).Err(); err != nil {
+		return fmt.Errorf("error revoking token %s: %w", jti, err)
+	}
+	return nil
+}
+
+func (d *redisDenyList) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := d.client.Exists(ctx, revokedPrefix+jti).Result()
+	if err != nil {
+		return false, fmt.Errorf("error checking revocation of token %s: %w", jti, err)
+	}
+	return n > 0, nil
+}
+
+// memoryDenyList only covers this process; use it without Redis.
+type memoryDenyList struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+func NewMemoryDenyList() DenyList {
+	return &memoryDenyList{revoked: map[string]time.Time{}}
+}
+
+func (d *memoryDenyList) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	for id, until := range d.revoked {
+		if !until.After(now) {
+			delete(d.revoked, id)
+		}
+	}
+	if expiresAt.After(now) {
+		d.revoked[jti] = expiresAt
+	}
+	return nil
+}
+
+func (d *memoryDenyList) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	until, ok := d.revoked[jti]
+	return ok && until.After(time.Now()), nil
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"sort"
+)
+
+// JWK is the public part of a signing key (RFC 7517), for RSA and Ed25519
+// keys.
+type JWK struct {
+	Kty string `json:"kty" example:"OKP"`
+	Use string `json:"use" example:"sig"`
+	Alg string `json:"alg" example:"EdDSA"`
+	Kid string `json:"kid" example:"2024-06"`
+	// RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 curve and public key
+	Crv string `json:"crv,omitempty" example:"Ed25519"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes the public keys of the set, so that other services can
+// verify tokens without holding a secret. HS256 keys are secret and left
+// out.
+func (s *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range s.keys {
+		jwk := JWK{Use: "sig", Alg: key.Method.Alg(), Kid: key.ID}
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].Kid < jwks.Keys[j].Kid })
+	return jwks
+}
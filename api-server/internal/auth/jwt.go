@@ -1,38 +1,90 @@
 package auth
 
 import (
+	"context"
 	"errors"
+	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 )
 
-var jwtKey = []byte("your_secret_key") // Replace with a secure secret key
+// AccessTokenTTL is kept short; clients get new access tokens with their
+// refresh token.
+const AccessTokenTTL = 15 * time.Minute
+
+var ErrRevokedToken = errors.New("token has been revoked")
+
+// Scopes granted in access tokens.
+const (
+	ScopeProfile = "profile"
+	ScopeFriends = "friends"
+	ScopeAdmin   = "admin"
+)
 
 type Claims struct {
-	Username string `json:"username"`
-	jwt.StandardClaims
+	Username string   `json:"username"`
+	Roles    []string `json:"roles,omitempty"`
+	// Scope is a space separated list, as in RFC 8693
+	Scope string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range strings.Fields(c.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateToken issues an access token for the user, signed with the active
+// key. The user ID is carried in the standard "sub" claim so other services
+// get a stable identity without a lookup by username, and a unique "jti"
+// lets the token be revoked before it expires.
+func (s *KeySet) GenerateToken(userID, username string, roles, scopes []string) (string, error) {
+	token, _, err := s.NewAccessToken(userID, username, roles, scopes)
+	return token, err
 }
 
-func GenerateToken(username string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// NewAccessToken is GenerateToken that also returns the claims signed, e.g.
+// to revoke the token by its jti later.
+func (s *KeySet) NewAccessToken(userID, username string, roles, scopes []string) (string, *Claims, error) {
+	now := time.Now()
 	claims := &Claims{
 		Username: username,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
+		Roles:    roles,
+		Scope:    strings.Join(scopes, " "),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    s.Issuer,
+			Audience:  jwt.ClaimStrings{s.Audience},
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
 		},
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	token, err := s.sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
 }
 
-func ValidateToken(tokenString string) (*Claims, error) {
+func (s *KeySet) ValidateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.keyfunc)
 	if err != nil {
 		return nil, err
 	}
@@ -40,6 +92,33 @@ func ValidateToken(tokenString string) (*Claims, error) {
 	if !token.Valid {
 		return nil, errors.New("invalid token")
 	}
+	if !claims.VerifyIssuer(s.Issuer, true) {
+		return nil, errors.New("token has the wrong issuer")
+	}
+	if !claims.VerifyAudience(s.Audience, true) {
+		return nil, errors.New("token is not meant for this audience")
+	}
 
 	return claims, nil
 }
+
+// ValidateAccessToken validates the token and rejects it once its jti is on
+// the deny-list. Tokens without a jti or expiry cannot be revoked and are
+// rejected.
+func (s *KeySet) ValidateAccessToken(ctx context.Context, denyList DenyList, tokenString string) (*Claims, error) {
+	claims, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, errors.New("token has no jti or expiry")
+	}
+	revoked, err := denyList.IsRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrRevokedToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Defaults of the "iss" and "aud" claims, overridden by JWT_ISSUER and
+// JWT_AUDIENCE. Every service validating tokens must expect the same
+// values.
+const (
+	DefaultIssuer   = "matching-service/api-server"
+	DefaultAudience = "matching-service"
+)
+
+// minSecretLength is the shortest HS256 secret accepted, the size of the
+// hash.
+const minSecretLength = 32
+
+// SigningKey is one key of a KeySet. Private is nil for a retired key that
+// is only kept to verify the tokens it signed.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private interface{} // []byte, *rsa.PrivateKey or ed25519.PrivateKey
+	Public  interface{} // []byte, *rsa.PublicKey or ed25519.PublicKey
+}
+
+// KeySet signs new tokens with its active key and verifies tokens with any
+// of its keys, chosen by the "kid" header. Rotating a key means adding the
+// new one, making it active and dropping the old one once the tokens it
+// signed have expired.
+type KeySet struct {
+	// Issuer and Audience are put in the tokens signed and required in the
+	// tokens validated.
+	Issuer   string
+	Audience string
+
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+func NewKeySet(activeID string, keys ...*SigningKey) (*KeySet, error) {
+	set := &KeySet{Issuer: DefaultIssuer, Audience: DefaultAudience, keys: map[string]*SigningKey{}}
+	for _, key := range keys {
+		if _, ok := set.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key %s", key.ID)
+		}
+		set.keys[key.ID] = key
+	}
+	active, ok := set.keys[activeID]
+	if !ok {
+		return nil, fmt.Errorf("active key %s is not in the key set", activeID)
+	}
+	if active.Private == nil {
+		return nil, fmt.Errorf("active key %s has no private key", activeID)
+	}
+	set.active = active
+	return set, nil
+}
+
+// ActiveKeyID is the kid of the key new tokens are signed with.
+func (s *KeySet) ActiveKeyID() string {
+	return s.active.ID
+}
+
+func (s *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.active.Method, claims)
+	token.Header["kid"] = s.active.ID
+	return token.SignedString(s.active.Private)
+}
+
+// keyfunc returns the key named by the token's kid. The token must use the
+// key's algorithm, so that e.g. a public RSA key cannot be passed off as an
+// HMAC secret.
+func (s *KeySet) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+	}
+	return key.Public, nil
+}
+
+// LoadKeySet reads the keys from JWT_KEYS, a comma separated list of
+// kid=path entries, and signs with the one named by JWT_ACTIVE_KID. Without
+// JWT_KEYS, JWT_SECRET is used as the single HS256 key "default".
+func LoadKeySet() (*KeySet, error) {
+	set, err := loadKeys()
+	if err != nil {
+		return nil, err
+	}
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		set.Issuer = issuer
+	}
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		set.Audience = audience
+	}
+	return set, nil
+}
+
+func loadKeys() (*KeySet, error) {
+	entries := os.Getenv("JWT_KEYS")
+	if entries == "" {
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			return nil, errors.New("neither JWT_KEYS nor JWT_SECRET is set")
+		}
+		key, err := ParseKey("default", []byte(secret))
+		if err != nil {
+			return nil, err
+		}
+		return NewKeySet(key.ID, key)
+	}
+
+	var keys []*SigningKey
+	for _, entry := range strings.Split(entries, ",") {
+		id, path, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || id == "" || path == "" {
+			return nil, fmt.Errorf("invalid JWT_KEYS entry %q, expected kid=path", entry)
+		}
+		key, err := LoadKey(id, path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	activeID := os.Getenv("JWT_ACTIVE_KID")
+	if activeID == "" && len(keys) == 1 {
+		activeID = keys[0].ID
+	}
+	return NewKeySet(activeID, keys...)
+}
+
+func LoadKey(id, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key %s: %w", id, err)
+	}
+	return ParseKey(id, data)
+}
+
+// ParseKey reads a PEM private key (RSA for RS256, Ed25519 for EdDSA), a PEM
+// public key of a retired key, or else an HS256 secret.
+func ParseKey(id string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		secret := bytes.TrimSpace(data)
+		if len(secret) < minSecretLength {
+			return nil, fmt.Errorf("key %s: HS256 secrets need at least %d bytes", id, minSecretLength)
+		}
+		return &SigningKey{ID: id, Method: jwt.SigningMethodHS256, Private: secret, Public: secret}, nil
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %s: unsupported PEM block %s", id, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, Private: key, Public: &key.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, Public: key}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, Private: key, Public: key.Public()}, nil
+	case ed25519.PublicKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, Public: key}, nil
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %T", id, parsed)
+	}
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+// RefreshTokenTTL bounds a token family: refreshing rotates the token but
+// does not extend the login beyond it.
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// NewRefreshToken returns a random opaque refresh token and the hash it is
+// stored under. The token itself is never stored.
+func NewRefreshToken() (token string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashRefreshToken(token), nil
+}
+
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
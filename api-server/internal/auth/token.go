@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TokenFromRequest extracts a bearer token from the Authorization header,
+// from Sec-WebSocket-Protocol ("bearer, <token>"), or from the "token"
+// query parameter. Requests proxied through nginx auth_request carry the
+// original query string in X-Original-URI.
+func TokenFromRequest(r *http.Request) string {
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		bearerToken := strings.Split(authHeader, " ")
+		if len(bearerToken) == 2 && bearerToken[0] == "Bearer" {
+			return bearerToken[1]
+		}
+	}
+
+	var protocols []string
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			protocols = append(protocols, strings.TrimSpace(protocol))
+		}
+	}
+	for i, protocol := range protocols {
+		if protocol == "bearer" && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+
+	if originalURI := r.Header.Get("X-Original-URI"); originalURI != "" {
+		if u, err := url.Parse(originalURI); err == nil {
+			if token := u.Query().Get("token"); token != "" {
+				return token
+			}
+		}
+	}
+
+	return r.URL.Query().Get("token")
+}
@@ -0,0 +1,119 @@
+package friendsync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"matching-service/api-server/internal/repository"
+	"os"
+	"time"
+)
+
+// Report counts what a reconciliation found and fixed.
+type Report struct {
+	Users   int `json:"users"`
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+// Reconciler makes the store match user_friends, which is the source of
+// truth. A change committed while it runs may be undone by it and is
+// restored by the relay or the next run.
+type Reconciler struct {
+	users repository.UserRepository
+	store FriendStore
+}
+
+func NewReconciler(users repository.UserRepository, store FriendStore) *Reconciler {
+	return &Reconciler{users: users, store: store}
+}
+
+// Run reconciles now and then every interval until ctx is done.
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := r.Reconcile(ctx)
+		if err != nil {
+			log.Printf("Friendship reconciliation: %v", err)
+		} else if report.Added > 0 || report.Removed > 0 {
+			log.Printf("Friendship reconciliation fixed drift: %+v", report)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *Reconciler) Reconcile(ctx context.Context) (Report, error) {
+	var report Report
+	records, err := r.users.GetFriendshipRecords()
+	if err != nil {
+		return report, err
+	}
+	expected := map[string]map[string]bool{}
+	for _, record := range records {
+		if expected[record.UserID] == nil {
+			expected[record.UserID] = map[string]bool{}
+		}
+		expected[record.UserID][record.FriendID] = true
+	}
+
+	// Users only Redis knows about lost all their friends
+	stored, err := r.store.Users(ctx)
+	if err != nil {
+		return report, err
+	}
+	for _, userID := range stored {
+		if expected[userID] == nil {
+			expected[userID] = map[string]bool{}
+		}
+	}
+
+	for userID, friends := range expected {
+		actual, err := r.store.Friends(ctx, userID)
+		if err != nil {
+			return report, err
+		}
+		report.Users++
+
+		have := make(map[string]bool, len(actual))
+		for _, friendID := range actual {
+			have[friendID] = true
+			if !friends[friendID] {
+				if err := r.store.RemoveFriend(ctx, userID, friendID); err != nil {
+					return report, fmt.Errorf("error reconciling user %s: %w", userID, err)
+				}
+				report.Removed++
+			}
+		}
+		for friendID := range friends {
+			if !have[friendID] {
+				if err := r.store.AddFriend(ctx, userID, friendID); err != nil {
+					return report, fmt.Errorf("error reconciling user %s: %w", userID, err)
+				}
+				report.Added++
+			}
+		}
+	}
+	return report, nil
+}
+
+const DefaultReconcileInterval = time.Hour
+
+// LoadReconcileInterval reads FRIEND_RECONCILE_INTERVAL, e.g. "30m", and
+// falls back to DefaultReconcileInterval.
+func LoadReconcileInterval() time.Duration {
+	value := os.Getenv("FRIEND_RECONCILE_INTERVAL")
+	if value == "" {
+		return DefaultReconcileInterval
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		log.Printf("Ignoring invalid FRIEND_RECONCILE_INTERVAL %q, using %s", value, DefaultReconcileInterval)
+		return DefaultReconcileInterval
+	}
+	return interval
+}
@@ -0,0 +1,91 @@
+package friendsync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"matching-service/api-server/internal/models"
+	"matching-service/api-server/internal/repository"
+	"time"
+)
+
+// Relay applies pending outbox events to the store in the order they were
+// recorded. Delivery is at least once: an event applied just before a crash
+// is applied again, which adding to or removing from a set tolerates.
+type Relay struct {
+	outbox    repository.OutboxRepository
+	store     FriendStore
+	batchSize int
+}
+
+func NewRelay(outbox repository.OutboxRepository, store FriendStore, batchSize int) *Relay {
+	return &Relay{outbox: outbox, store: store, batchSize: batchSize}
+}
+
+// Run relays pending events every interval until ctx is done.
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.RelayPending(ctx); err != nil {
+			log.Printf("Friendship relay: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RelayPending applies every pending event and returns how many it
+// applied. It stops at the first event that fails, so that later events of
+// the same friendship are not applied before it.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	relayed := 0
+	for {
+		events, err := r.outbox.PendingFriendshipEvents(r.batchSize)
+		if err != nil {
+			return relayed, err
+		}
+		if len(events) == 0 {
+			return relayed, nil
+		}
+
+		applied := make([]uint64, 0, len(events))
+		var applyErr error
+		for _, event := range events {
+			if applyErr = r.apply(ctx, event); applyErr != nil {
+				break
+			}
+			applied = append(applied, event.ID)
+		}
+		if err := r.outbox.MarkPublished(applied); err != nil {
+			return relayed, err
+		}
+		relayed += len(applied)
+		if applyErr != nil {
+			return relayed, applyErr
+		}
+	}
+}
+
+func (r *Relay) apply(ctx context.Context, event models.FriendshipEvent) error {
+	var err error
+	switch event.Type {
+	case models.FriendshipAdded:
+		if err = r.store.AddFriend(ctx, event.UserID, event.FriendID); err == nil {
+			err = r.store.AddFriend(ctx, event.FriendID, event.UserID)
+		}
+	case models.FriendshipRemoved:
+		if err = r.store.RemoveFriend(ctx, event.UserID, event.FriendID); err == nil {
+			err = r.store.RemoveFriend(ctx, event.FriendID, event.UserID)
+		}
+	default:
+		log.Printf("Skipping friendship event %d of unknown type %q", event.ID, event.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("error relaying friendship event %d: %w", event.ID, err)
+	}
+	return nil
+}
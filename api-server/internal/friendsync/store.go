@@ -0,0 +1,83 @@
+// Package friendsync keeps the friend sets the websocket-server reads from
+// Redis in line with the user_friends table: a relay applies the outbox of
+// friendship events as they happen and a reconciler periodically repairs
+// whatever drifted anyway.
+package friendsync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// FriendStore is the Redis copy of the friend graph. Each user's friends
+// are stored separately, so a friendship is added or removed once per user.
+type FriendStore interface {
+	AddFriend(ctx context.Context, userID, friendID string) error
+	RemoveFriend(ctx context.Context, userID, friendID string) error
+	Friends(ctx context.Context, userID string) ([]string, error)
+	// Users lists the users that have friends in the store.
+	Users(ctx context.Context) ([]string, error)
+}
+
+// The key layout of websocket-server/pkg/redis/keys.go:
+//
+//	friends:<user_id>          set of friend user IDs
+//	friends_changed:<user_id>  pub/sub channel announcing changes to it
+const (
+	friendsPrefix        = "friends:"
+	friendsChangedPrefix = "friends_changed:"
+)
+
+type redisFriendStore struct {
+	client *redis.Client
+}
+
+func NewRedisFriendStore(client *redis.Client) FriendStore {
+	return &redisFriendStore{client: client}
+}
+
+// AddFriend and RemoveFriend announce the change so that open friend
+// subscriptions on the websocket-server follow it.
+func (s *redisFriendStore) AddFriend(ctx context.Context, userID, friendID string) error {
+	if err := s.client.SAdd(ctx, friendsPrefix+userID, friendID).Err(); err != nil {
+		return fmt.Errorf("error adding friend %s of user %s: %w", friendID, userID, err)
+	}
+	return s.publishChanged(ctx, userID)
+}
+
+func (s *redisFriendStore) RemoveFriend(ctx context.Context, userID, friendID string) error {
+	if err := s.client.SRem(ctx, friendsPrefix+userID, friendID).Err(); err != nil {
+		return fmt.Errorf("error removing friend %s of user %s: %w", friendID, userID, err)
+	}
+	return s.publishChanged(ctx, userID)
+}
+
+func (s *redisFriendStore) publishChanged(ctx context.Context, userID string) error {
+	if err := s.client.Publish(ctx, friendsChangedPrefix+userID, userID).Err(); err != nil {
+		return fmt.Errorf("error announcing friend change of user %s: %w", userID, err)
+	}
+	return nil
+}
+
+func (s *redisFriendStore) Friends(ctx context.Context, userID string) ([]string, error) {
+	friends, err := s.client.SMembers(ctx, friendsPrefix+userID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error getting friends of user %s: %w", userID, err)
+	}
+	return friends, nil
+}
+
+func (s *redisFriendStore) Users(ctx context.Context) ([]string, error) {
+	var users []string
+	iter := s.client.Scan(ctx, 0, friendsPrefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		users = append(users, strings.TrimPrefix(iter.Val(), friendsPrefix))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("error listing friend sets: %w", err)
+	}
+	return users, nil
+}
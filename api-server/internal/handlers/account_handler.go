@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"matching-service/api-server/internal/models"
+	"matching-service/api-server/internal/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AccountHandler struct {
+	accountService services.AccountService
+	userService    services.UserService
+}
+
+func NewAccountHandler(accountService services.AccountService, userService services.UserService) *AccountHandler {
+	return &AccountHandler{accountService: accountService, userService: userService}
+}
+
+// SendVerification godoc
+// @Summary Resend the verification email
+// @Description Mail the authenticated user a new link to verify their email address. Links expire after 24 hours and work once.
+// @Tags account
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/email/verification [post]
+func (h *AccountHandler) SendVerification(c *gin.Context) {
+	user, err := h.userService.GetUserByID(c.GetString("user_id"))
+	if err == nil {
+		err = h.accountService.SendVerification(c.Request.Context(), user)
+	}
+	switch {
+	case errors.Is(err, services.ErrEmailAlreadyVerified):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Sending verification email failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+	default:
+		c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+	}
+}
+
+// VerifyEmail godoc
+// @Summary Verify an email address
+// @Description Consume the token of a verification link
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param emailTokenInput body models.EmailTokenInput true "Token from the verification link"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/email/verify [post]
+func (h *AccountHandler) VerifyEmail(c *gin.Context) {
+	var input models.EmailTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accountService.VerifyEmail(input.Token); err != nil {
+		actionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email address verified"})
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Mail a password reset link to the address, if it belongs to a user. The response is the same either way. Links expire after an hour and work once.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param forgotPasswordInput body models.ForgotPasswordInput true "Email address of the account"
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/password/forgot [post]
+func (h *AccountHandler) ForgotPassword(c *gin.Context) {
+	var input models.ForgotPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Failures are logged rather than returned, so as not to tell which
+	// addresses have an account
+	if err := h.accountService.RequestPasswordReset(c.Request.Context(), input.Email); err != nil {
+		log.Printf("Password reset request failed: %v", err)
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the address has an account, a reset link was sent to it"})
+}
+
+// ResetPassword godoc
+// @Summary Reset a password
+// @Description Set a new password with the token of a reset link. Every session of the user is logged out.
+// @Tags account
+// @Accept json
+// @Param resetPasswordInput body models.ResetPasswordInput true "Token from the reset link and the new password"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/password/reset [post]
+func (h *AccountHandler) ResetPassword(c *gin.Context) {
+	var input models.ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accountService.ResetPassword(input.Token, input.Password); err != nil {
+		actionError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func actionError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrInvalidActionToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("Account action failed: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+}
@@ -1,19 +1,28 @@
 package handlers
 
 import (
+	"errors"
+	"io"
+	"log"
+	"matching-service/api-server/internal/auth"
 	"matching-service/api-server/internal/models"
 	"matching-service/api-server/internal/services"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
 type UserHandler struct {
-	userService services.UserService
+	userService  services.UserService
+	tokenService services.TokenService
+	keys         *auth.KeySet
+	denyList     auth.DenyList
 }
 
-func NewUserHandler(userService services.UserService) *UserHandler {
-	return &UserHandler{userService: userService}
+func NewUserHandler(userService services.UserService, tokenService services.TokenService, keys *auth.KeySet, denyList auth.DenyList) *UserHandler {
+	return &UserHandler{userService: userService, tokenService: tokenService, keys: keys, denyList: denyList}
 }
 
 // Register godoc
@@ -49,14 +58,17 @@ func (h *UserHandler) Register(c *gin.Context) {
 
 // Login godoc
 // @Summary Authenticate a user
-// @Description Authenticate a user and return a JWT token
+// @Description Authenticate a user and return a short-lived JWT access token with a refresh token. Repeated failures for a username or from a client address lock it out for a growing time.
 // @Tags authentication
 // @Accept json
 // @Produce json
 // @Param loginInput body models.LoginInput true "Login credentials"
-// @Success 200 {object} map[string]string
+// @Success 200 {object} models.TokenPair
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string "Email address not verified, when verification is required"
+// @Failure 429 {object} map[string]string "Too many failed attempts, retry after the Retry-After header's seconds"
+// @Failure 500 {object} map[string]string
 // @Router /api/v1/login [post]
 func (h *UserHandler) Login(c *gin.Context) {
 	var loginInput models.LoginInput
@@ -65,13 +77,93 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := h.userService.Login(loginInput.Username, loginInput.Password)
-	if err != nil {
+	tokens, err := h.userService.Login(loginInput.Username, loginInput.Password, c.ClientIP())
+	var locked *services.LockedError
+	switch {
+	case errors.As(err, &locked):
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrEmailNotVerified):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Login failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Refresh godoc
+// @Summary Refresh an access token
+// @Description Exchange a refresh token for a new access token and refresh token. Each refresh token works once; presenting a used one revokes every token of its login.
+// @Tags authentication
+// @Accept json
+// @Produce json
+// @Param refreshInput body models.RefreshInput true "Refresh token"
+// @Success 200 {object} models.TokenPair
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/refresh [post]
+func (h *UserHandler) Refresh(c *gin.Context) {
+	var input models.RefreshInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.tokenService.Refresh(input.RefreshToken)
+	if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
+	if err != nil {
+		log.Printf("Refresh failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout godoc
+// @Summary Log out
+// @Description Revoke the access token of the request and, when given, the refresh token with every token issued from the same login
+// @Tags authentication
+// @Accept json
+// @Security BearerAuth
+// @Param logoutInput body models.LogoutInput false "Refresh token of the session"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/logout [post]
+func (h *UserHandler) Logout(c *gin.Context) {
+	var input models.LogoutInput
+	// The body is optional, but not when it is malformed
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	refreshToken := ""
+	if input.RefreshToken != nil {
+		refreshToken = *input.RefreshToken
+	}
+
+	claims := c.MustGet("claims").(*auth.Claims)
+	if err := h.tokenService.Logout(c.Request.Context(), claims, refreshToken); err != nil {
+		log.Printf("Logout failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
 }
 
 // GetProfile godoc
@@ -85,8 +177,7 @@ func (h *UserHandler) Login(c *gin.Context) {
 // @Failure 500 {object} map[string]string
 // @Router /api/v1/profile [get]
 func (h *UserHandler) GetProfile(c *gin.Context) {
-	username, _ := c.Get("username")
-	user, err := h.userService.GetUserByUsername(username.(string))
+	user, err := h.userService.GetUserByID(c.GetString("user_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user profile"})
 		return
@@ -99,6 +190,72 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 	})
 }
 
+// SetRoles godoc
+// @Summary Set the roles of a user
+// @Description Replace the roles of a user. Admin only. Access tokens already issued keep the old roles until they expire.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param rolesInput body models.RolesInput true "Roles to grant"
+// @Success 200 {object} models.UserRoles
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/admin/users/{id}/roles [put]
+func (h *UserHandler) SetRoles(c *gin.Context) {
+	var input models.RolesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	roles, err := h.userService.SetRoles(c.Param("id"), input.Roles)
+	switch {
+	case errors.Is(err, services.ErrUnknownRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		log.Printf("Setting roles failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set roles"})
+	default:
+		log.Printf("User %s set the roles of user %s to %v", c.GetString("user_id"), roles.ID, roles.Roles)
+		c.JSON(http.StatusOK, roles)
+	}
+}
+
+// Verify godoc
+// @Summary Verify an access token
+// @Description Used by the nginx auth_request gateway. Revoked tokens are rejected. Accepts the token from the Authorization header, Sec-WebSocket-Protocol or the token query parameter and returns the caller identity in the X-User-Id and X-Username headers.
+// @Tags authentication
+// @Security BearerAuth
+// @Success 200
+// @Header 200 {string} X-User-Id "ID of the authenticated user"
+// @Header 200 {string} X-Username "Username of the authenticated user"
+// @Failure 401
+// @Router /verify [get]
+func (h *UserHandler) Verify(c *gin.Context) {
+	tokenString := auth.TokenFromRequest(c.Request)
+	if tokenString == "" {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := h.keys.ValidateAccessToken(c.Request.Context(), h.denyList, tokenString)
+	if err != nil || claims.Subject == "" {
+		log.Printf("Rejected token at /verify: %v", err)
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	c.Header("X-User-Id", claims.Subject)
+	c.Header("X-Username", claims.Username)
+	c.Status(http.StatusOK)
+}
+
 // LoginInput represents the structure of the login request
 type LoginInput struct {
 	Username string `json:"username" binding:"required"`
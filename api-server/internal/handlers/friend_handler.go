@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"matching-service/api-server/internal/models"
+	"matching-service/api-server/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FriendHandler struct {
+	friendService services.FriendService
+}
+
+func NewFriendHandler(friendService services.FriendService) *FriendHandler {
+	return &FriendHandler{friendService: friendService}
+}
+
+// ListFriends godoc
+// @Summary List friends
+// @Description List the authenticated user's friends, ordered by username
+// @Tags friends
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number, from 1" default(1)
+// @Param page_size query int false "Friends per page, at most 100" default(20)
+// @Success 200 {object} models.UserPage
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/friends [get]
+func (h *FriendHandler) ListFriends(c *gin.Context) {
+	page, pageSize, ok := pagination(c)
+	if !ok {
+		return
+	}
+	friends, err := h.friendService.ListFriends(c.GetString("user_id"), page, pageSize)
+	if err != nil {
+		friendError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, friends)
+}
+
+// RemoveFriend godoc
+// @Summary Remove a friend
+// @Description End the friendship with another user, for both of them
+// @Tags friends
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Friend user ID"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/friends/{id} [delete]
+func (h *FriendHandler) RemoveFriend(c *gin.Context) {
+	if err := h.friendService.RemoveFriend(c.GetString("user_id"), c.Param("id")); err != nil {
+		friendError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// SearchUsers godoc
+// @Summary Search users
+// @Description Find users whose username starts with the query
+// @Tags friends
+// @Produce json
+// @Security BearerAuth
+// @Param q query string true "Username prefix"
+// @Param page query int false "Page number, from 1" default(1)
+// @Param page_size query int false "Users per page, at most 100" default(20)
+// @Success 200 {object} models.UserPage
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/users/search [get]
+func (h *FriendHandler) SearchUsers(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	page, pageSize, ok := pagination(c)
+	if !ok {
+		return
+	}
+	users, err := h.friendService.SearchUsers(query, page, pageSize)
+	if err != nil {
+		friendError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+// SendFriendRequest godoc
+// @Summary Send a friend request
+// @Description Ask another user to become friends. The friendship starts once they accept.
+// @Tags friends
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.FriendRequestInput true "Recipient"
+// @Success 201 {object} models.FriendRequest
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/friends/requests [post]
+func (h *FriendHandler) SendFriendRequest(c *gin.Context) {
+	var input models.FriendRequestInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	request, err := h.friendService.SendRequest(c.GetString("user_id"), input.UserID)
+	if err != nil {
+		friendError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, request)
+}
+
+// ListFriendRequests godoc
+// @Summary List pending friend requests
+// @Description List the pending friend requests the authenticated user received or sent, newest first
+// @Tags friends
+// @Produce json
+// @Security BearerAuth
+// @Param direction query string false "incoming or outgoing" Enums(incoming, outgoing) default(incoming)
+// @Success 200 {array} models.FriendRequest
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/friends/requests [get]
+func (h *FriendHandler) ListFriendRequests(c *gin.Context) {
+	var incoming bool
+	switch c.DefaultQuery("direction", "incoming") {
+	case "incoming":
+		incoming = true
+	case "outgoing":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "direction must be incoming or outgoing"})
+		return
+	}
+	requests, err := h.friendService.ListRequests(c.GetString("user_id"), incoming)
+	if err != nil {
+		friendError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, requests)
+}
+
+// AcceptFriendRequest godoc
+// @Summary Accept a friend request
+// @Description Accept a pending friend request sent to the authenticated user
+// @Tags friends
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Friend request ID"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/friends/requests/{id}/accept [post]
+func (h *FriendHandler) AcceptFriendRequest(c *gin.Context) {
+	if err := h.friendService.AcceptRequest(c.GetString("user_id"), c.Param("id")); err != nil {
+		friendError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// DeclineFriendRequest godoc
+// @Summary Decline a friend request
+// @Description Decline a pending friend request sent to the authenticated user
+// @Tags friends
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Friend request ID"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/friends/requests/{id}/decline [post]
+func (h *FriendHandler) DeclineFriendRequest(c *gin.Context) {
+	if err := h.friendService.DeclineRequest(c.GetString("user_id"), c.Param("id")); err != nil {
+		friendError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CancelFriendRequest godoc
+// @Summary Cancel a friend request
+// @Description Withdraw a pending friend request the authenticated user sent
+// @Tags friends
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Friend request ID"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/friends/requests/{id} [delete]
+func (h *FriendHandler) CancelFriendRequest(c *gin.Context) {
+	if err := h.friendService.CancelRequest(c.GetString("user_id"), c.Param("id")); err != nil {
+		friendError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// pagination reads the page and page_size query parameters, replying 400
+// to invalid ones.
+func pagination(c *gin.Context) (page int, pageSize int, ok bool) {
+	page, pageSize = 1, services.DefaultPageSize
+	var err error
+	if value := c.Query("page"); value != "" {
+		if page, err = strconv.Atoi(value); err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive integer"})
+			return 0, 0, false
+		}
+	}
+	if value := c.Query("page_size"); value != "" {
+		if pageSize, err = strconv.Atoi(value); err != nil || pageSize < 1 || pageSize > services.MaxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "page_size must be between 1 and 100"})
+			return 0, 0, false
+		}
+	}
+	return page, pageSize, true
+}
+
+// friendError replies with the status of a friend service error.
+func friendError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrNotFriends), errors.Is(err, services.ErrFriendRequestNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAlreadyFriends), errors.Is(err, services.ErrFriendRequestExists), errors.Is(err, services.ErrFriendRequestNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSelfFriendRequest):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Friend request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"matching-service/api-server/internal/auth"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSHandler struct {
+	keys *auth.KeySet
+}
+
+func NewJWKSHandler(keys *auth.KeySet) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// JWKS godoc
+// @Summary Public signing keys
+// @Description Serves the public keys access tokens are signed with as a JSON Web Key Set, so that other services can verify tokens locally. A token names its key in the kid header. Keys being rotated out stay listed until the tokens they signed have expired. HS256 keys are secret and never listed.
+// @Tags authentication
+// @Produce json
+// @Success 200 {object} auth.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *JWKSHandler) JWKS(c *gin.Context) {
+	// Verifiers refetch on an unknown kid, so the set can be cached briefly
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
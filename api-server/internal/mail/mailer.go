@@ -0,0 +1,185 @@
+// Package mail sends the account emails of the api-server, e.g. email
+// verification and password reset links.
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// SendTimeout bounds an SMTP exchange when the context has no deadline.
+const SendTimeout = 30 * time.Second
+
+type smtpMailer struct {
+	config SMTPConfig
+}
+
+// NewSMTPMailer sends mail through an SMTP relay, upgrading to TLS when the
+// relay offers STARTTLS and authenticating with PLAIN when a username is
+// set.
+func NewSMTPMailer(config SMTPConfig) Mailer {
+	return &smtpMailer{config: config}
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg Message) error {
+	if err := m.send(ctx, msg); err != nil {
+		return fmt.Errorf("error sending mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// send is smtp.SendMail with the whole exchange bound to ctx.
+func (m *smtpMailer) send(ctx context.Context, msg Message) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, SendTimeout)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.config.Host, m.config.Port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	// Cancelling ctx interrupts the exchange
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.config.Host}); err != nil {
+			return err
+		}
+	}
+	if m.config.Username != "" {
+		auth := smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(m.config.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(format(m.config.From, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+type fileMailer struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileMailer is for local development: it writes every message to a
+// .eml file in dir, or to the log when dir is empty, instead of sending it.
+func NewFileMailer(dir string) Mailer {
+	return &fileMailer{dir: dir}
+}
+
+func (m *fileMailer) Send(ctx context.Context, msg Message) error {
+	data := format("noreply@localhost", msg)
+	if m.dir == "" {
+		log.Printf("Mail not sent, no SMTP_HOST:\n%s", data)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("error creating mail directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.New().String()[:8])
+	if err := os.WriteFile(filepath.Join(m.dir, name), data, 0o644); err != nil {
+		return fmt.Errorf("error writing mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// LoadMailer returns an SMTP mailer when SMTP_HOST is set, configured by
+// SMTP_PORT (default 587), SMTP_USERNAME, SMTP_PASSWORD and MAIL_FROM.
+// Otherwise mail goes to the directory MAIL_DIR, or to the log.
+func LoadMailer() Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		log.Println("SMTP_HOST is not set, mail is written locally instead of sent")
+		return NewFileMailer(os.Getenv("MAIL_DIR"))
+	}
+	config := SMTPConfig{
+		Host:     host,
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+	}
+	if config.Port == "" {
+		config.Port = "587"
+	}
+	if config.From == "" {
+		config.From = "noreply@" + host
+	}
+	return NewSMTPMailer(config)
+}
+
+// format renders a plain text RFC 5322 message. Header values are single
+// lines; line breaks in them are dropped.
+func format(from string, msg Message) []byte {
+	header := strings.NewReplacer("\r", "", "\n", "")
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", header.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", header.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", header.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
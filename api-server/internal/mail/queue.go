@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+var ErrQueueFull = errors.New("mail queue is full")
+
+// Queue sends mail in the background, so that requests neither wait for
+// the relay nor take longer when they send mail than when they do not.
+type Queue struct {
+	mailer   Mailer
+	messages chan Message
+	timeout  time.Duration
+}
+
+// NewQueue buffers up to size messages for mailer, giving each send
+// timeout.
+func NewQueue(mailer Mailer, size int, timeout time.Duration) *Queue {
+	return &Queue{mailer: mailer, messages: make(chan Message, size), timeout: timeout}
+}
+
+// Send queues the message and returns at once. The message outlives ctx,
+// which is usually that of the request.
+func (q *Queue) Send(ctx context.Context, msg Message) error {
+	select {
+	case q.messages <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Run sends the queued messages until ctx is done. Failed sends are logged,
+// the user can ask for another link.
+func (q *Queue) Run(ctx context.Context) {
+	for {
+		select {
+		case msg := <-q.messages:
+			sendCtx, cancel := context.WithTimeout(ctx, q.timeout)
+			if err := q.mailer.Send(sendCtx, msg); err != nil {
+				log.Printf("Could not send mail: %v", err)
+			}
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware accepts valid access tokens that are not on denyList and
+// makes the caller's user_id, username and claims available to handlers.
+func AuthMiddleware(keys *auth.KeySet, denyList auth.DenyList) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -24,14 +26,45 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		claims, err := auth.ValidateToken(bearerToken[1])
+		claims, err := keys.ValidateAccessToken(c.Request.Context(), denyList, bearerToken[1])
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
+		c.Set("user_id", claims.Subject)
 		c.Set("username", claims.Username)
+		c.Set("claims", claims)
+		c.Next()
+	}
+}
+
+// RequireRole lets through only callers whose token grants role. It must
+// run after AuthMiddleware.
+func RequireRole(role string) gin.HandlerFunc {
+	return requireClaims(func(claims *auth.Claims) bool { return claims.HasRole(role) })
+}
+
+// RequireScope lets through only callers whose token grants scope. It must
+// run after AuthMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return requireClaims(func(claims *auth.Claims) bool { return claims.HasScope(scope) })
+}
+
+func requireClaims(allowed func(claims *auth.Claims) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.Get("claims")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+			c.Abort()
+			return
+		}
+		if !allowed(claims.(*auth.Claims)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
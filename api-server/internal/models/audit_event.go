@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Audit event types. A lockout is recorded when it starts and again when
+// it reaches the longest delay.
+const (
+	AuditUsernameLocked    = "username_locked"
+	AuditUsernameMaxLocked = "username_max_locked"
+	AuditClientLocked      = "client_locked"
+	AuditClientMaxLocked   = "client_max_locked"
+)
+
+// AuditEvent records a security relevant event. Username is the one the
+// event is about or, for a client lockout, the last one tried.
+type AuditEvent struct {
+	ID        uint64 `gorm:"primaryKey;autoIncrement"`
+	Type      string `gorm:"not null;index"`
+	Username  string `gorm:"index"`
+	ClientIP  string `gorm:"index"`
+	Detail    string
+	CreatedAt time.Time `gorm:"autoCreateTime;index"`
+}
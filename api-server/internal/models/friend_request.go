@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Friend request statuses. Only pending requests can change status.
+const (
+	FriendRequestPending   = "pending"
+	FriendRequestAccepted  = "accepted"
+	FriendRequestDeclined  = "declined"
+	FriendRequestCancelled = "cancelled"
+)
+
+// FriendRequest is a friendship waiting for the recipient's answer.
+// PendingPair names the two users while the request is pending and is
+// cleared once it is answered; its unique index allows a single pending
+// request per pair, in either direction.
+type FriendRequest struct {
+	ID          string    `gorm:"type:TEXT;primaryKey" json:"id" example:"7c9e6679-7425-40de-944b-e07fc1f90ae7"`
+	FromUserID  string    `gorm:"type:TEXT;not null;index" json:"from_user_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	ToUserID    string    `gorm:"type:TEXT;not null;index" json:"to_user_id" example:"6ba7b810-9dad-11d1-80b4-00c04fd430c8"`
+	Status      string    `gorm:"not null;index" json:"status" example:"pending" enums:"pending,accepted,declined,cancelled"`
+	PendingPair *string   `gorm:"uniqueIndex" json:"-"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at" example:"2024-08-31T14:30:00Z" swaggertype:"string" format:"date-time"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at" example:"2024-08-31T14:30:00Z" swaggertype:"string" format:"date-time"`
+}
+
+func (r *FriendRequest) BeforeCreate(tx *gorm.DB) (err error) {
+	r.ID = uuid.New().String()
+	return
+}
+
+// FriendPair is the PendingPair of a request between the two users, the
+// same whichever sent it.
+func FriendPair(userID, otherID string) string {
+	if otherID < userID {
+		userID, otherID = otherID, userID
+	}
+	return userID + ":" + otherID
+}
+
+// FriendRequestInput represents the structure for sending a friend request
+type FriendRequestInput struct {
+	UserID string `json:"user_id" binding:"required" example:"6ba7b810-9dad-11d1-80b4-00c04fd430c8"`
+}
+
+// PublicUser is what other users may see of a user
+type PublicUser struct {
+	ID       string `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Username string `json:"username" example:"johndoe"`
+}
+
+// UserPage is one page of a list of users
+type UserPage struct {
+	Users    []PublicUser `json:"users"`
+	Page     int          `json:"page" example:"1"`
+	PageSize int          `json:"page_size" example:"20"`
+	Total    int64        `json:"total" example:"42"`
+}
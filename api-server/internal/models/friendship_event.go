@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Friendship event types.
+const (
+	FriendshipAdded   = "friendship_added"
+	FriendshipRemoved = "friendship_removed"
+)
+
+// FriendshipEvent is an outbox row. It is written in the same transaction
+// as the friendship change it records, so no change is lost, and relayed to
+// the websocket-server's Redis afterwards. Friendships are bidirectional,
+// one event covers both users.
+type FriendshipEvent struct {
+	ID          uint64     `gorm:"primaryKey;autoIncrement"`
+	Type        string     `gorm:"not null"`
+	UserID      string     `gorm:"type:TEXT;not null"`
+	FriendID    string     `gorm:"type:TEXT;not null"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime"`
+	PublishedAt *time.Time `gorm:"index"`
+}
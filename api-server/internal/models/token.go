@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RefreshToken is one link of a token family: every refresh marks the
+// token used and issues its successor in the same family. Only the hash of
+// the token is stored, along with the jti of the access token issued with
+// it, so that revoking the family revokes its access tokens too.
+type RefreshToken struct {
+	ID            string    `gorm:"type:TEXT;primaryKey"`
+	FamilyID      string    `gorm:"type:TEXT;not null;index"`
+	UserID        string    `gorm:"type:TEXT;not null;index"`
+	TokenHash     string    `gorm:"not null;uniqueIndex"`
+	AccessTokenID string    `gorm:"type:TEXT"`
+	ExpiresAt     time.Time `gorm:"not null"`
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+	UsedAt        *time.Time
+	RevokedAt     *time.Time
+}
+
+func (t *RefreshToken) BeforeCreate(tx *gorm.DB) (err error) {
+	t.ID = uuid.New().String()
+	return
+}
+
+// ActionToken records the action tokens issued, e.g. for email
+// verification or password reset, so that each is used once. ID is the
+// token's jti.
+type ActionToken struct {
+	ID        string    `gorm:"type:TEXT;primaryKey"`
+	UserID    string    `gorm:"type:TEXT;not null;index"`
+	Purpose   string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UsedAt    *time.Time
+}
+
+// TokenPair is returned by login and refresh
+type TokenPair struct {
+	AccessToken  string `json:"access_token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	RefreshToken string `json:"refresh_token" example:"kRvz3Q3mC1j0gq0p7y8Xo2Yh0d4m0b8nqz6S9kz1y4A"`
+	TokenType    string `json:"token_type" example:"Bearer"`
+	ExpiresIn    int    `json:"expires_in" example:"900"` // seconds until the access token expires
+	// Token is the access token again, for clients written before refresh
+	// tokens existed
+	Token string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+}
+
+// RefreshInput represents the structure for refresh requests
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required" example:"kRvz3Q3mC1j0gq0p7y8Xo2Yh0d4m0b8nqz6S9kz1y4A"`
+}
+
+// LogoutInput represents the structure for logout requests. Without a
+// refresh token only the access token is revoked.
+type LogoutInput struct {
+	RefreshToken *string `json:"refresh_token" binding:"omitnil,min=1" example:"kRvz3Q3mC1j0gq0p7y8Xo2Yh0d4m0b8nqz6S9kz1y4A"`
+}
+
+// EmailTokenInput represents the structure for consuming an email
+// verification token
+type EmailTokenInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ForgotPasswordInput represents the structure for requesting a password
+// reset
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required,email" example:"john@example.com"`
+}
+
+// ResetPasswordInput represents the structure for resetting a password
+type ResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required" example:"secret456"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,16 +17,38 @@ type User struct {
 	Username  string         `gorm:"unique;not null" json:"username" example:"johndoe"`
 	Password  string         `gorm:"not null" json:"-" swaggerignore:"true"`
 	Email     string         `gorm:"unique;not null" json:"email" example:"john@example.com"`
+	// EmailVerifiedAt is set once the user followed the verification link
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" example:"2024-08-31T14:35:00Z" swaggertype:"string" format:"date-time"`
+	// Roles is a comma separated list of RoleUser, RoleAdmin
+	Roles string `gorm:"not null;default:user" json:"-" swaggerignore:"true"`
 
 	// Many-to-many relationship to represent the friends
 	Friends []*User `gorm:"many2many:user_friends" json:"friends"`
 }
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// KnownRoles are the roles that can be granted.
+var KnownRoles = []string{RoleUser, RoleAdmin}
+
 func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
 	u.ID = uuid.New().String()
+	if u.Roles == "" {
+		u.Roles = RoleUser
+	}
 	return
 }
 
+func (u *User) RoleList() []string {
+	if u.Roles == "" {
+		return nil
+	}
+	return strings.Split(u.Roles, ",")
+}
+
 // UserInput represents the structure for user input in registration
 type UserInput struct {
 	Username string `json:"username" binding:"required" example:"johndoe"`
@@ -38,3 +61,15 @@ type LoginInput struct {
 	Username string `json:"username" binding:"required" example:"johndoe"`
 	Password string `json:"password" binding:"required" example:"secret123"`
 }
+
+// RolesInput represents the structure for granting roles
+type RolesInput struct {
+	Roles []string `json:"roles" binding:"required,min=1" example:"user,admin"`
+}
+
+// UserRoles is a user with the roles granted to them
+type UserRoles struct {
+	ID       string   `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	Username string   `json:"username" example:"johndoe"`
+	Roles    []string `json:"roles" example:"user,admin"`
+}
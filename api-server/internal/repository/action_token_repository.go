@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"matching-service/api-server/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrActionTokenUsed = errors.New("action token already used or unknown")
+
+type ActionTokenRepository interface {
+	Create(token *models.ActionToken) error
+	// Use marks the token used. It fails with ErrActionTokenUsed unless the
+	// token was issued for purpose, has not expired and this call is the
+	// one that used it.
+	Use(id, purpose string) error
+	// UseAll marks every outstanding token of the user for purpose used.
+	UseAll(userID, purpose string) error
+}
+
+type actionTokenRepo struct {
+	db *gorm.DB
+}
+
+func NewActionTokenRepo(db *gorm.DB) ActionTokenRepository {
+	return &actionTokenRepo{db: db}
+}
+
+func (r *actionTokenRepo) Create(token *models.ActionToken) error {
+	if err := r.db.Create(token).Error; err != nil {
+		return fmt.Errorf("error creating action token: %w", err)
+	}
+	return nil
+}
+
+func (r *actionTokenRepo) Use(id, purpose string) error {
+	now := time.Now()
+	result := r.db.Model(&models.ActionToken{}).
+		Where("id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", id, purpose, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return fmt.Errorf("error using action token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrActionTokenUsed
+	}
+	return nil
+}
+
+func (r *actionTokenRepo) UseAll(userID, purpose string) error {
+	err := r.db.Model(&models.ActionToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("error using action tokens: %w", err)
+	}
+	return nil
+}
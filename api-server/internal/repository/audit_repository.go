@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"fmt"
+	"matching-service/api-server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type AuditRepository interface {
+	Record(event *models.AuditEvent) error
+}
+
+type auditRepo struct {
+	db *gorm.DB
+}
+
+func NewAuditRepo(db *gorm.DB) AuditRepository {
+	return &auditRepo{db: db}
+}
+
+func (r *auditRepo) Record(event *models.AuditEvent) error {
+	if err := r.db.Create(event).Error; err != nil {
+		return fmt.Errorf("error recording audit event %s: %w", event.Type, err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"matching-service/api-server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrFriendRequestNotPending = errors.New("friend request is no longer pending")
+	ErrFriendRequestExists     = errors.New("a pending friend request already exists")
+)
+
+type FriendRequestRepository interface {
+	// Create fails with ErrFriendRequestExists when a request between the
+	// two users is already pending, including one created concurrently.
+	Create(request *models.FriendRequest) error
+	FindByID(id string) (*models.FriendRequest, error)
+	FindPendingBetween(userID, otherID string) (*models.FriendRequest, error)
+	ListPending(userID string, incoming bool) ([]models.FriendRequest, error)
+	// Accept marks a pending request accepted and adds the friendship in
+	// the same transaction.
+	Accept(request *models.FriendRequest) error
+	SetStatus(request *models.FriendRequest, status string) error
+}
+
+type friendRequestRepo struct {
+	db *gorm.DB
+}
+
+func NewFriendRequestRepo(db *gorm.DB) FriendRequestRepository {
+	return &friendRequestRepo{db: db}
+}
+
+func (r *friendRequestRepo) Create(request *models.FriendRequest) error {
+	request.Status = models.FriendRequestPending
+	pair := models.FriendPair(request.FromUserID, request.ToUserID)
+	request.PendingPair = &pair
+	if err := r.db.Create(request).Error; err != nil {
+		// The unique index on pending_pair is what refuses a concurrent
+		// duplicate; tell it apart from other failures by looking
+		existing, findErr := r.FindPendingBetween(request.FromUserID, request.ToUserID)
+		if findErr == nil && existing != nil {
+			return ErrFriendRequestExists
+		}
+		return fmt.Errorf("error creating friend request: %w", err)
+	}
+	return nil
+}
+
+func (r *friendRequestRepo) FindByID(id string) (*models.FriendRequest, error) {
+	var request models.FriendRequest
+	result := r.db.Where("id = ?", id).First(&request)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &request, nil
+}
+
+// FindPendingBetween returns the pending request between the two users, in
+// either direction.
+func (r *friendRequestRepo) FindPendingBetween(userID, otherID string) (*models.FriendRequest, error) {
+	var request models.FriendRequest
+	result := r.db.Where("status = ? AND ((from_user_id = ? AND to_user_id = ?) OR (from_user_id = ? AND to_user_id = ?))",
+		models.FriendRequestPending, userID, otherID, otherID, userID).First(&request)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &request, nil
+}
+
+// ListPending returns the user's pending requests, received ones when
+// incoming is true and sent ones otherwise, newest first.
+func (r *friendRequestRepo) ListPending(userID string, incoming bool) ([]models.FriendRequest, error) {
+	column := "from_user_id"
+	if incoming {
+		column = "to_user_id"
+	}
+	var requests []models.FriendRequest
+	err := r.db.Where(column+" = ? AND status = ?", userID, models.FriendRequestPending).Order("created_at DESC").Find(&requests).Error
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving friend requests: %w", err)
+	}
+	return requests, nil
+}
+
+func (r *friendRequestRepo) Accept(request *models.FriendRequest) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := setStatus(tx, request, models.FriendRequestAccepted); err != nil {
+			return err
+		}
+		return addFriendship(tx, request.FromUserID, request.ToUserID)
+	})
+}
+
+func (r *friendRequestRepo) SetStatus(request *models.FriendRequest, status string) error {
+	return setStatus(r.db, request, status)
+}
+
+// setStatus moves a request out of pending. It fails with
+// ErrFriendRequestNotPending when a concurrent answer got there first.
+func setStatus(db *gorm.DB, request *models.FriendRequest, status string) error {
+	result := db.Model(request).Where("status = ?", models.FriendRequestPending).
+		Updates(map[string]interface{}{"status": status, "pending_pair": nil})
+	if result.Error != nil {
+		return fmt.Errorf("error updating friend request: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrFriendRequestNotPending
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"fmt"
+	"matching-service/api-server/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OutboxRepository reads the friendship events that still have to be
+// relayed.
+type OutboxRepository interface {
+	PendingFriendshipEvents(limit int) ([]models.FriendshipEvent, error)
+	MarkPublished(ids []uint64) error
+}
+
+type outboxRepo struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepo(db *gorm.DB) OutboxRepository {
+	return &outboxRepo{db: db}
+}
+
+// PendingFriendshipEvents returns up to limit unpublished events, oldest
+// first.
+func (r *outboxRepo) PendingFriendshipEvents(limit int) ([]models.FriendshipEvent, error) {
+	var events []models.FriendshipEvent
+	err := r.db.Where("published_at IS NULL").Order("id").Limit(limit).Find(&events).Error
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving pending friendship events: %w", err)
+	}
+	return events, nil
+}
+
+func (r *outboxRepo) MarkPublished(ids []uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	err := r.db.Model(&models.FriendshipEvent{}).Where("id IN ?", ids).Update("published_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("error marking friendship events published: %w", err)
+	}
+	return nil
+}
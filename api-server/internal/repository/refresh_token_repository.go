@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"matching-service/api-server/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrRefreshTokenUsed = errors.New("refresh token already used")
+
+type RefreshTokenRepository interface {
+	Create(token *models.RefreshToken) error
+	FindByHash(hash string) (*models.RefreshToken, error)
+	// MarkUsed fails with ErrRefreshTokenUsed unless this call is the one
+	// that used the token.
+	MarkUsed(token *models.RefreshToken) error
+	// RevokeFamily returns the tokens it revoked, whose access tokens the
+	// caller should revoke too.
+	RevokeFamily(familyID string) ([]models.RefreshToken, error)
+	// RevokeUser revokes every refresh token of the user and, like
+	// RevokeFamily, returns them.
+	RevokeUser(userID string) ([]models.RefreshToken, error)
+}
+
+type refreshTokenRepo struct {
+	db *gorm.DB
+}
+
+func NewRefreshTokenRepo(db *gorm.DB) RefreshTokenRepository {
+	return &refreshTokenRepo{db: db}
+}
+
+func (r *refreshTokenRepo) Create(token *models.RefreshToken) error {
+	if err := r.db.Create(token).Error; err != nil {
+		return fmt.Errorf("error creating refresh token: %w", err)
+	}
+	return nil
+}
+
+func (r *refreshTokenRepo) FindByHash(hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	result := r.db.Where("token_hash = ?", hash).First(&token)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &token, nil
+}
+
+func (r *refreshTokenRepo) MarkUsed(token *models.RefreshToken) error {
+	result := r.db.Model(token).Where("used_at IS NULL AND revoked_at IS NULL").Update("used_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("error using refresh token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrRefreshTokenUsed
+	}
+	return nil
+}
+
+func (r *refreshTokenRepo) RevokeFamily(familyID string) ([]models.RefreshToken, error) {
+	tokens, err := r.revoke("family_id = ?", familyID)
+	if err != nil {
+		return nil, fmt.Errorf("error revoking refresh token family: %w", err)
+	}
+	return tokens, nil
+}
+
+func (r *refreshTokenRepo) RevokeUser(userID string) ([]models.RefreshToken, error) {
+	tokens, err := r.revoke("user_id = ?", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error revoking refresh tokens of user %s: %w", userID, err)
+	}
+	return tokens, nil
+}
+
+// revoke revokes the live tokens matching the condition and returns them.
+func (r *refreshTokenRepo) revoke(query string, arg string) ([]models.RefreshToken, error) {
+	var tokens []models.RefreshToken
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(query+" AND revoked_at IS NULL", arg).Find(&tokens).Error; err != nil {
+			return err
+		}
+		if len(tokens) == 0 {
+			return nil
+		}
+		ids := make([]string, len(tokens))
+		for i, token := range tokens {
+			ids[i] = token.ID
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("id IN ? AND revoked_at IS NULL", ids).
+			Update("revoked_at", time.Now()).Error
+	})
+	return tokens, err
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"matching-service/api-server/internal/models"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -11,10 +13,17 @@ import (
 type UserRepository interface {
 	FindByUsername(username string) (*models.User, error)
 	FindByEmail(email string) (*models.User, error)
+	FindByID(id string) (*models.User, error)
+	SearchByUsername(query string, offset, limit int) ([]models.User, int64, error)
 	CreateUser(user *models.User) error
+	SetRoles(userID string, roles []string) error
+	SetPassword(userID, passwordHash string) error
+	MarkEmailVerified(userID string) error
 	AddFriend(userID, friendID string) error
 	RemoveFriend(userID, friendID string) error
 	GetFriends(userID string) ([]models.User, error)
+	GetFriendsPage(userID string, offset, limit int) ([]models.User, int64, error)
+	AreFriends(userID, friendID string) (bool, error)
 	GetFriendshipRecords() ([]struct {
 		UserID   string
 		FriendID string
@@ -41,6 +50,31 @@ func (r *userRepo) FindByEmail(email string) (*models.User, error) {
 	return &user, nil
 }
 
+func (r *userRepo) SetRoles(userID string, roles []string) error {
+	err := r.db.Model(&models.User{}).Where("id = ?", userID).Update("roles", strings.Join(roles, ",")).Error
+	if err != nil {
+		return fmt.Errorf("error setting roles of user %s: %w", userID, err)
+	}
+	return nil
+}
+
+func (r *userRepo) SetPassword(userID, passwordHash string) error {
+	err := r.db.Model(&models.User{}).Where("id = ?", userID).Update("password", passwordHash).Error
+	if err != nil {
+		return fmt.Errorf("error setting password of user %s: %w", userID, err)
+	}
+	return nil
+}
+
+// MarkEmailVerified keeps the time of the first verification.
+func (r *userRepo) MarkEmailVerified(userID string) error {
+	err := r.db.Model(&models.User{}).Where("id = ? AND email_verified_at IS NULL", userID).Update("email_verified_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("error verifying email of user %s: %w", userID, err)
+	}
+	return nil
+}
+
 func (r *userRepo) FindByUsername(username string) (*models.User, error) {
 	var user models.User
 	result := r.db.Where("username = ?", username).First(&user)
@@ -53,6 +87,38 @@ func (r *userRepo) FindByUsername(username string) (*models.User, error) {
 	return &user, nil
 }
 
+func (r *userRepo) FindByID(id string) (*models.User, error) {
+	var user models.User
+	result := r.db.Where("id = ?", id).First(&user)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &user, nil
+}
+
+// SearchByUsername returns a page of the users whose username starts with
+// query, ordered by username, and the number of matches.
+func (r *userRepo) SearchByUsername(query string, offset, limit int) ([]models.User, int64, error) {
+	var users []models.User
+	var total int64
+	matches := r.db.Model(&models.User{}).Where(`username LIKE ? ESCAPE '\'`, escapeLike(query)+"%")
+	if err := matches.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("error counting users: %w", err)
+	}
+	if err := matches.Order("username").Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+		return nil, 0, fmt.Errorf("error searching users: %w", err)
+	}
+	return users, total, nil
+}
+
+// escapeLike makes the LIKE wildcards in s match literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
 func (r *userRepo) CreateUser(user *models.User) error {
 	result := r.db.Create(user)
 	if result.Error != nil {
@@ -83,6 +149,10 @@ func (r *userRepo) RemoveFriend(userID, friendID string) error {
 			return fmt.Errorf("error removing user from friend: %w", err)
 		}
 
+		if err := recordFriendshipEvent(tx, models.FriendshipRemoved, userID, friendID); err != nil {
+			return err
+		}
+
 		log.Printf("Successfully removed friendship between %s and %s", userID, friendID)
 		return nil
 	})
@@ -90,29 +160,39 @@ func (r *userRepo) RemoveFriend(userID, friendID string) error {
 
 func (r *userRepo) AddFriend(userID, friendID string) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
-		var user, friend models.User
+		return addFriendship(tx, userID, friendID)
+	})
+}
 
-		if err := tx.First(&user, "id = ?", userID).Error; err != nil {
-			return fmt.Errorf("error finding user: %w", err)
-		}
+// addFriendship inserts a bidirectional friendship and its outbox event
+// inside tx.
+func addFriendship(tx *gorm.DB, userID, friendID string) error {
+	var user, friend models.User
 
-		if err := tx.First(&friend, "id = ?", friendID).Error; err != nil {
-			return fmt.Errorf("error finding friend: %w", err)
-		}
+	if err := tx.First(&user, "id = ?", userID).Error; err != nil {
+		return fmt.Errorf("error finding user: %w", err)
+	}
 
-		// Add friend to user
-		if err := tx.Exec("INSERT INTO user_friends (user_id, friend_id) VALUES (?, ?)", userID, friendID).Error; err != nil {
-			return fmt.Errorf("error adding friend to user: %w", err)
-		}
+	if err := tx.First(&friend, "id = ?", friendID).Error; err != nil {
+		return fmt.Errorf("error finding friend: %w", err)
+	}
 
-		// Add user to friend (for bidirectional friendship)
-		if err := tx.Exec("INSERT INTO user_friends (user_id, friend_id) VALUES (?, ?)", friendID, userID).Error; err != nil {
-			return fmt.Errorf("error adding user to friend: %w", err)
-		}
+	// Add friend to user
+	if err := tx.Exec("INSERT INTO user_friends (user_id, friend_id) VALUES (?, ?)", userID, friendID).Error; err != nil {
+		return fmt.Errorf("error adding friend to user: %w", err)
+	}
 
-		log.Printf("Successfully added friendship between %s and %s", userID, friendID)
-		return nil
-	})
+	// Add user to friend (for bidirectional friendship)
+	if err := tx.Exec("INSERT INTO user_friends (user_id, friend_id) VALUES (?, ?)", friendID, userID).Error; err != nil {
+		return fmt.Errorf("error adding user to friend: %w", err)
+	}
+
+	if err := recordFriendshipEvent(tx, models.FriendshipAdded, userID, friendID); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully added friendship between %s and %s", userID, friendID)
+	return nil
 }
 
 func (r *userRepo) GetFriends(userID string) ([]models.User, error) {
@@ -132,6 +212,32 @@ func (r *userRepo) GetFriends(userID string) ([]models.User, error) {
 	return friends, nil
 }
 
+// GetFriendsPage returns a page of the user's friends, ordered by username,
+// and the number of friends.
+func (r *userRepo) GetFriendsPage(userID string, offset, limit int) ([]models.User, int64, error) {
+	var friends []models.User
+	var total int64
+	query := r.db.Model(&models.User{}).
+		Joins("JOIN user_friends ON user_friends.friend_id = users.id").
+		Where("user_friends.user_id = ?", userID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("error counting friends: %w", err)
+	}
+	if err := query.Order("users.username").Offset(offset).Limit(limit).Find(&friends).Error; err != nil {
+		return nil, 0, fmt.Errorf("error retrieving friends: %w", err)
+	}
+	return friends, total, nil
+}
+
+func (r *userRepo) AreFriends(userID, friendID string) (bool, error) {
+	var count int64
+	err := r.db.Table("user_friends").Where("user_id = ? AND friend_id = ?", userID, friendID).Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("error checking friendship: %w", err)
+	}
+	return count > 0, nil
+}
+
 func (r *userRepo) GetFriendshipRecords() ([]struct {
 	UserID   string
 	FriendID string
@@ -146,3 +252,12 @@ func (r *userRepo) GetFriendshipRecords() ([]struct {
 	}
 	return friendships, nil
 }
+
+// recordFriendshipEvent adds a change to the outbox inside its transaction.
+func recordFriendshipEvent(tx *gorm.DB, eventType, userID, friendID string) error {
+	event := models.FriendshipEvent{Type: eventType, UserID: userID, FriendID: friendID}
+	if err := tx.Create(&event).Error; err != nil {
+		return fmt.Errorf("error recording friendship event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"matching-service/api-server/internal/auth"
+	"matching-service/api-server/internal/mail"
+	"matching-service/api-server/internal/models"
+	"matching-service/api-server/internal/repository"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidActionToken   = errors.New("invalid, used or expired link")
+	ErrEmailAlreadyVerified = errors.New("email address already verified")
+	ErrEmailNotVerified     = errors.New("email address not verified")
+)
+
+const (
+	EmailVerificationTTL = 24 * time.Hour
+	PasswordResetTTL     = time.Hour
+)
+
+// LoadBaseURL reads APP_BASE_URL, where the links sent by email point to.
+func LoadBaseURL() string {
+	if baseURL := os.Getenv("APP_BASE_URL"); baseURL != "" {
+		return baseURL
+	}
+	return "http://localhost:8080"
+}
+
+// AccountService mails single-use links to verify an email address and to
+// reset a forgotten password.
+type AccountService interface {
+	SendVerification(ctx context.Context, user *models.User) error
+	VerifyEmail(token string) error
+	// RequestPasswordReset mails a reset link if a user has the email
+	// address. Whether one has is not revealed.
+	RequestPasswordReset(ctx context.Context, email string) error
+	// ResetPassword sets a new password and logs the user out everywhere.
+	ResetPassword(token, password string) error
+}
+
+type accountService struct {
+	userRepo    repository.UserRepository
+	actionRepo  repository.ActionTokenRepository
+	refreshRepo repository.RefreshTokenRepository
+	keys        *auth.KeySet
+	denyList    auth.DenyList
+	mailer      mail.Mailer
+	baseURL     string
+}
+
+func NewAccountService(userRepo repository.UserRepository, actionRepo repository.ActionTokenRepository, refreshRepo repository.RefreshTokenRepository, keys *auth.KeySet, denyList auth.DenyList, mailer mail.Mailer, baseURL string) AccountService {
+	return &accountService{userRepo: userRepo, actionRepo: actionRepo, refreshRepo: refreshRepo, keys: keys, denyList: denyList, mailer: mailer, baseURL: baseURL}
+}
+
+func (s *accountService) SendVerification(ctx context.Context, user *models.User) error {
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+	link, err := s.link(user, auth.PurposeEmailVerification, EmailVerificationTTL, "/verify-email")
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening this link within 24 hours:\n\n%s\n\n"+
+			"If you did not create an account, you can ignore this email.\n", user.Username, link),
+	})
+}
+
+func (s *accountService) VerifyEmail(token string) error {
+	userID, err := s.use(token, auth.PurposeEmailVerification)
+	if err != nil {
+		return err
+	}
+	return s.userRepo.MarkEmailVerified(userID)
+}
+
+func (s *accountService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		log.Printf("Password reset requested for unknown email")
+		return nil
+	}
+	link, err := s.link(user, auth.PurposePasswordReset, PasswordResetTTL, "/reset-password")
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nChoose a new password by opening this link within an hour:\n\n%s\n\n"+
+			"If you did not ask to reset your password, you can ignore this email.\n", user.Username, link),
+	})
+}
+
+func (s *accountService) ResetPassword(token, password string) error {
+	userID, err := s.use(token, auth.PurposePasswordReset)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.SetPassword(userID, string(hashedPassword)); err != nil {
+		return err
+	}
+
+	// Other reset links and every session die with the old password,
+	// access tokens included. The link also proved the user reads the
+	// mailbox.
+	if err := s.actionRepo.UseAll(userID, auth.PurposePasswordReset); err != nil {
+		return err
+	}
+	revoked, err := s.refreshRepo.RevokeUser(userID)
+	if err != nil {
+		return err
+	}
+	if err := revokeAccessTokens(context.Background(), s.denyList, revoked); err != nil {
+		return err
+	}
+	return s.userRepo.MarkEmailVerified(userID)
+}
+
+// link issues an action token for the user and returns the link to path
+// carrying it.
+func (s *accountService) link(user *models.User, purpose string, ttl time.Duration, path string) (string, error) {
+	token, claims, err := s.keys.GenerateActionToken(user.ID, purpose, ttl)
+	if err != nil {
+		return "", err
+	}
+	record := &models.ActionToken{ID: claims.ID, UserID: user.ID, Purpose: purpose, ExpiresAt: claims.ExpiresAt.Time}
+	if err := s.actionRepo.Create(record); err != nil {
+		return "", err
+	}
+	return s.baseURL + path + "?token=" + url.QueryEscape(token), nil
+}
+
+// use checks an action token and marks it used, returning its user.
+func (s *accountService) use(token, purpose string) (string, error) {
+	claims, err := s.keys.ValidateActionToken(token, purpose)
+	if err != nil {
+		return "", ErrInvalidActionToken
+	}
+	if err := s.actionRepo.Use(claims.ID, purpose); err != nil {
+		if errors.Is(err, repository.ErrActionTokenUsed) {
+			return "", ErrInvalidActionToken
+		}
+		return "", err
+	}
+	return claims.Subject, nil
+}
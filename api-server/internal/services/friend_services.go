@@ -0,0 +1,173 @@
+package services
+
+import (
+	"errors"
+	"matching-service/api-server/internal/models"
+	"matching-service/api-server/internal/repository"
+)
+
+var (
+	ErrUserNotFound            = errors.New("user not found")
+	ErrSelfFriendRequest       = errors.New("cannot send a friend request to yourself")
+	ErrAlreadyFriends          = errors.New("already friends")
+	ErrNotFriends              = errors.New("not friends")
+	ErrFriendRequestExists     = repository.ErrFriendRequestExists
+	ErrFriendRequestNotFound   = errors.New("friend request not found")
+	ErrFriendRequestNotPending = repository.ErrFriendRequestNotPending
+)
+
+// Page sizes of ListFriends and SearchUsers.
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+type FriendService interface {
+	ListFriends(userID string, page, pageSize int) (*models.UserPage, error)
+	RemoveFriend(userID, friendID string) error
+	SearchUsers(query string, page, pageSize int) (*models.UserPage, error)
+	SendRequest(fromUserID, toUserID string) (*models.FriendRequest, error)
+	ListRequests(userID string, incoming bool) ([]models.FriendRequest, error)
+	AcceptRequest(userID, requestID string) error
+	DeclineRequest(userID, requestID string) error
+	CancelRequest(userID, requestID string) error
+}
+
+type friendService struct {
+	userRepo    repository.UserRepository
+	requestRepo repository.FriendRequestRepository
+}
+
+func NewFriendService(userRepo repository.UserRepository, requestRepo repository.FriendRequestRepository) FriendService {
+	return &friendService{userRepo: userRepo, requestRepo: requestRepo}
+}
+
+func (s *friendService) ListFriends(userID string, page, pageSize int) (*models.UserPage, error) {
+	page, pageSize = normalizePage(page, pageSize)
+	friends, total, err := s.userRepo.GetFriendsPage(userID, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return userPage(friends, page, pageSize, total), nil
+}
+
+func (s *friendService) RemoveFriend(userID, friendID string) error {
+	friends, err := s.userRepo.AreFriends(userID, friendID)
+	if err != nil {
+		return err
+	}
+	if !friends {
+		return ErrNotFriends
+	}
+	return s.userRepo.RemoveFriend(userID, friendID)
+}
+
+func (s *friendService) SearchUsers(query string, page, pageSize int) (*models.UserPage, error) {
+	page, pageSize = normalizePage(page, pageSize)
+	users, total, err := s.userRepo.SearchByUsername(query, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return userPage(users, page, pageSize, total), nil
+}
+
+func (s *friendService) SendRequest(fromUserID, toUserID string) (*models.FriendRequest, error) {
+	if fromUserID == toUserID {
+		return nil, ErrSelfFriendRequest
+	}
+	recipient, err := s.userRepo.FindByID(toUserID)
+	if err != nil {
+		return nil, err
+	}
+	if recipient == nil {
+		return nil, ErrUserNotFound
+	}
+
+	friends, err := s.userRepo.AreFriends(fromUserID, toUserID)
+	if err != nil {
+		return nil, err
+	}
+	if friends {
+		return nil, ErrAlreadyFriends
+	}
+	existing, err := s.requestRepo.FindPendingBetween(fromUserID, toUserID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrFriendRequestExists
+	}
+
+	request := &models.FriendRequest{FromUserID: fromUserID, ToUserID: toUserID}
+	if err := s.requestRepo.Create(request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func (s *friendService) ListRequests(userID string, incoming bool) ([]models.FriendRequest, error) {
+	return s.requestRepo.ListPending(userID, incoming)
+}
+
+// AcceptRequest and DeclineRequest are for the recipient, CancelRequest
+// for the sender. A request of someone else is reported as not found.
+func (s *friendService) AcceptRequest(userID, requestID string) error {
+	request, err := s.findRequest(requestID, func(r *models.FriendRequest) bool { return r.ToUserID == userID })
+	if err != nil {
+		return err
+	}
+	return s.requestRepo.Accept(request)
+}
+
+func (s *friendService) DeclineRequest(userID, requestID string) error {
+	request, err := s.findRequest(requestID, func(r *models.FriendRequest) bool { return r.ToUserID == userID })
+	if err != nil {
+		return err
+	}
+	return s.requestRepo.SetStatus(request, models.FriendRequestDeclined)
+}
+
+func (s *friendService) CancelRequest(userID, requestID string) error {
+	request, err := s.findRequest(requestID, func(r *models.FriendRequest) bool { return r.FromUserID == userID })
+	if err != nil {
+		return err
+	}
+	return s.requestRepo.SetStatus(request, models.FriendRequestCancelled)
+}
+
+// findRequest returns the pending request if visible says the user may
+// answer it.
+func (s *friendService) findRequest(requestID string, visible func(*models.FriendRequest) bool) (*models.FriendRequest, error) {
+	request, err := s.requestRepo.FindByID(requestID)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil || !visible(request) {
+		return nil, ErrFriendRequestNotFound
+	}
+	if request.Status != models.FriendRequestPending {
+		return nil, ErrFriendRequestNotPending
+	}
+	return request, nil
+}
+
+func normalizePage(page, pageSize int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = DefaultPageSize
+	}
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+	return page, pageSize
+}
+
+func userPage(users []models.User, page, pageSize int, total int64) *models.UserPage {
+	public := make([]models.PublicUser, len(users))
+	for i, user := range users {
+		public[i] = models.PublicUser{ID: user.ID, Username: user.Username}
+	}
+	return &models.UserPage{Users: public, Page: page, PageSize: pageSize, Total: total}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"matching-service/api-server/internal/auth"
+	"matching-service/api-server/internal/models"
+	"matching-service/api-server/internal/repository"
+	"time"
+)
+
+// ErrTooManyAttempts is returned, as a *LockedError, while the username or
+// the client address of a login is locked out.
+var ErrTooManyAttempts = errors.New("too many failed login attempts, try again later")
+
+// LockedError tells how long to wait before logging in again.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+// Login attempt policies. A client address gets more free attempts than a
+// username, as users behind a NAT share it.
+var (
+	UsernameAttemptPolicy = auth.AttemptPolicy{FreeAttempts: 5, BaseDelay: 30 * time.Second, MaxDelay: 15 * time.Minute, Window: time.Hour}
+	ClientAttemptPolicy   = auth.AttemptPolicy{FreeAttempts: 20, BaseDelay: 30 * time.Second, MaxDelay: 15 * time.Minute, Window: time.Hour}
+)
+
+// LoginThrottle limits failed logins per username and per client address,
+// and records an audit event when either gets locked out and when the
+// lockout reaches its longest delay.
+type LoginThrottle struct {
+	users   auth.AttemptLimiter
+	clients auth.AttemptLimiter
+	audits  repository.AuditRepository
+}
+
+func NewLoginThrottle(users, clients auth.AttemptLimiter, audits repository.AuditRepository) *LoginThrottle {
+	return &LoginThrottle{users: users, clients: clients, audits: audits}
+}
+
+// Check returns a *LockedError while the username or the client is locked.
+// Logins are let through when the counters cannot be read.
+func (t *LoginThrottle) Check(ctx context.Context, username, clientIP string) error {
+	var retryAfter time.Duration
+	for _, limit := range []struct {
+		limiter auth.AttemptLimiter
+		key     string
+	}{{t.users, username}, {t.clients, clientIP}} {
+		wait, err := limit.limiter.Wait(ctx, limit.key)
+		if err != nil {
+			log.Printf("Could not check login attempts: %v", err)
+			continue
+		}
+		retryAfter = max(retryAfter, wait)
+	}
+	if retryAfter > 0 {
+		return &LockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Failed counts a failed login against the username and the client.
+func (t *LoginThrottle) Failed(ctx context.Context, username, clientIP string) {
+	if result, err := t.users.Fail(ctx, username); err != nil {
+		log.Printf("Could not count login attempt: %v", err)
+	} else {
+		t.audit(result, models.AuditUsernameLocked, models.AuditUsernameMaxLocked, username, clientIP)
+	}
+	if result, err := t.clients.Fail(ctx, clientIP); err != nil {
+		log.Printf("Could not count login attempt: %v", err)
+	} else {
+		t.audit(result, models.AuditClientLocked, models.AuditClientMaxLocked, username, clientIP)
+	}
+}
+
+// audit records the lockout a failure started or took to the longest delay.
+func (t *LoginThrottle) audit(result auth.AttemptResult, started, maxed, username, clientIP string) {
+	if result.LockStarted {
+		t.record(started, username, clientIP, result)
+	}
+	if result.MaxLocked {
+		t.record(maxed, username, clientIP, result)
+	}
+}
+
+// Succeeded clears the failures of the username. The client's are kept, so
+// that logging in to an own account does not reset a guessing client.
+func (t *LoginThrottle) Succeeded(ctx context.Context, username string) {
+	if err := t.users.Reset(ctx, username); err != nil {
+		log.Printf("Could not reset login attempts: %v", err)
+	}
+}
+
+func (t *LoginThrottle) record(eventType, username, clientIP string, result auth.AttemptResult) {
+	event := &models.AuditEvent{
+		Type:     eventType,
+		Username: username,
+		ClientIP: clientIP,
+		Detail:   fmt.Sprintf("locked for %s after %d failed logins", result.Delay, result.Failures),
+	}
+	log.Printf("AUDIT %s username=%q client=%s: %s", event.Type, event.Username, event.ClientIP, event.Detail)
+	if err := t.audits.Record(event); err != nil {
+		log.Printf("Could not record audit event: %v", err)
+	}
+}
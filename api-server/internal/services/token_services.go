@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"matching-service/api-server/internal/auth"
+	"matching-service/api-server/internal/models"
+	"matching-service/api-server/internal/repository"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, please log in again")
+)
+
+// roleScopes are the scopes access tokens grant for each role. An admin is
+// a user too, so an account with only the admin role keeps its own routes.
+var roleScopes = map[string][]string{
+	models.RoleUser:  {auth.ScopeProfile, auth.ScopeFriends},
+	models.RoleAdmin: {auth.ScopeProfile, auth.ScopeFriends, auth.ScopeAdmin},
+}
+
+// scopesFor returns the scopes of the roles, without duplicates.
+func scopesFor(roles []string) []string {
+	var scopes []string
+	seen := map[string]bool{}
+	for _, role := range roles {
+		for _, scope := range roleScopes[role] {
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes
+}
+
+type TokenService interface {
+	// Issue starts a new token family for a user who just logged in.
+	Issue(user *models.User) (*models.TokenPair, error)
+	// Refresh exchanges a refresh token for a new pair. A refresh token is
+	// valid once: presenting it again means it leaked, and its whole
+	// family is revoked, access tokens included.
+	Refresh(refreshToken string) (*models.TokenPair, error)
+	// Logout revokes the access token and, if given, the family of the
+	// refresh token with its access tokens.
+	Logout(ctx context.Context, claims *auth.Claims, refreshToken string) error
+}
+
+type tokenService struct {
+	userRepo  repository.UserRepository
+	tokenRepo repository.RefreshTokenRepository
+	keys      *auth.KeySet
+	denyList  auth.DenyList
+}
+
+func NewTokenService(userRepo repository.UserRepository, tokenRepo repository.RefreshTokenRepository, keys *auth.KeySet, denyList auth.DenyList) TokenService {
+	return &tokenService{userRepo: userRepo, tokenRepo: tokenRepo, keys: keys, denyList: denyList}
+}
+
+func (s *tokenService) Issue(user *models.User) (*models.TokenPair, error) {
+	return s.issue(user, uuid.New().String(), time.Now().Add(auth.RefreshTokenTTL))
+}
+
+func (s *tokenService) Refresh(refreshToken string) (*models.TokenPair, error) {
+	token, err := s.tokenRepo.FindByHash(auth.HashRefreshToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil || token.RevokedAt != nil || !token.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if token.UsedAt != nil {
+		return nil, s.revokeReused(token)
+	}
+	if err := s.tokenRepo.MarkUsed(token); err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenUsed) {
+			return nil, s.revokeReused(token)
+		}
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	return s.issue(user, token.FamilyID, token.ExpiresAt)
+}
+
+func (s *tokenService) revokeReused(token *models.RefreshToken) error {
+	log.Printf("Refresh token reuse for user %s, revoking family %s", token.UserID, token.FamilyID)
+	if err := s.revokeFamily(context.Background(), token.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// revokeFamily revokes the refresh tokens of the family and the access
+// tokens issued with them.
+func (s *tokenService) revokeFamily(ctx context.Context, familyID string) error {
+	revoked, err := s.tokenRepo.RevokeFamily(familyID)
+	if err != nil {
+		return err
+	}
+	return revokeAccessTokens(ctx, s.denyList, revoked)
+}
+
+// revokeAccessTokens puts the access tokens issued with the refresh tokens
+// on the deny-list, unless they have expired already.
+func revokeAccessTokens(ctx context.Context, denyList auth.DenyList, tokens []models.RefreshToken) error {
+	now := time.Now()
+	for _, token := range tokens {
+		expiresAt := token.CreatedAt.Add(auth.AccessTokenTTL)
+		if token.AccessTokenID == "" || !expiresAt.After(now) {
+			continue
+		}
+		if err := denyList.Revoke(ctx, token.AccessTokenID, expiresAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *tokenService) Logout(ctx context.Context, claims *auth.Claims, refreshToken string) error {
+	if err := s.denyList.Revoke(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+	if refreshToken == "" {
+		return nil
+	}
+	token, err := s.tokenRepo.FindByHash(auth.HashRefreshToken(refreshToken))
+	if err != nil {
+		return err
+	}
+	// Someone else's refresh token is ignored rather than revoked
+	if token == nil || token.UserID != claims.Subject {
+		return nil
+	}
+	return s.revokeFamily(ctx, token.FamilyID)
+}
+
+// issue creates an access token and a refresh token in the family.
+func (s *tokenService) issue(user *models.User, familyID string, expiresAt time.Time) (*models.TokenPair, error) {
+	roles := user.RoleList()
+	accessToken, claims, err := s.keys.NewAccessToken(user.ID, user.Username, roles, scopesFor(roles))
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	record := &models.RefreshToken{FamilyID: familyID, UserID: user.ID, TokenHash: hash, AccessTokenID: claims.ID, ExpiresAt: expiresAt}
+	if err := s.tokenRepo.Create(record); err != nil {
+		return nil, err
+	}
+
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.AccessTokenTTL / time.Second),
+		Token:        accessToken,
+	}, nil
+}
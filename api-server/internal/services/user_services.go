@@ -1,26 +1,56 @@
 package services
 
 import (
+	"context"
 	"errors"
-	"matching-service/api-server/internal/auth"
+	"fmt"
+	"log"
 	"matching-service/api-server/internal/models"
 	"matching-service/api-server/internal/repository"
+	"slices"
+	"sync"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrUnknownRole        = errors.New("unknown role")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// dummyHash is compared against for unknown usernames, so that they take
+// as long to refuse as a wrong password.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
 type UserService interface {
 	Register(user *models.User) error
-	Login(username, password string) (string, error)
+	// Login fails with ErrInvalidCredentials, or a *LockedError after too
+	// many failures for the username or the client address.
+	Login(username, password, clientIP string) (*models.TokenPair, error)
 	GetUserByUsername(username string) (*models.User, error)
+	GetUserByID(userID string) (*models.User, error)
+	// SetRoles replaces the user's roles. Access tokens already issued keep
+	// the old roles until they expire.
+	SetRoles(userID string, roles []string) (*models.UserRoles, error)
 }
 
 type userService struct {
 	userRepo repository.UserRepository
+	tokens   TokenService
+	accounts AccountService
+	throttle *LoginThrottle
+	// requireVerifiedEmail refuses logins until the email is verified
+	requireVerifiedEmail bool
 }
 
-func NewUserService(userRepo repository.UserRepository) UserService {
-	return &userService{userRepo: userRepo}
+func NewUserService(userRepo repository.UserRepository, tokens TokenService, accounts AccountService, throttle *LoginThrottle, requireVerifiedEmail bool) UserService {
+	return &userService{userRepo: userRepo, tokens: tokens, accounts: accounts, throttle: throttle, requireVerifiedEmail: requireVerifiedEmail}
 }
 
 func (s *userService) Register(user *models.User) error {
@@ -38,33 +68,80 @@ func (s *userService) Register(user *models.User) error {
 	user.Password = string(hashedPassword)
 
 	// Create the user
-	return s.userRepo.CreateUser(user)
+	if err := s.userRepo.CreateUser(user); err != nil {
+		return err
+	}
+
+	// The user can ask for another link if this one is lost
+	if err := s.accounts.SendVerification(context.Background(), user); err != nil {
+		log.Printf("Could not send the verification email of user %s: %v", user.ID, err)
+	}
+	return nil
 }
 
-func (s *userService) Login(username, password string) (string, error) {
+func (s *userService) Login(username, password, clientIP string) (*models.TokenPair, error) {
+	ctx := context.Background()
+	if err := s.throttle.Check(ctx, username, clientIP); err != nil {
+		return nil, err
+	}
+
+	// A failed lookup is refused and counted like a wrong password, so that
+	// it tells nothing about the username
 	user, err := s.userRepo.FindByUsername(username)
 	if err != nil {
-		return "", err
-	}
-	if user == nil {
-		return "", errors.New("invalid credentials")
+		log.Printf("Could not look up user %q to log in: %v", username, err)
+		user = nil
 	}
 
-	// Compare password
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	if err != nil {
-		return "", errors.New("invalid credentials")
+	// Compare password, against the dummy hash for unknown users
+	hash := dummyHash()
+	if user != nil {
+		hash = []byte(user.Password)
+	}
+	err = bcrypt.CompareHashAndPassword(hash, []byte(password))
+	if err != nil || user == nil {
+		s.throttle.Failed(ctx, username, clientIP)
+		return nil, ErrInvalidCredentials
 	}
+	s.throttle.Succeeded(ctx, username)
 
-	// Generate JWT token
-	token, err := auth.GenerateToken(user.Username)
-	if err != nil {
-		return "", err
+	if s.requireVerifiedEmail && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
 	}
 
-	return token, nil
+	// Issue an access token and start a refresh token family
+	return s.tokens.Issue(user)
 }
 
 func (s *userService) GetUserByUsername(username string) (*models.User, error) {
 	return s.userRepo.FindByUsername(username)
 }
+
+func (s *userService) GetUserByID(userID string) (*models.User, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *userService) SetRoles(userID string, roles []string) (*models.UserRoles, error) {
+	for _, role := range roles {
+		if !slices.Contains(models.KnownRoles, role) {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownRole, role)
+		}
+	}
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles = slices.Compact(slices.Sorted(slices.Values(roles)))
+	if err := s.userRepo.SetRoles(user.ID, roles); err != nil {
+		return nil, err
+	}
+	return &models.UserRoles{ID: user.ID, Username: user.Username, Roles: roles}, nil
+}
@@ -41,7 +41,7 @@ func InitDB() {
 	log.Println("Successfully connected to the database!")
 
 	// Auto-migrate schema
-	err = db.AutoMigrate(&models.User{})
+	err = db.AutoMigrate(&models.User{}, &models.FriendRequest{}, &models.FriendshipEvent{}, &models.RefreshToken{}, &models.ActionToken{}, &models.AuditEvent{})
 	if err != nil {
 		log.Fatalf("Could not migrate database schema: %v", err)
 	}
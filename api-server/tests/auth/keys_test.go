@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"matching-service/api-server/internal/auth"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func pemKey(t *testing.T, blockType string, der []byte, err error) []byte {
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func parseKey(t *testing.T, id string, data []byte) *auth.SigningKey {
+	key, err := auth.ParseKey(id, data)
+	if err != nil {
+		t.Fatalf("Failed to parse key %s: %v", id, err)
+	}
+	return key
+}
+
+func TestParseKeyAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+	rsaDER, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	rsaPEM := pemKey(t, "PRIVATE KEY", rsaDER, err)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	edPEM := pemKey(t, "PRIVATE KEY", edDER, err)
+
+	for id, data := range map[string][]byte{
+		"HS256": []byte("0123456789abcdef0123456789abcdef\n"),
+		"RS256": rsaPEM,
+		"EdDSA": edPEM,
+	} {
+		key := parseKey(t, id, data)
+		if key.Method.Alg() != id {
+			t.Errorf("Expected %s, got %s", id, key.Method.Alg())
+		}
+		keys, err := auth.NewKeySet(id, key)
+		if err != nil {
+			t.Fatalf("Failed to create key set: %v", err)
+		}
+		token, err := keys.GenerateToken("user-1", "alice", nil, nil)
+		if err != nil {
+			t.Fatalf("%s: failed to sign: %v", id, err)
+		}
+		claims, err := keys.ValidateToken(token)
+		if err != nil || claims.Subject != "user-1" {
+			t.Errorf("%s: expected the token to validate, got %v", id, err)
+		}
+	}
+
+	if _, err := auth.ParseKey("short", []byte("secret")); err == nil {
+		t.Errorf("Expected a short HS256 secret to be rejected")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	_, oldKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, newKey, _ := ed25519.GenerateKey(rand.Reader)
+	oldDER, err := x509.MarshalPKCS8PrivateKey(oldKey)
+	oldPEM := pemKey(t, "PRIVATE KEY", oldDER, err)
+	newDER, err := x509.MarshalPKCS8PrivateKey(newKey)
+	newPEM := pemKey(t, "PRIVATE KEY", newDER, err)
+
+	before, err := auth.NewKeySet("old", parseKey(t, "old", oldPEM))
+	if err != nil {
+		t.Fatalf("Failed to create key set: %v", err)
+	}
+	oldToken, err := before.GenerateToken("user-1", "alice", nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+
+	// The old key is retired to its public half
+	publicDER, err := x509.MarshalPKIXPublicKey(oldKey.Public())
+	retired := parseKey(t, "old", pemKey(t, "PUBLIC KEY", publicDER, err))
+	after, err := auth.NewKeySet("new", retired, parseKey(t, "new", newPEM))
+	if err != nil {
+		t.Fatalf("Failed to create key set: %v", err)
+	}
+	if _, err := auth.NewKeySet("old", retired); err == nil {
+		t.Errorf("Expected a retired key to be refused as the active key")
+	}
+
+	newToken, err := after.GenerateToken("user-1", "alice", nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &auth.Claims{})
+	if err != nil || parsed.Header["kid"] != "new" {
+		t.Errorf("Expected new tokens to name the new key, got %v", parsed.Header["kid"])
+	}
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if _, err := after.ValidateToken(token); err != nil {
+			t.Errorf("Expected the %s token to validate after rotation, got %v", name, err)
+		}
+	}
+	if _, err := before.ValidateToken(newToken); err == nil {
+		t.Errorf("Expected a token of an unknown kid to be rejected")
+	}
+
+	jwks := after.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != "new" || jwks.Keys[1].Kid != "old" {
+		t.Fatalf("Expected both keys to be published, got %+v", jwks.Keys)
+	}
+	if jwks.Keys[1].Kty != "OKP" || jwks.Keys[1].Crv != "Ed25519" || jwks.Keys[1].X == "" {
+		t.Errorf("Unexpected JWK %+v", jwks.Keys[1])
+	}
+}
+
+func TestRejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	keys, err := auth.NewKeySet("rsa", parseKey(t, "rsa", pemKey(t, "PRIVATE KEY", der, err)))
+	if err != nil {
+		t.Fatalf("Failed to create key set: %v", err)
+	}
+	if len(keys.JWKS().Keys) != 1 {
+		t.Fatalf("Expected the RSA key to be published")
+	}
+
+	// An HS256 token keyed with the published public key
+	publicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "user-1"}})
+	forged.Header["kid"] = "rsa"
+	token, err := forged.SignedString(publicDER)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if _, err := keys.ValidateToken(token); err == nil {
+		t.Errorf("Expected an HS256 token to be rejected for an RS256 key")
+	}
+}
+
+func TestIssuerAndAudience(t *testing.T) {
+	key := parseKey(t, "test", []byte("0123456789abcdef0123456789abcdef"))
+	keys, err := auth.NewKeySet("test", key)
+	if err != nil {
+		t.Fatalf("Failed to create key set: %v", err)
+	}
+	token, err := keys.GenerateToken("user-1", "alice", []string{"admin"}, []string{"profile", "admin"})
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	claims, err := keys.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("Expected the token to validate, got %v", err)
+	}
+	if claims.Issuer != auth.DefaultIssuer || claims.IssuedAt == nil || !claims.HasRole("admin") || !claims.HasScope("profile") || claims.HasScope("friends") {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+
+	other, err := auth.NewKeySet("test", key)
+	if err != nil {
+		t.Fatalf("Failed to create key set: %v", err)
+	}
+	other.Audience = "another-service"
+	if _, err := other.ValidateToken(token); err == nil {
+		t.Errorf("Expected a token for another audience to be rejected")
+	}
+	other.Audience, other.Issuer = auth.DefaultAudience, "someone-else"
+	if _, err := other.ValidateToken(token); err == nil {
+		t.Errorf("Expected a token of another issuer to be rejected")
+	}
+}
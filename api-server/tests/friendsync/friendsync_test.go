@@ -0,0 +1,153 @@
+package friendsync
+
+import (
+	"context"
+	"matching-service/api-server/internal/friendsync"
+	"matching-service/api-server/internal/models"
+	"matching-service/api-server/internal/repository"
+	"sort"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// memoryStore is a FriendStore in a map.
+type memoryStore struct {
+	friends map[string]map[string]bool
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{friends: map[string]map[string]bool{}}
+}
+
+func (s *memoryStore) AddFriend(ctx context.Context, userID, friendID string) error {
+	if s.friends[userID] == nil {
+		s.friends[userID] = map[string]bool{}
+	}
+	s.friends[userID][friendID] = true
+	return nil
+}
+
+func (s *memoryStore) RemoveFriend(ctx context.Context, userID, friendID string) error {
+	delete(s.friends[userID], friendID)
+	if len(s.friends[userID]) == 0 {
+		delete(s.friends, userID)
+	}
+	return nil
+}
+
+func (s *memoryStore) Friends(ctx context.Context, userID string) ([]string, error) {
+	friends := []string{}
+	for friendID := range s.friends[userID] {
+		friends = append(friends, friendID)
+	}
+	sort.Strings(friends)
+	return friends, nil
+}
+
+func (s *memoryStore) Users(ctx context.Context) ([]string, error) {
+	users := []string{}
+	for userID := range s.friends {
+		users = append(users, userID)
+	}
+	return users, nil
+}
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:friendsync?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect database: %v", err)
+	}
+	db.Exec("DROP TABLE IF EXISTS friendship_events")
+	db.Exec("DROP TABLE IF EXISTS user_friends")
+	db.Exec("DROP TABLE IF EXISTS users")
+	if err := db.AutoMigrate(&models.User{}, &models.FriendshipEvent{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+	return db
+}
+
+func createUsers(t *testing.T, userRepo repository.UserRepository, names ...string) []string {
+	ids := make([]string, len(names))
+	for i, name := range names {
+		user := &models.User{Username: name, Email: name + "@example.com"}
+		if err := userRepo.CreateUser(user); err != nil {
+			t.Fatalf("Error creating user %s: %v", name, err)
+		}
+		ids[i] = user.ID
+	}
+	return ids
+}
+
+func TestRelayAppliesOutboxInOrder(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepo(db)
+	outbox := repository.NewOutboxRepo(db)
+	ids := createUsers(t, userRepo, "alice", "bob", "carol")
+	alice, bob, carol := ids[0], ids[1], ids[2]
+
+	if err := userRepo.AddFriend(alice, bob); err != nil {
+		t.Fatalf("Error adding friend: %v", err)
+	}
+	if err := userRepo.AddFriend(alice, carol); err != nil {
+		t.Fatalf("Error adding friend: %v", err)
+	}
+	if err := userRepo.RemoveFriend(alice, bob); err != nil {
+		t.Fatalf("Error removing friend: %v", err)
+	}
+
+	store := newMemoryStore()
+	relay := friendsync.NewRelay(outbox, store, 2)
+	relayed, err := relay.RelayPending(context.Background())
+	if err != nil || relayed != 3 {
+		t.Fatalf("Expected 3 events relayed, got %d (%v)", relayed, err)
+	}
+	if friends, _ := store.Friends(context.Background(), alice); len(friends) != 1 || friends[0] != carol {
+		t.Errorf("Expected alice's only friend to be carol, got %v", friends)
+	}
+	if friends, _ := store.Friends(context.Background(), bob); len(friends) != 0 {
+		t.Errorf("Expected bob to have no friends, got %v", friends)
+	}
+
+	if pending, _ := outbox.PendingFriendshipEvents(10); len(pending) != 0 {
+		t.Errorf("Expected the outbox to be drained, got %d pending events", len(pending))
+	}
+}
+
+func TestReconcileFixesDrift(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepo(db)
+	ids := createUsers(t, userRepo, "alice", "bob", "carol")
+	alice, bob, carol := ids[0], ids[1], ids[2]
+	if err := userRepo.AddFriend(alice, bob); err != nil {
+		t.Fatalf("Error adding friend: %v", err)
+	}
+
+	// Redis lost bob's side and kept a friendship that no longer exists
+	store := newMemoryStore()
+	store.AddFriend(context.Background(), alice, bob)
+	store.AddFriend(context.Background(), carol, alice)
+
+	report, err := friendsync.NewReconciler(userRepo, store).Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("Error reconciling: %v", err)
+	}
+	if report.Added != 1 || report.Removed != 1 {
+		t.Errorf("Expected 1 friend added and 1 removed, got %+v", report)
+	}
+	if friends, _ := store.Friends(context.Background(), bob); len(friends) != 1 || friends[0] != alice {
+		t.Errorf("Expected bob's friend alice to be restored, got %v", friends)
+	}
+	if friends, _ := store.Friends(context.Background(), carol); len(friends) != 0 {
+		t.Errorf("Expected carol's stale friend to be removed, got %v", friends)
+	}
+
+	if report, _ := friendsync.NewReconciler(userRepo, store).Reconcile(context.Background()); report.Added != 0 || report.Removed != 0 {
+		t.Errorf("Expected no drift on a second run, got %+v", report)
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"matching-service/api-server/internal/auth"
+	"matching-service/api-server/internal/handlers"
+	"matching-service/api-server/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// logoutRecorder records the refresh token of each logout.
+type logoutRecorder struct {
+	services.TokenService
+	logouts []string
+}
+
+func (r *logoutRecorder) Logout(ctx context.Context, claims *auth.Claims, refreshToken string) error {
+	r.logouts = append(r.logouts, refreshToken)
+	return nil
+}
+
+func TestLogoutBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tokens := &logoutRecorder{}
+	userHandler := handlers.NewUserHandler(nil, tokens, nil, nil)
+	r := gin.New()
+	r.POST("/logout", func(c *gin.Context) { c.Set("claims", &auth.Claims{}) }, userHandler.Logout)
+
+	tests := []struct {
+		name    string
+		body    string
+		code    int
+		revokes []string
+	}{
+		{name: "no body", body: "", code: http.StatusNoContent, revokes: []string{""}},
+		{name: "no refresh token", body: `{}`, code: http.StatusNoContent, revokes: []string{""}},
+		{name: "refresh token", body: `{"refresh_token":"abc"}`, code: http.StatusNoContent, revokes: []string{"abc"}},
+		{name: "empty refresh token", body: `{"refresh_token":""}`, code: http.StatusBadRequest},
+		{name: "malformed", body: `{"refresh_token":`, code: http.StatusBadRequest},
+		{name: "wrong type", body: `{"refresh_token":42}`, code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		tokens.logouts = nil
+		req := httptest.NewRequest(http.MethodPost, "/logout", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d (%s)", tt.name, tt.code, w.Code, w.Body.String())
+		}
+		if strings.Join(tokens.logouts, ",") != strings.Join(tt.revokes, ",") || len(tokens.logouts) != len(tt.revokes) {
+			t.Errorf("%s: expected logouts %q, got %q", tt.name, tt.revokes, tokens.logouts)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"matching-service/api-server/internal/handlers"
+	"matching-service/api-server/internal/models"
+	"matching-service/api-server/internal/repository"
+	"matching-service/api-server/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type testAPI struct {
+	router *gin.Engine
+	users  repository.UserRepository
+}
+
+// newTestAPI serves the friend routes on SQLite. The caller is whoever the
+// X-User-Id header names, standing in for AuthMiddleware.
+func newTestAPI(t *testing.T) *testAPI {
+	db, err := gorm.Open(sqlite.Open("file:friends?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect database: %v", err)
+	}
+	db.Exec("DROP TABLE IF EXISTS friendship_events")
+	db.Exec("DROP TABLE IF EXISTS friend_requests")
+	db.Exec("DROP TABLE IF EXISTS user_friends")
+	db.Exec("DROP TABLE IF EXISTS users")
+	if err := db.AutoMigrate(&models.User{}, &models.FriendRequest{}, &models.FriendshipEvent{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+
+	userRepo := repository.NewUserRepo(db)
+	friendHandler := handlers.NewFriendHandler(services.NewFriendService(userRepo, repository.NewFriendRequestRepo(db)))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	authorized := r.Group("/api/v1")
+	authorized.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-User-Id")) })
+	authorized.GET("/friends", friendHandler.ListFriends)
+	authorized.DELETE("/friends/:id", friendHandler.RemoveFriend)
+	authorized.GET("/friends/requests", friendHandler.ListFriendRequests)
+	authorized.POST("/friends/requests", friendHandler.SendFriendRequest)
+	authorized.POST("/friends/requests/:id/accept", friendHandler.AcceptFriendRequest)
+	authorized.POST("/friends/requests/:id/decline", friendHandler.DeclineFriendRequest)
+	authorized.DELETE("/friends/requests/:id", friendHandler.CancelFriendRequest)
+	authorized.GET("/users/search", friendHandler.SearchUsers)
+	return &testAPI{router: r, users: userRepo}
+}
+
+func (a *testAPI) createUser(t *testing.T, username string) string {
+	user := &models.User{Username: username, Email: username + "@example.com"}
+	if err := a.users.CreateUser(user); err != nil {
+		t.Fatalf("Error creating user %s: %v", username, err)
+	}
+	return user.ID
+}
+
+func (a *testAPI) do(t *testing.T, userID, method, path string, body interface{}, out interface{}) int {
+	var payload bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&payload).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("X-User-Id", userID)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, req)
+	if out != nil && w.Code < 300 {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: malformed response %s", method, path, w.Body.String())
+		}
+	}
+	return w.Code
+}
+
+func TestFriendRequestLifecycle(t *testing.T) {
+	api := newTestAPI(t)
+	alice, bob := api.createUser(t, "alice"), api.createUser(t, "bob")
+
+	var request models.FriendRequest
+	if code := api.do(t, alice, http.MethodPost, "/api/v1/friends/requests", models.FriendRequestInput{UserID: bob}, &request); code != http.StatusCreated {
+		t.Fatalf("Expected 201 for a new request, got %d", code)
+	}
+	if code := api.do(t, bob, http.MethodPost, "/api/v1/friends/requests", models.FriendRequestInput{UserID: alice}, nil); code != http.StatusConflict {
+		t.Errorf("Expected 409 for a request in the other direction, got %d", code)
+	}
+
+	// Nothing changes until bob accepts
+	var page models.UserPage
+	api.do(t, alice, http.MethodGet, "/api/v1/friends", nil, &page)
+	if page.Total != 0 {
+		t.Errorf("Expected no friends while the request is pending, got %+v", page)
+	}
+	var incoming []models.FriendRequest
+	api.do(t, bob, http.MethodGet, "/api/v1/friends/requests?direction=incoming", nil, &incoming)
+	if len(incoming) != 1 || incoming[0].ID != request.ID {
+		t.Errorf("Expected bob to see the request, got %+v", incoming)
+	}
+
+	if code := api.do(t, alice, http.MethodPost, "/api/v1/friends/requests/"+request.ID+"/accept", nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 when the sender accepts, got %d", code)
+	}
+	if code := api.do(t, bob, http.MethodPost, "/api/v1/friends/requests/"+request.ID+"/accept", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("Expected 204 when bob accepts, got %d", code)
+	}
+	if code := api.do(t, bob, http.MethodPost, "/api/v1/friends/requests/"+request.ID+"/decline", nil, nil); code != http.StatusConflict {
+		t.Errorf("Expected 409 for an answered request, got %d", code)
+	}
+
+	api.do(t, bob, http.MethodGet, "/api/v1/friends", nil, &page)
+	if page.Total != 1 || page.Users[0].ID != alice {
+		t.Errorf("Expected bob's friend to be alice, got %+v", page)
+	}
+	if code := api.do(t, alice, http.MethodPost, "/api/v1/friends/requests", models.FriendRequestInput{UserID: bob}, nil); code != http.StatusConflict {
+		t.Errorf("Expected 409 for a request to a friend, got %d", code)
+	}
+
+	if code := api.do(t, alice, http.MethodDelete, "/api/v1/friends/"+bob, nil, nil); code != http.StatusNoContent {
+		t.Errorf("Expected 204 removing a friend, got %d", code)
+	}
+	if code := api.do(t, alice, http.MethodDelete, "/api/v1/friends/"+bob, nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 removing someone who is not a friend, got %d", code)
+	}
+}
+
+func TestDeclineCancelAndSearch(t *testing.T) {
+	api := newTestAPI(t)
+	alice, bob := api.createUser(t, "alice"), api.createUser(t, "bob")
+	api.createUser(t, "alicia")
+
+	if code := api.do(t, alice, http.MethodPost, "/api/v1/friends/requests", models.FriendRequestInput{UserID: "missing"}, nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown user, got %d", code)
+	}
+
+	var request models.FriendRequest
+	api.do(t, alice, http.MethodPost, "/api/v1/friends/requests", models.FriendRequestInput{UserID: bob}, &request)
+	if code := api.do(t, bob, http.MethodDelete, "/api/v1/friends/requests/"+request.ID, nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 when the recipient cancels, got %d", code)
+	}
+	if code := api.do(t, alice, http.MethodDelete, "/api/v1/friends/requests/"+request.ID, nil, nil); code != http.StatusNoContent {
+		t.Errorf("Expected 204 when the sender cancels, got %d", code)
+	}
+
+	api.do(t, alice, http.MethodPost, "/api/v1/friends/requests", models.FriendRequestInput{UserID: bob}, &request)
+	if code := api.do(t, bob, http.MethodPost, "/api/v1/friends/requests/"+request.ID+"/decline", nil, nil); code != http.StatusNoContent {
+		t.Errorf("Expected 204 when the recipient declines, got %d", code)
+	}
+
+	var page models.UserPage
+	if code := api.do(t, bob, http.MethodGet, "/api/v1/users/search?q=ali&page_size=1", nil, &page); code != http.StatusOK {
+		t.Fatalf("Expected 200 for a search, got %d", code)
+	}
+	if page.Total != 2 || len(page.Users) != 1 || page.Users[0].Username != "alice" {
+		t.Errorf("Expected the first of 2 matches to be alice, got %+v", page)
+	}
+	if code := api.do(t, bob, http.MethodGet, "/api/v1/users/search?q=a_", nil, &page); code != http.StatusOK || page.Total != 0 {
+		t.Errorf("Expected _ to match literally, got %d %+v", code, page)
+	}
+	if code := api.do(t, bob, http.MethodGet, "/api/v1/friends?page=0", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for page 0, got %d", code)
+	}
+}
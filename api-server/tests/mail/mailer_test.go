@@ -0,0 +1,73 @@
+package mail
+
+import (
+	"context"
+	"matching-service/api-server/internal/mail"
+	"net"
+	"testing"
+	"time"
+)
+
+// outbox hands the messages sent to a channel.
+type outbox chan mail.Message
+
+func (o outbox) Send(ctx context.Context, msg mail.Message) error {
+	o <- msg
+	return nil
+}
+
+func TestSMTPMailerHonoursContext(t *testing.T) {
+	// A relay that accepts connections but never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	mailer := mail.NewSMTPMailer(mail.SMTPConfig{Host: host, Port: port, From: "noreply@example.com"})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := mailer.Send(ctx, mail.Message{To: "alice@example.com", Subject: "Hi", Body: "Hi"}); err == nil {
+		t.Fatalf("Expected a silent relay to fail the send")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the send to give up with its context, took %s", elapsed)
+	}
+}
+
+func TestQueueSendsInTheBackground(t *testing.T) {
+	sent := make(outbox, 1)
+	queue := mail.NewQueue(sent, 1, time.Second)
+
+	msg := mail.Message{To: "alice@example.com", Subject: "Hi", Body: "Hi"}
+	if err := queue.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Failed to queue: %v", err)
+	}
+	if err := queue.Send(context.Background(), msg); err != mail.ErrQueueFull {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+	select {
+	case got := <-sent:
+		if got != msg {
+			t.Errorf("Expected %+v, got %+v", msg, got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the queued message to be sent")
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"matching-service/api-server/internal/auth"
+	"matching-service/api-server/internal/middleware"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireRoleAndScope(t *testing.T) {
+	key, err := auth.ParseKey("test", []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+	keys, err := auth.NewKeySet(key.ID, key)
+	if err != nil {
+		t.Fatalf("Failed to create key set: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	authorized := r.Group("/")
+	authorized.Use(middleware.AuthMiddleware(keys, auth.NewMemoryDenyList()))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	authorized.GET("/friends", middleware.RequireScope(auth.ScopeFriends), ok)
+	authorized.GET("/admin", middleware.RequireRole("admin"), ok)
+
+	user, err := keys.GenerateToken("user-1", "alice", []string{"user"}, []string{auth.ScopeFriends})
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	admin, err := keys.GenerateToken("user-2", "bob", []string{"admin"}, []string{auth.ScopeAdmin})
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+
+	tests := []struct {
+		token string
+		path  string
+		code  int
+	}{
+		{user, "/friends", http.StatusOK},
+		{user, "/admin", http.StatusForbidden},
+		{admin, "/friends", http.StatusForbidden},
+		{admin, "/admin", http.StatusOK},
+		{"", "/admin", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("GET %s: expected %d, got %d", tt.path, tt.code, w.Code)
+		}
+	}
+}
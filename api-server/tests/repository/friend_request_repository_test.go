@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"errors"
+	"matching-service/api-server/internal/models"
+	"matching-service/api-server/internal/repository"
+	"testing"
+)
+
+func TestSinglePendingFriendRequest(t *testing.T) {
+	db, cleanup := setupTestDB()
+	defer cleanup()
+	requests := repository.NewFriendRequestRepo(db)
+
+	// A concurrent send passes the service's check too, so only the index
+	// stands between it and a second pending request
+	first := &models.FriendRequest{FromUserID: "alice", ToUserID: "bob"}
+	if err := requests.Create(first); err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	for _, duplicate := range []*models.FriendRequest{
+		{FromUserID: "alice", ToUserID: "bob"},
+		{FromUserID: "bob", ToUserID: "alice"},
+	} {
+		if err := requests.Create(duplicate); !errors.Is(err, repository.ErrFriendRequestExists) {
+			t.Errorf("Expected ErrFriendRequestExists for %s to %s, got %v", duplicate.FromUserID, duplicate.ToUserID, err)
+		}
+	}
+
+	// Answered requests no longer hold the pair
+	if err := requests.SetStatus(first, models.FriendRequestDeclined); err != nil {
+		t.Fatalf("Failed to decline request: %v", err)
+	}
+	if err := requests.Create(&models.FriendRequest{FromUserID: "bob", ToUserID: "alice"}); err != nil {
+		t.Errorf("Expected a new request after the first was declined, got %v", err)
+	}
+}
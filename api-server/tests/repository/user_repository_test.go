@@ -27,10 +27,12 @@ func setupTestDB() (*gorm.DB, func()) {
 	}
 
 	// Drop existing tables
+	db.Exec("DROP TABLE IF EXISTS friendship_events")
+	db.Exec("DROP TABLE IF EXISTS friend_requests")
 	db.Exec("DROP TABLE IF EXISTS user_friends")
 	db.Exec("DROP TABLE IF EXISTS users")
 
-	err = db.AutoMigrate(&models.User{})
+	err = db.AutoMigrate(&models.User{}, &models.FriendRequest{}, &models.FriendshipEvent{})
 	if err != nil {
 		panic("failed to migrate database")
 	}
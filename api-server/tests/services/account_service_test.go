@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"matching-service/api-server/internal/auth"
+	"matching-service/api-server/internal/mail"
+	"matching-service/api-server/internal/models"
+	"matching-service/api-server/internal/repository"
+	"matching-service/api-server/internal/services"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// outbox keeps the messages sent instead of sending them.
+type outbox struct {
+	messages []mail.Message
+}
+
+func (o *outbox) Send(ctx context.Context, msg mail.Message) error {
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`token=(\S+)`)
+
+// lastToken returns the token of the link in the last message.
+func (o *outbox) lastToken(t *testing.T) string {
+	if len(o.messages) == 0 {
+		t.Fatalf("Expected a message to be sent")
+	}
+	match := linkToken.FindStringSubmatch(o.messages[len(o.messages)-1].Body)
+	if match == nil {
+		t.Fatalf("Expected a link in the message")
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatalf("Failed to unescape token: %v", err)
+	}
+	return token
+}
+
+type accountTest struct {
+	users    services.UserService
+	tokens   services.TokenService
+	accounts services.AccountService
+	keys     *auth.KeySet
+	denyList auth.DenyList
+	mailer   *outbox
+}
+
+func setupAccounts(t *testing.T, requireVerifiedEmail bool) *accountTest {
+	db, err := gorm.Open(sqlite.Open("file:accounts?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect database: %v", err)
+	}
+	db.Exec("DROP TABLE IF EXISTS audit_events")
+	db.Exec("DROP TABLE IF EXISTS action_tokens")
+	db.Exec("DROP TABLE IF EXISTS refresh_tokens")
+	db.Exec("DROP TABLE IF EXISTS user_friends")
+	db.Exec("DROP TABLE IF EXISTS users")
+	if err := db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.ActionToken{}, &models.AuditEvent{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+
+	key, err := auth.ParseKey("test", []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+	keys, err := auth.NewKeySet(key.ID, key)
+	if err != nil {
+		t.Fatalf("Failed to create key set: %v", err)
+	}
+	userRepo := repository.NewUserRepo(db)
+	refreshRepo := repository.NewRefreshTokenRepo(db)
+	mailer := &outbox{}
+	denyList := auth.NewMemoryDenyList()
+	tokens := services.NewTokenService(userRepo, refreshRepo, keys, denyList)
+	throttle := services.NewLoginThrottle(
+		auth.NewMemoryAttemptLimiter(services.UsernameAttemptPolicy),
+		auth.NewMemoryAttemptLimiter(services.ClientAttemptPolicy),
+		repository.NewAuditRepo(db),
+	)
+	accounts := services.NewAccountService(userRepo, repository.NewActionTokenRepo(db), refreshRepo, keys, denyList, mailer, "https://example.com")
+	return &accountTest{
+		users:    services.NewUserService(userRepo, tokens, accounts, throttle, requireVerifiedEmail),
+		tokens:   tokens,
+		accounts: accounts,
+		keys:     keys,
+		denyList: denyList,
+		mailer:   mailer,
+	}
+}
+
+func (a *accountTest) register(t *testing.T) {
+	user := &models.User{Username: "alice", Email: "alice@example.com", Password: "secret123"}
+	if err := a.users.Register(user); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	a := setupAccounts(t, true)
+	a.register(t)
+	if len(a.mailer.messages) != 1 || a.mailer.messages[0].To != "alice@example.com" {
+		t.Fatalf("Expected a verification email on registration, got %+v", a.mailer.messages)
+	}
+
+	if _, err := a.users.Login("alice", "secret123", "192.0.2.1"); !errors.Is(err, services.ErrEmailNotVerified) {
+		t.Fatalf("Expected ErrEmailNotVerified, got %v", err)
+	}
+
+	token := a.mailer.lastToken(t)
+	if err := a.accounts.ResetPassword(token, "other"); !errors.Is(err, services.ErrInvalidActionToken) {
+		t.Errorf("Expected a verification token to be refused for a password reset, got %v", err)
+	}
+	if err := a.accounts.VerifyEmail(token); err != nil {
+		t.Fatalf("Failed to verify email: %v", err)
+	}
+	if err := a.accounts.VerifyEmail(token); !errors.Is(err, services.ErrInvalidActionToken) {
+		t.Errorf("Expected the token to work once, got %v", err)
+	}
+	if _, err := a.users.Login("alice", "secret123", "192.0.2.1"); err != nil {
+		t.Errorf("Expected a verified user to log in, got %v", err)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	a := setupAccounts(t, false)
+	a.register(t)
+
+	if err := a.accounts.RequestPasswordReset(context.Background(), "nobody@example.com"); err != nil {
+		t.Fatalf("Expected no error for an unknown address, got %v", err)
+	}
+	if len(a.mailer.messages) != 1 {
+		t.Fatalf("Expected no mail for an unknown address")
+	}
+
+	session, err := a.users.Login("alice", "secret123", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	if err := a.accounts.RequestPasswordReset(context.Background(), "alice@example.com"); err != nil {
+		t.Fatalf("Failed to request a reset: %v", err)
+	}
+	if err := a.accounts.ResetPassword(a.mailer.lastToken(t), "secret456"); err != nil {
+		t.Fatalf("Failed to reset password: %v", err)
+	}
+
+	if _, err := a.users.Login("alice", "secret123", "192.0.2.1"); err == nil {
+		t.Errorf("Expected the old password to be refused")
+	}
+	if _, err := a.users.Login("alice", "secret456", "192.0.2.1"); err != nil {
+		t.Errorf("Expected the new password to work, got %v", err)
+	}
+	if _, err := a.tokens.Refresh(session.RefreshToken); !errors.Is(err, services.ErrInvalidRefreshToken) {
+		t.Errorf("Expected the reset to end earlier sessions, got %v", err)
+	}
+	if _, err := a.keys.ValidateAccessToken(context.Background(), a.denyList, session.AccessToken); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Errorf("Expected the reset to revoke earlier access tokens, got %v", err)
+	}
+	if err := a.accounts.ResetPassword(a.mailer.lastToken(t), "secret789"); !errors.Is(err, services.ErrInvalidActionToken) {
+		t.Errorf("Expected the reset token to work once, got %v", err)
+	}
+}
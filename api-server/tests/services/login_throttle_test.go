@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"matching-service/api-server/internal/auth"
+	"matching-service/api-server/internal/models"
+	"matching-service/api-server/internal/repository"
+	"matching-service/api-server/internal/services"
+	"testing"
+	"time"
+)
+
+// auditLog keeps the events recorded instead of storing them.
+type auditLog struct {
+	events []models.AuditEvent
+}
+
+func (a *auditLog) Record(event *models.AuditEvent) error {
+	a.events = append(a.events, *event)
+	return nil
+}
+
+func TestLoginLockout(t *testing.T) {
+	a := setupAccounts(t, false)
+	a.register(t)
+
+	if _, err := a.users.Login("nobody", "secret123", "192.0.2.1"); !errors.Is(err, services.ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials for an unknown user, got %v", err)
+	}
+	for i := 0; i <= services.UsernameAttemptPolicy.FreeAttempts; i++ {
+		if _, err := a.users.Login("alice", "wrong", "192.0.2.2"); !errors.Is(err, services.ErrInvalidCredentials) {
+			t.Fatalf("Attempt %d: expected ErrInvalidCredentials, got %v", i+1, err)
+		}
+	}
+
+	// The username is locked, whatever the client and the password
+	_, err := a.users.Login("alice", "secret123", "192.0.2.3")
+	var locked *services.LockedError
+	if !errors.As(err, &locked) || !errors.Is(err, services.ErrTooManyAttempts) {
+		t.Fatalf("Expected a LockedError, got %v", err)
+	}
+	if locked.RetryAfter <= 0 || locked.RetryAfter > services.UsernameAttemptPolicy.BaseDelay {
+		t.Errorf("Expected to retry within %s, got %s", services.UsernameAttemptPolicy.BaseDelay, locked.RetryAfter)
+	}
+}
+
+// brokenUsers fails every lookup, like a database that is down.
+type brokenUsers struct {
+	repository.UserRepository
+}
+
+func (brokenUsers) FindByUsername(username string) (*models.User, error) {
+	return nil, errors.New("database is down")
+}
+
+func TestLoginLookupFailure(t *testing.T) {
+	throttle := services.NewLoginThrottle(
+		auth.NewMemoryAttemptLimiter(services.UsernameAttemptPolicy),
+		auth.NewMemoryAttemptLimiter(services.ClientAttemptPolicy),
+		&auditLog{},
+	)
+	users := services.NewUserService(brokenUsers{}, nil, nil, throttle, false)
+
+	for i := 0; i < services.UsernameAttemptPolicy.FreeAttempts; i++ {
+		if _, err := users.Login("alice", "secret123", "192.0.2.1"); !errors.Is(err, services.ErrInvalidCredentials) {
+			t.Fatalf("Attempt %d: expected ErrInvalidCredentials, got %v", i+1, err)
+		}
+	}
+	// Failed lookups are throttled like wrong passwords
+	users.Login("alice", "secret123", "192.0.2.1")
+	if _, err := users.Login("alice", "secret123", "192.0.2.1"); !errors.Is(err, services.ErrTooManyAttempts) {
+		t.Errorf("Expected the username to be locked, got %v", err)
+	}
+}
+
+func TestLoginThrottleRecordsLockouts(t *testing.T) {
+	policy := auth.AttemptPolicy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: 4 * time.Minute, Window: time.Hour}
+	for failures, want := range map[int]time.Duration{2: 0, 3: time.Minute, 4: 2 * time.Minute, 5: 4 * time.Minute, 10: 4 * time.Minute} {
+		if got := policy.Delay(failures); got != want {
+			t.Errorf("Delay(%d): expected %s, got %s", failures, want, got)
+		}
+	}
+
+	ctx := context.Background()
+	audit := &auditLog{}
+	users := auth.NewMemoryAttemptLimiter(policy)
+	throttle := services.NewLoginThrottle(users, auth.NewMemoryAttemptLimiter(auth.AttemptPolicy{FreeAttempts: 100, Window: time.Hour}), audit)
+	fail := func(times int) {
+		for i := 0; i < times; i++ {
+			throttle.Failed(ctx, "alice", "192.0.2.1")
+		}
+	}
+	fail(2)
+	if len(audit.events) != 0 {
+		t.Fatalf("Expected no lockout within the free attempts, got %+v", audit.events)
+	}
+	fail(1)
+	if len(audit.events) != 1 || audit.events[0].Type != models.AuditUsernameLocked || audit.events[0].Username != "alice" || audit.events[0].ClientIP != "192.0.2.1" {
+		t.Fatalf("Expected the first lock to be recorded, got %+v", audit.events)
+	}
+	fail(1)
+	if len(audit.events) != 1 {
+		t.Fatalf("Expected a longer lock not to be recorded again, got %+v", audit.events)
+	}
+	fail(1)
+	if len(audit.events) != 2 || audit.events[1].Type != models.AuditUsernameMaxLocked {
+		t.Fatalf("Expected the maximum lock to be recorded, got %+v", audit.events)
+	}
+
+	if err := throttle.Check(ctx, "bob", "192.0.2.1"); err != nil {
+		t.Errorf("Expected other usernames to be let through, got %v", err)
+	}
+	throttle.Succeeded(ctx, "alice")
+	if wait, _ := users.Wait(ctx, "alice"); wait != 0 {
+		t.Errorf("Expected a success to clear the lock, got %s", wait)
+	}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"matching-service/api-server/internal/auth"
+	"matching-service/api-server/internal/models"
+	"matching-service/api-server/internal/repository"
+	"matching-service/api-server/internal/services"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTokenService(t *testing.T) (services.TokenService, *auth.KeySet, auth.DenyList, *models.User) {
+	db, err := gorm.Open(sqlite.Open("file:tokens?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect database: %v", err)
+	}
+	db.Exec("DROP TABLE IF EXISTS refresh_tokens")
+	db.Exec("DROP TABLE IF EXISTS user_friends")
+	db.Exec("DROP TABLE IF EXISTS users")
+	if err := db.AutoMigrate(&models.User{}, &models.RefreshToken{}); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+
+	userRepo := repository.NewUserRepo(db)
+	user := &models.User{Username: "alice", Email: "alice@example.com"}
+	if err := userRepo.CreateUser(user); err != nil {
+		t.Fatalf("Error creating user: %v", err)
+	}
+	key, err := auth.ParseKey("test", []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+	keys, err := auth.NewKeySet(key.ID, key)
+	if err != nil {
+		t.Fatalf("Failed to create key set: %v", err)
+	}
+	denyList := auth.NewMemoryDenyList()
+	return services.NewTokenService(userRepo, repository.NewRefreshTokenRepo(db), keys, denyList), keys, denyList, user
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	tokens, keys, denyList, user := setupTokenService(t)
+
+	issued, err := tokens.Issue(user)
+	if err != nil {
+		t.Fatalf("Failed to issue tokens: %v", err)
+	}
+	refreshed, err := tokens.Refresh(issued.RefreshToken)
+	if err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+	if refreshed.RefreshToken == issued.RefreshToken || refreshed.AccessToken == issued.AccessToken {
+		t.Errorf("Expected a new token pair")
+	}
+
+	// Presenting the used token again revokes the whole family
+	if _, err := tokens.Refresh(issued.RefreshToken); !errors.Is(err, services.ErrRefreshTokenReused) {
+		t.Fatalf("Expected ErrRefreshTokenReused, got %v", err)
+	}
+	if _, err := tokens.Refresh(refreshed.RefreshToken); !errors.Is(err, services.ErrInvalidRefreshToken) {
+		t.Errorf("Expected the successor to be revoked, got %v", err)
+	}
+	// with every access token issued from the family
+	for _, accessToken := range []string{issued.AccessToken, refreshed.AccessToken} {
+		if _, err := keys.ValidateAccessToken(context.Background(), denyList, accessToken); !errors.Is(err, auth.ErrRevokedToken) {
+			t.Errorf("Expected the family's access tokens to be revoked, got %v", err)
+		}
+	}
+
+	if _, err := tokens.Refresh("unknown"); !errors.Is(err, services.ErrInvalidRefreshToken) {
+		t.Errorf("Expected ErrInvalidRefreshToken, got %v", err)
+	}
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	tokens, keys, denyList, user := setupTokenService(t)
+	ctx := context.Background()
+
+	issued, err := tokens.Issue(user)
+	if err != nil {
+		t.Fatalf("Failed to issue tokens: %v", err)
+	}
+	claims, err := keys.ValidateAccessToken(ctx, denyList, issued.AccessToken)
+	if err != nil {
+		t.Fatalf("Expected a valid access token, got %v", err)
+	}
+
+	if err := tokens.Logout(ctx, claims, issued.RefreshToken); err != nil {
+		t.Fatalf("Failed to log out: %v", err)
+	}
+	if _, err := keys.ValidateAccessToken(ctx, denyList, issued.AccessToken); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Errorf("Expected ErrRevokedToken, got %v", err)
+	}
+	if _, err := tokens.Refresh(issued.RefreshToken); !errors.Is(err, services.ErrInvalidRefreshToken) {
+		t.Errorf("Expected the refresh token to be revoked, got %v", err)
+	}
+}
+
+func TestAdminKeepsUserScopes(t *testing.T) {
+	tokens, keys, denyList, user := setupTokenService(t)
+
+	user.Roles = models.RoleAdmin
+	issued, err := tokens.Issue(user)
+	if err != nil {
+		t.Fatalf("Failed to issue tokens: %v", err)
+	}
+	claims, err := keys.ValidateAccessToken(context.Background(), denyList, issued.AccessToken)
+	if err != nil {
+		t.Fatalf("Expected a valid access token, got %v", err)
+	}
+	for _, scope := range []string{auth.ScopeProfile, auth.ScopeFriends, auth.ScopeAdmin} {
+		if !claims.HasScope(scope) {
+			t.Errorf("Expected an admin-only account to have scope %s, got %q", scope, claims.Scope)
+		}
+	}
+}
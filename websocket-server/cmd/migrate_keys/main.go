@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"matching-service/websocket-server/pkg/redis"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+// migrate_keys rewrites Redis data written by older releases into the
+// layout defined by redis.Keys. It is safe to run more than once.
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report what would be migrated without writing")
+	prefix := flag.String("prefix", "", "key prefix of the target layout")
+	flag.Parse()
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+
+	ctx := context.Background()
+	redis.InitClient(ctx, os.Getenv("REDIS_PORT"), os.Getenv("REDIS_HOST"))
+
+	stats, err := redis.MigrateLegacyKeys(ctx, redis.GetClient(), redis.NewKeys(*prefix), *dryRun)
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+
+	log.Printf("Migrated %d positions and %d destinations, deleted %d legacy keys (dry run: %t)",
+		stats.Positions, stats.Destinations, stats.DeletedKeys, *dryRun)
+}
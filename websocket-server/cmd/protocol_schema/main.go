@@ -0,0 +1,26 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"matching-service/websocket-server/internal/protocol"
+	"os"
+)
+
+// protocol_schema writes the AsyncAPI document of the WebSocket protocol,
+// including the JSON Schema of every message. Run it after changing a
+// payload type in internal/protocol.
+func main() {
+	out := flag.String("out", "docs/asyncapi.json", "file to write the document to")
+	flag.Parse()
+
+	data, err := json.MarshalIndent(protocol.AsyncAPI(), "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode document: %v", err)
+	}
+	if err := os.WriteFile(*out, append(data, '\n'), 0o644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *out, err)
+	}
+	log.Printf("Wrote %s", *out)
+}
@@ -2,47 +2,145 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"log"
+	"matching-service/websocket-server/internal/auth"
+	"matching-service/websocket-server/internal/cluster"
+	"matching-service/websocket-server/internal/config"
 	"matching-service/websocket-server/internal/handler"
+	"matching-service/websocket-server/internal/hub"
+	"matching-service/websocket-server/internal/matcher"
 	"matching-service/websocket-server/internal/repository"
+	"matching-service/websocket-server/internal/validation"
 	"matching-service/websocket-server/pkg/database"
 	"matching-service/websocket-server/pkg/redis"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
 func main() {
-	// Load environment variables
+	storage := flag.String("storage", "cassandra", "storage backend: cassandra (with Redis) or memory")
+	flag.Parse()
+	if *storage != "cassandra" && *storage != "memory" {
+		log.Fatalf("Unknown storage %q, expected cassandra or memory", *storage)
+	}
+
+	// Load environment variables; the memory backend needs none of the
+	// database settings, so the file is optional there
 	if err := godotenv.Load(); err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		if *storage != "memory" {
+			log.Fatalf("Error loading .env file: %v", err)
+		}
+		log.Printf("No .env file loaded: %v", err)
+	}
+
+	// Cancelled on SIGINT/SIGTERM; every connection context derives from it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	timeouts := config.LoadTimeouts()
+
+	var locationRepo repository.LocationRepository
+	var redisCache redis.RedisCacheHandler
+	if *storage == "memory" {
+		log.Println("Using in-memory storage, data is lost on restart")
+		locationRepo = repository.NewMemoryLocationRepo()
+		redisCache = redis.NewMemoryCache()
+	} else {
+		// Initialize database
+		keyspace := os.Getenv("CASSANDRA_KEYSPACE")
+		if keyspace == "" {
+			log.Fatalf("CASSANDRA_KEYSPACE environment variable is not set")
+		}
+		database.Init(keyspace)
+		locationRepo = repository.NewLocationRepo(database.GetSession(), keyspace, timeouts)
+
+		// Initialize Redis
+		redisHost := os.Getenv("REDIS_HOST")
+		redisPort := os.Getenv("REDIS_PORT")
+		redis.InitClient(ctx, redisPort, redisHost)
+		redisCache = redis.NewRedisCache(redis.GetClient(), timeouts.Redis)
 	}
 
-	// Initialize database
-	keyspace := os.Getenv("CASSANDRA_KEYSPACE")
-	if keyspace == "" {
-		log.Fatalf("CASSANDRA_KEYSPACE environment variable is not set")
+	// Tokens are checked here, with the api-server's published keys or with
+	// the shared secret
+	var tokenAuthenticator auth.Authenticator
+	if jwksURL := os.Getenv("JWKS_URL"); jwksURL != "" {
+		keys := auth.NewJWKS(jwksURL)
+		if err := keys.Start(ctx, auth.DefaultJWKSRefreshInterval); err != nil {
+			log.Fatalf("Failed to fetch the signing keys: %v", err)
+		}
+		tokenAuthenticator = auth.NewJWKSAuthenticator(keys, auth.LoadAudience(), redisCache)
+	} else {
+		jwtSecret := os.Getenv("JWT_SECRET")
+		if jwtSecret == "" {
+			log.Fatalf("Neither JWKS_URL nor JWT_SECRET environment variable is set")
+		}
+		tokenAuthenticator = auth.NewJWTAuthenticator(jwtSecret, auth.LoadAudience(), redisCache)
 	}
-	database.Init(keyspace)
 
-	// Initialize Redis
-	redisHost := os.Getenv("REDIS_HOST")
-	redisPort := os.Getenv("REDIS_PORT")
-	redis.InitClient(context.Background(), redisPort, redisHost)
+	// Behind the nginx gateway the token of an upgrade has already been
+	// verified by the api-server. Only the upgrade goes through the gateway,
+	// every other route keeps checking tokens.
+	upgradeAuthenticator := tokenAuthenticator
+	if os.Getenv("TRUST_GATEWAY_HEADERS") == "true" {
+		log.Println("Trusting identity headers from the gateway on WebSocket upgrades")
+		upgradeAuthenticator = auth.NewGatewayAuthenticator()
+	}
+
+	// Create handlers
+	matcherService := matcher.NewMatcherService(locationRepo, redisCache)
+	validator := validation.NewValidator(validation.DefaultLimits)
+	heartbeat := config.LoadHeartbeat()
+	sessions := hub.NewHub(config.LoadMaxSessionsPerUser())
 
-	redisClient := redis.GetClient()
-	redisCache := redis.NewRedisCache(context.Background(), redisClient)
+	// Routes messages to users connected to the other nodes behind nginx
+	router := cluster.NewRouter(config.LoadNodeID(), sessions, redisCache, heartbeat.PresenceTTL)
+	if err := router.Start(ctx); err != nil {
+		log.Fatalf("Failed to join the cluster: %v", err)
+	}
+	log.Printf("Running as node %s", router.NodeID)
 
-	// Create repository and handler
-	cassandraSession := database.GetSession()
-	locationRepo := repository.NewLocationRepo(cassandraSession, keyspace)
-	webSocketHandler := handler.NewWebSocketHandler(locationRepo, redisCache)
+	webSocketHandler := handler.NewWebSocketHandler(locationRepo, redisCache, upgradeAuthenticator, matcherService, validator, heartbeat, config.LoadOutbound(), router)
+	matchHandler := handler.NewMatchHandler(matcherService, tokenAuthenticator)
+	hubHandler := handler.NewHubHandler(router, tokenAuthenticator)
 
 	// Initialize Gin router
 	r := gin.Default()
 	r.GET("/location", webSocketHandler.HandleWebSocket)
+	r.POST("/matches", matchHandler.FindMatches)
+
+	// Session management, for api-server admins
+	admin := r.Group("/", hubHandler.RequireAdmin)
+	admin.GET("/metrics/sessions", hubHandler.Metrics)
+	admin.DELETE("/sessions/:user_id", hubHandler.Kick)
+	admin.DELETE("/sessions/:user_id/:session_id", hubHandler.KickSession)
 
 	// Start the HTTP server
-	r.Run(":8081")
+	srv := &http.Server{
+		Addr:        ":8081",
+		Handler:     r,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP server failed: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server shutdown: %v", err)
+	}
 }
@@ -0,0 +1,49 @@
+// Package apperror defines the machine-readable error codes reported to
+// clients, so they can tell a bad request from a failure worth retrying.
+package apperror
+
+import "fmt"
+
+type Code string
+
+const (
+	// CodeValidation means the request is malformed; retrying it unchanged
+	// will fail again.
+	CodeValidation Code = "validation"
+	// CodeNotFound means the requested user or location does not exist.
+	CodeNotFound Code = "not_found"
+	// CodeStorageUnavailable means Cassandra or Redis failed or timed out;
+	// the request can be retried.
+	CodeStorageUnavailable Code = "storage_unavailable"
+	// CodeUnauthorized means the caller's identity was missing or unusable.
+	CodeUnauthorized Code = "unauthorized"
+)
+
+// Error is an error with a code and a message that is safe to show to the
+// client. Reason optionally narrows the code down, e.g. which validation
+// failed. The underlying cause, if any, is kept for logs and errors.Is.
+type Error struct {
+	Code    Code
+	Reason  string
+	Message string
+	Err     error
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func Wrap(code Code, message string, err error) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// BearerSubprotocol is the Sec-WebSocket-Protocol entry that announces a
+// token in the following entry, for clients (browsers) that cannot set
+// an Authorization header on the upgrade request.
+const BearerSubprotocol = "bearer"
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid or expired token")
+	ErrRevokedToken = errors.New("token has been revoked")
+)
+
+// Claims mirrors the claims issued by api-server/internal/auth. The
+// stable user ID travels in the standard "sub" claim.
+type Claims struct {
+	Username string   `json:"username"`
+	Roles    []string `json:"roles,omitempty"`
+	Scope    string   `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Audience is the issuer and audience tokens must carry, the same the
+// api-server signs them with.
+type Audience struct {
+	Issuer   string
+	Audience string
+}
+
+var DefaultAudience = Audience{Issuer: "matching-service/api-server", Audience: "matching-service"}
+
+// LoadAudience returns DefaultAudience with overrides from JWT_ISSUER and
+// JWT_AUDIENCE.
+func LoadAudience() Audience {
+	audience := DefaultAudience
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		audience.Issuer = issuer
+	}
+	if aud := os.Getenv("JWT_AUDIENCE"); aud != "" {
+		audience.Audience = aud
+	}
+	return audience
+}
+
+// RoleAdmin is the api-server role allowed to manage sessions.
+const RoleAdmin = "admin"
+
+// Identity is the authenticated caller of a WebSocket connection. Roles
+// are only known when the token was checked here.
+type Identity struct {
+	UserID   string
+	Username string
+	Roles    []string
+}
+
+func (i Identity) HasRole(role string) bool {
+	return slices.Contains(i.Roles, role)
+}
+
+type Authenticator interface {
+	Authenticate(r *http.Request) (Identity, error)
+}
+
+// DenyList reports access tokens revoked by the api-server before they
+// expire, by their jti. redis.RedisCacheHandler implements it.
+type DenyList interface {
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+type JWTAuthenticator struct {
+	keyfunc  jwt.Keyfunc
+	audience Audience
+	denyList DenyList
+}
+
+// NewJWTAuthenticator verifies HS256 tokens with the secret shared with
+// the api-server.
+func NewJWTAuthenticator(secret string, audience Audience, denyList DenyList) Authenticator {
+	key := []byte(secret)
+	keyfunc := func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return key, nil
+	}
+	return &JWTAuthenticator{keyfunc: keyfunc, audience: audience, denyList: denyList}
+}
+
+// NewJWKSAuthenticator verifies tokens with the public keys the api-server
+// publishes, so no secret is shared.
+func NewJWKSAuthenticator(keys *JWKS, audience Audience, denyList DenyList) Authenticator {
+	return &JWTAuthenticator{keyfunc: keys.Keyfunc, audience: audience, denyList: denyList}
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (Identity, error) {
+	tokenString := TokenFromRequest(r)
+	if tokenString == "" {
+		return Identity{}, ErrMissingToken
+	}
+
+	claims, err := a.ValidateToken(tokenString)
+	if err != nil {
+		return Identity{}, err
+	}
+	revoked, err := a.denyList.IsTokenRevoked(r.Context(), claims.ID)
+	if err != nil {
+		return Identity{}, fmt.Errorf("could not check token revocation: %w", err)
+	}
+	if revoked {
+		return Identity{}, ErrRevokedToken
+	}
+
+	return Identity{UserID: claims.Subject, Username: claims.Username, Roles: claims.Roles}, nil
+}
+
+func (a *JWTAuthenticator) ValidateToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, a.keyfunc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if !claims.VerifyIssuer(a.audience.Issuer, true) || !claims.VerifyAudience(a.audience.Audience, true) {
+		return nil, fmt.Errorf("%w: wrong issuer or audience", ErrInvalidToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalidToken)
+	}
+	// Tokens without a jti could not be revoked
+	if claims.ID == "" {
+		return nil, fmt.Errorf("%w: token has no jti", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// TokenFromRequest looks for a bearer token in the Authorization header,
+// then in Sec-WebSocket-Protocol ("bearer, <token>"), then in the "token"
+// query parameter.
+func TokenFromRequest(r *http.Request) string {
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		bearerToken := strings.Split(authHeader, " ")
+		if len(bearerToken) == 2 && bearerToken[0] == "Bearer" {
+			return bearerToken[1]
+		}
+	}
+
+	protocols := websocketProtocols(r)
+	for i, protocol := range protocols {
+		if protocol == BearerSubprotocol && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+
+	return r.URL.Query().Get("token")
+}
+
+func websocketProtocols(r *http.Request) []string {
+	var protocols []string
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			if protocol = strings.TrimSpace(protocol); protocol != "" {
+				protocols = append(protocols, protocol)
+			}
+		}
+	}
+	return protocols
+}
@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+)
+
+const (
+	UserIDHeader   = "X-User-Id"
+	UsernameHeader = "X-Username"
+)
+
+var ErrMissingIdentity = errors.New("missing gateway identity headers")
+
+// GatewayAuthenticator trusts the identity headers set by the nginx
+// gateway after its auth_request to the api-server /verify endpoint.
+// Only use it when the server is not reachable except through the gateway.
+type GatewayAuthenticator struct{}
+
+func NewGatewayAuthenticator() Authenticator {
+	return &GatewayAuthenticator{}
+}
+
+func (a *GatewayAuthenticator) Authenticate(r *http.Request) (Identity, error) {
+	userID := r.Header.Get(UserIDHeader)
+	if userID == "" {
+		return Identity{}, ErrMissingIdentity
+	}
+
+	return Identity{UserID: userID, Username: r.Header.Get(UsernameHeader)}, nil
+}
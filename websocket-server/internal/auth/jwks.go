@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// DefaultJWKSRefreshInterval matches how long the api-server lets the key
+// set be cached.
+const DefaultJWKSRefreshInterval = 5 * time.Minute
+
+// minRefetchInterval limits the refetches caused by tokens naming an
+// unknown key, which anyone can send.
+const minRefetchInterval = 10 * time.Second
+
+// jwk mirrors the JSON Web Keys published by api-server/internal/auth.
+type jwk struct {
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+}
+
+type publicKey struct {
+	alg string
+	key interface{}
+}
+
+// JWKS holds the public keys the api-server signs tokens with, fetched from
+// its /.well-known/jwks.json. A token naming a key not seen yet, e.g. right
+// after a rotation, triggers a refetch.
+type JWKS struct {
+	url    string
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]publicKey
+	lastRefetch time.Time
+}
+
+func NewJWKS(url string) *JWKS {
+	return &JWKS{url: url, client: &http.Client{Timeout: 5 * time.Second}, keys: map[string]publicKey{}}
+}
+
+// Start fetches the keys and refreshes them every interval until ctx is
+// done.
+func (k *JWKS) Start(ctx context.Context, interval time.Duration) error {
+	if err := k.Refresh(ctx); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := k.Refresh(ctx); err != nil {
+					log.Printf("Could not refresh JWKS, keeping the current keys: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (k *JWKS) Refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return fmt.Errorf("error fetching JWKS: %w", err)
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error fetching JWKS: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("error decoding JWKS: %w", err)
+	}
+	keys := make(map[string]publicKey, len(set.Keys))
+	for _, key := range set.Keys {
+		parsed, err := key.publicKey()
+		if err != nil {
+			log.Printf("Skipping JWK %s: %v", key.Kid, err)
+			continue
+		}
+		keys[key.Kid] = publicKey{alg: key.Alg, key: parsed}
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+// Keyfunc returns the key named by the token's kid. The token must use the
+// key's algorithm.
+func (k *JWKS) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.lookup(kid)
+	if !ok && k.refetchAllowed() {
+		if err := k.Refresh(context.Background()); err != nil {
+			log.Printf("Could not refetch JWKS for key %q: %v", kid, err)
+		}
+		key, ok = k.lookup(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.alg {
+		return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+	}
+	return key.key, nil
+}
+
+func (k *JWKS) lookup(kid string) (publicKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+func (k *JWKS) refetchAllowed() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if time.Since(k.lastRefetch) < minRefetchInterval {
+		return false
+	}
+	k.lastRefetch = time.Now()
+	return true
+}
+
+func (key jwk) publicKey() (interface{}, error) {
+	switch {
+	case key.Kty == "RSA" && key.Alg == jwt.SigningMethodRS256.Alg():
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case key.Kty == "OKP" && key.Crv == "Ed25519" && key.Alg == jwt.SigningMethodEdDSA.Alg():
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s with algorithm %s", key.Kty, key.Alg)
+	}
+}
@@ -0,0 +1,234 @@
+// Package cluster delivers messages to users connected to other instances of
+// the websocket-server behind the load balancer. Every node subscribes to
+// its own Redis channel and records in a route table which nodes each of
+// its users is connected to; a send for a user is delivered to the local
+// hub and published to the other nodes the user is on.
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"matching-service/websocket-server/internal/hub"
+	"matching-service/websocket-server/internal/protocol"
+	"matching-service/websocket-server/pkg/redis"
+	"time"
+)
+
+// message is what nodes publish to each other: a response for the user, or
+// for one session when SessionID is set, or a kick of the user or of that
+// session when Kick is set. The
+// response travels as a v1 envelope and is re-encoded for each client by
+// its own codec.
+type message struct {
+	UserID    string          `json:"user_id"`
+	SessionID string          `json:"session_id,omitempty"`
+	Key       string          `json:"key,omitempty"`
+	Response  json.RawMessage `json:"response,omitempty"`
+	Kick      bool            `json:"kick,omitempty"`
+	Reason    string          `json:"reason,omitempty"`
+}
+
+// Router is the only way to reach sessions: it delivers to the local hub
+// and publishes to the other nodes the user is connected to.
+type Router struct {
+	NodeID string
+	hub    *hub.Hub
+	cache  redis.RedisCacheHandler
+	ttl    time.Duration
+}
+
+// NewRouter returns the router of the node. Routes are kept for ttl and
+// refreshed every ttl/2, so those of a crashed node expire within ttl.
+func NewRouter(nodeID string, sessions *hub.Hub, cache redis.RedisCacheHandler, ttl time.Duration) *Router {
+	return &Router{NodeID: nodeID, hub: sessions, cache: cache, ttl: ttl}
+}
+
+// Start subscribes to the node's channel and keeps the routes of the local
+// users fresh until ctx is done.
+func (r *Router) Start(ctx context.Context) error {
+	if err := r.cache.SubscribeToNode(ctx, r.NodeID, r.receive); err != nil {
+		return fmt.Errorf("could not start router of node %s: %w", r.NodeID, err)
+	}
+	go r.refreshRoutes(ctx)
+	return nil
+}
+
+func (r *Router) refreshRoutes(ctx context.Context) {
+	ticker := time.NewTicker(r.ttl / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, userID := range r.hub.Users() {
+				r.addRoute(ctx, userID)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Register adds a connection to the local hub and routes the user to this
+// node.
+func (r *Router) Register(ctx context.Context, userID string, username string, conn hub.Conn) *hub.Session {
+	session := r.hub.Register(userID, username, conn)
+	r.addRoute(ctx, userID)
+	return session
+}
+
+// Unregister removes a session and, with it the user's last one on this
+// node, the route. A route removed while another session is being
+// registered comes back with the next refresh.
+func (r *Router) Unregister(ctx context.Context, session *hub.Session) {
+	r.hub.Unregister(session)
+	if r.hub.Online(session.UserID) {
+		return
+	}
+	if err := r.cache.RemoveRoute(context.WithoutCancel(ctx), session.UserID, r.NodeID); err != nil {
+		log.Printf("Could not remove route of user %s: %v", session.UserID, err)
+	}
+}
+
+func (r *Router) addRoute(ctx context.Context, userID string) {
+	if err := r.cache.AddRoute(ctx, userID, r.NodeID, r.ttl); err != nil {
+		log.Printf("Could not route user %s: %v", userID, err)
+	}
+}
+
+// SendToUser pushes a message to every session of the user on any node. It
+// returns how many local sessions accepted it plus how many other nodes it
+// was published to.
+func (r *Router) SendToUser(userID string, response protocol.Response, key string) int {
+	delivered := r.hub.SendToUser(userID, response, key)
+	return delivered + r.publish(userID, func() (message, error) {
+		return r.encode(userID, "", response, key)
+	})
+}
+
+// SendToSession pushes a message to one session of the user, on whichever
+// node it is connected to. It returns hub.ErrNoSession when the session is
+// not local and no other node could be asked to deliver it.
+func (r *Router) SendToSession(userID string, sessionID string, response protocol.Response, key string) error {
+	err := r.hub.SendToSession(sessionID, response, key)
+	if !errors.Is(err, hub.ErrNoSession) {
+		return err
+	}
+	published := r.publish(userID, func() (message, error) {
+		return r.encode(userID, sessionID, response, key)
+	})
+	if published == 0 {
+		return hub.ErrNoSession
+	}
+	return nil
+}
+
+// Kick disconnects every session of the user on every node. It returns how
+// many local sessions were closed plus how many other nodes were asked to
+// close theirs.
+func (r *Router) Kick(userID string, reason string) int {
+	kicked := r.hub.Kick(userID, reason)
+	return kicked + r.publish(userID, func() (message, error) {
+		return message{UserID: userID, Kick: true, Reason: reason}, nil
+	})
+}
+
+// KickSession disconnects one session of the user, on whichever node it is
+// connected to. Like SendToSession, it returns hub.ErrNoSession when the
+// session is not local and no other node could be asked to close it.
+func (r *Router) KickSession(userID string, sessionID string, reason string) error {
+	err := r.hub.KickSession(sessionID, reason)
+	if !errors.Is(err, hub.ErrNoSession) {
+		return err
+	}
+	published := r.publish(userID, func() (message, error) {
+		return message{UserID: userID, SessionID: sessionID, Kick: true, Reason: reason}, nil
+	})
+	if published == 0 {
+		return hub.ErrNoSession
+	}
+	return nil
+}
+
+// Metrics are the session counters of this node.
+func (r *Router) Metrics() hub.Metrics {
+	return r.hub.Metrics()
+}
+
+// publish sends the message built by build to the other nodes the user is
+// routed to and returns how many it reached. The message is only built when
+// there is another node.
+func (r *Router) publish(userID string, build func() (message, error)) int {
+	ctx := context.Background()
+	nodes, err := r.cache.GetRoutes(ctx, userID)
+	if err != nil {
+		log.Printf("Could not route message to user %s: %v", userID, err)
+		return 0
+	}
+	var data []byte
+	published := 0
+	for _, nodeID := range nodes {
+		if nodeID == r.NodeID {
+			continue
+		}
+		if data == nil {
+			msg, err := build()
+			if err == nil {
+				data, err = json.Marshal(msg)
+			}
+			if err != nil {
+				log.Printf("Could not route message to user %s: %v", userID, err)
+				return published
+			}
+		}
+		if err := r.cache.PublishToNode(ctx, nodeID, data); err != nil {
+			log.Printf("Could not route message to user %s on node %s: %v", userID, nodeID, err)
+			continue
+		}
+		published++
+	}
+	return published
+}
+
+func (r *Router) encode(userID string, sessionID string, response protocol.Response, key string) (message, error) {
+	envelope, err := protocol.V1Codec{}.Encode(response)
+	if err != nil {
+		return message{}, fmt.Errorf("error encoding %s: %w", response.Type, err)
+	}
+	return message{UserID: userID, SessionID: sessionID, Key: key, Response: envelope}, nil
+}
+
+// receive delivers a message published by another node to the local hub.
+func (r *Router) receive(data []byte) {
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		log.Printf("Dropping malformed message on node %s: %v", r.NodeID, err)
+		return
+	}
+	if msg.Kick && msg.SessionID != "" {
+		if err := r.hub.KickSession(msg.SessionID, msg.Reason); err != nil && !errors.Is(err, hub.ErrNoSession) {
+			log.Printf("Could not kick session %s: %v", msg.SessionID, err)
+		}
+		return
+	}
+	if msg.Kick {
+		r.hub.Kick(msg.UserID, msg.Reason)
+		return
+	}
+	response, err := protocol.V1Codec{}.DecodeResponse(msg.Response)
+	if err != nil {
+		log.Printf("Dropping message for user %s: %v", msg.UserID, err)
+		return
+	}
+	if msg.SessionID == "" {
+		r.hub.SendToUser(msg.UserID, response, msg.Key)
+		return
+	}
+	// Every node the user is on is asked, only the one holding the session
+	// delivers
+	if err := r.hub.SendToSession(msg.SessionID, response, msg.Key); err != nil && !errors.Is(err, hub.ErrNoSession) {
+		log.Printf("Could not deliver message to session %s: %v", msg.SessionID, err)
+	}
+}
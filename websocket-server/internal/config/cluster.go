@@ -0,0 +1,24 @@
+package config
+
+import (
+	"log"
+	"os"
+
+	"github.com/google/uuid"
+)
+
+// LoadNodeID reads NODE_ID, the name the other websocket-server nodes
+// route messages to this one by. It defaults to the hostname, which is
+// unique per container.
+func LoadNodeID() string {
+	if nodeID := os.Getenv("NODE_ID"); nodeID != "" {
+		return nodeID
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		nodeID := uuid.New().String()
+		log.Printf("No NODE_ID or hostname, using %s: %v", nodeID, err)
+		return nodeID
+	}
+	return hostname
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"log"
+	"time"
+)
+
+// Heartbeat controls how the server detects dead WebSocket connections and
+// how long a user stays online in Redis without a refresh.
+type Heartbeat struct {
+	// PingInterval is how often the server pings each connection.
+	PingInterval time.Duration
+	// PongWait is how long a connection may stay silent, pongs included,
+	// before it is closed. It must be longer than PingInterval.
+	PongWait time.Duration
+	// WriteWait bounds every write, so a stalled peer cannot block senders.
+	WriteWait time.Duration
+	// PresenceTTL is how long a connection counts as online after its last
+	// refresh; it is refreshed every PresenceTTL/2.
+	PresenceTTL time.Duration
+}
+
+var DefaultHeartbeat = Heartbeat{
+	PingInterval: 30 * time.Second,
+	PongWait:     60 * time.Second,
+	WriteWait:    10 * time.Second,
+	PresenceTTL:  60 * time.Second,
+}
+
+// LoadHeartbeat returns DefaultHeartbeat with overrides from the
+// WS_PING_INTERVAL, WS_PONG_WAIT, WS_WRITE_WAIT and PRESENCE_TTL
+// environment variables, given as Go durations.
+func LoadHeartbeat() Heartbeat {
+	heartbeat := DefaultHeartbeat
+	heartbeat.PingInterval = durationFromEnv("WS_PING_INTERVAL", heartbeat.PingInterval)
+	heartbeat.PongWait = durationFromEnv("WS_PONG_WAIT", heartbeat.PongWait)
+	heartbeat.WriteWait = durationFromEnv("WS_WRITE_WAIT", heartbeat.WriteWait)
+	heartbeat.PresenceTTL = durationFromEnv("PRESENCE_TTL", heartbeat.PresenceTTL)
+	if heartbeat.PongWait <= heartbeat.PingInterval {
+		log.Printf("WS_PONG_WAIT %s is not longer than WS_PING_INTERVAL %s, using %s", heartbeat.PongWait, heartbeat.PingInterval, 2*heartbeat.PingInterval)
+		heartbeat.PongWait = 2 * heartbeat.PingInterval
+	}
+	return heartbeat
+}
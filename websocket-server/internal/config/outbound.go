@@ -0,0 +1,69 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+)
+
+// SlowConsumerPolicy decides what happens when a client reads pushed
+// updates slower than they are produced and its queue fills up.
+type SlowConsumerPolicy string
+
+const (
+	// DropOldest discards the oldest queued push to make room. Replies to
+	// the client's own requests are never dropped.
+	DropOldest SlowConsumerPolicy = "drop_oldest"
+	// Disconnect closes the connection with a close code.
+	Disconnect SlowConsumerPolicy = "disconnect"
+)
+
+// Outbound bounds the per-connection queue of messages waiting to be
+// written. Replies and pushes are queued separately, QueueSize each.
+type Outbound struct {
+	QueueSize          int
+	SlowConsumerPolicy SlowConsumerPolicy
+}
+
+var DefaultOutbound = Outbound{
+	QueueSize:          256,
+	SlowConsumerPolicy: DropOldest,
+}
+
+// LoadOutbound returns DefaultOutbound with overrides from the
+// OUTBOUND_QUEUE_SIZE and SLOW_CONSUMER_POLICY environment variables.
+func LoadOutbound() Outbound {
+	outbound := DefaultOutbound
+	if value := os.Getenv("OUTBOUND_QUEUE_SIZE"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size <= 0 {
+			log.Printf("Ignoring invalid OUTBOUND_QUEUE_SIZE %q, using %d", value, outbound.QueueSize)
+		} else {
+			outbound.QueueSize = size
+		}
+	}
+	switch policy := SlowConsumerPolicy(os.Getenv("SLOW_CONSUMER_POLICY")); policy {
+	case "":
+	case DropOldest, Disconnect:
+		outbound.SlowConsumerPolicy = policy
+	default:
+		log.Printf("Ignoring invalid SLOW_CONSUMER_POLICY %q, using %s", policy, outbound.SlowConsumerPolicy)
+	}
+	return outbound
+}
+
+// LoadMaxSessionsPerUser reads MAX_SESSIONS_PER_USER, the number of
+// concurrent connections a user may have on one server. 0, the default,
+// means no limit.
+func LoadMaxSessionsPerUser() int {
+	value := os.Getenv("MAX_SESSIONS_PER_USER")
+	if value == "" {
+		return 0
+	}
+	max, err := strconv.Atoi(value)
+	if err != nil || max < 0 {
+		log.Printf("Ignoring invalid MAX_SESSIONS_PER_USER %q", value)
+		return 0
+	}
+	return max
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// Timeouts are the per-operation deadlines applied by the storage layers on
+// top of whatever deadline the caller's context already carries.
+type Timeouts struct {
+	CassandraRead  time.Duration
+	CassandraWrite time.Duration
+	Redis          time.Duration
+}
+
+var DefaultTimeouts = Timeouts{
+	CassandraRead:  2 * time.Second,
+	CassandraWrite: 2 * time.Second,
+	Redis:          500 * time.Millisecond,
+}
+
+// LoadTimeouts returns DefaultTimeouts with overrides from the
+// CASSANDRA_READ_TIMEOUT, CASSANDRA_WRITE_TIMEOUT and REDIS_TIMEOUT
+// environment variables, given as Go durations (e.g. "750ms").
+func LoadTimeouts() Timeouts {
+	timeouts := DefaultTimeouts
+	timeouts.CassandraRead = durationFromEnv("CASSANDRA_READ_TIMEOUT", timeouts.CassandraRead)
+	timeouts.CassandraWrite = durationFromEnv("CASSANDRA_WRITE_TIMEOUT", timeouts.CassandraWrite)
+	timeouts.Redis = durationFromEnv("REDIS_TIMEOUT", timeouts.Redis)
+	return timeouts
+}
+
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Ignoring invalid %s %q, using %s", name, value, fallback)
+		return fallback
+	}
+	return d
+}
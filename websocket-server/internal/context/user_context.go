@@ -3,6 +3,10 @@ package context
 import "matching-service/websocket-server/internal/models"
 
 type UserContext struct {
-	UserID   string
-	Location models.Location
+	UserID    string
+	Username  string
+	SessionID string // hub session of this connection
+	Location  models.Location
+	// LocationLoaded is set once Location holds the last stored point
+	LocationLoaded bool
 }
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"matching-service/websocket-server/internal/config"
+	"matching-service/websocket-server/internal/outbound"
+	"matching-service/websocket-server/internal/protocol"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// client wraps a connection with the per-connection state that outlives a
+// single message. gorilla/websocket allows only one concurrent writer, so
+// the read loop and background streams only queue messages; writePump is
+// the one goroutine that writes them, along with the keepalive pings.
+// client implements hub.Conn.
+type client struct {
+	conn      *websocket.Conn
+	cancel    context.CancelFunc
+	codec     protocol.Codec
+	queue     *outbound.Queue
+	heartbeat config.Heartbeat
+
+	matchCancel     context.CancelFunc
+	locationChanged chan struct{}
+	friendsCancel   context.CancelFunc
+}
+
+// newClient wraps conn; cancel must end the connection's context.
+func newClient(conn *websocket.Conn, cancel context.CancelFunc, heartbeat config.Heartbeat, settings config.Outbound) *client {
+	return &client{
+		conn:            conn,
+		cancel:          cancel,
+		codec:           protocol.CodecFor(conn.Subprotocol()),
+		queue:           outbound.NewQueue(settings.QueueSize, settings.SlowConsumerPolicy),
+		heartbeat:       heartbeat,
+		locationChanged: make(chan struct{}, 1),
+	}
+}
+
+// Send queues a reply to one of the client's requests.
+func (c *client) Send(response protocol.Response) error {
+	return c.queue.Send(outbound.Reply, response, "")
+}
+
+// Push queues an update the client did not ask for. A push with the same
+// non-empty key that is still queued is replaced rather than sent twice.
+func (c *client) Push(response protocol.Response, key string) error {
+	return c.queue.Send(outbound.Push, response, key)
+}
+
+// writePump writes queued messages and pings until ctx is done or a write
+// fails, then cancels the connection.
+func (c *client) writePump(ctx context.Context) {
+	defer c.cancel()
+	defer c.queue.Close()
+	ticker := time.NewTicker(c.heartbeat.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.queue.Ready():
+			if c.queue.Overflowed() {
+				log.Println("Closing connection of a slow consumer")
+				c.writeClose(websocket.ClosePolicyViolation, "slow consumer")
+				return
+			}
+			for {
+				response, ok := c.queue.Next()
+				if !ok {
+					break
+				}
+				if err := c.write(response); err != nil {
+					log.Println("Error writing message:", err)
+					return
+				}
+			}
+		case <-ticker.C:
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.heartbeat.WriteWait))
+			if err != nil {
+				log.Println("Error sending ping:", err)
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *client) write(response protocol.Response) error {
+	data, err := c.codec.Encode(response)
+	if err != nil {
+		log.Printf("Error encoding %s: %v", response.Type, err)
+		return nil
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.heartbeat.WriteWait))
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *client) writeClose(code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(c.heartbeat.WriteWait))
+}
+
+// Close drops whatever is still queued, tells the client why and ends the
+// connection.
+func (c *client) Close(code int, reason string) {
+	c.queue.Close()
+	c.writeClose(code, reason)
+	c.cancel()
+}
+
+// notifyLocationChanged wakes up the match stream, if any, without blocking.
+func (c *client) notifyLocationChanged() {
+	select {
+	case c.locationChanged <- struct{}{}:
+	default:
+	}
+}
+
+func (c *client) stopMatchStream() {
+	if c.matchCancel != nil {
+		c.matchCancel()
+		c.matchCancel = nil
+	}
+}
+
+func (c *client) stopFriendStream() {
+	if c.friendsCancel != nil {
+		c.friendsCancel()
+		c.friendsCancel = nil
+	}
+}
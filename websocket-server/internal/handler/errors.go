@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"errors"
+	"matching-service/websocket-server/internal/apperror"
+	"matching-service/websocket-server/internal/matcher"
+	"matching-service/websocket-server/internal/protocol"
+	"matching-service/websocket-server/internal/repository"
+	"matching-service/websocket-server/internal/validation"
+	"matching-service/websocket-server/pkg/redis"
+
+	"github.com/gocql/gocql"
+)
+
+// classifyError maps an error from the repository, cache or matcher to the
+// code reported to the client. Anything unrecognised is a storage failure,
+// which clients may retry.
+func classifyError(err error) *apperror.Error {
+	var appErr *apperror.Error
+	var validationErr *validation.Error
+	switch {
+	case errors.As(err, &appErr):
+		return appErr
+	case errors.As(err, &validationErr):
+		return &apperror.Error{
+			Code:    apperror.CodeValidation,
+			Reason:  validationErr.Reason.Error(),
+			Message: validationErr.Error(),
+			Err:     err,
+		}
+	case errors.Is(err, matcher.ErrInvalidQuery), errors.Is(err, repository.ErrInvalidTrajectoryRequest):
+		return apperror.Wrap(apperror.CodeValidation, err.Error(), err)
+	case errors.Is(err, gocql.ErrNotFound), errors.Is(err, redis.ErrNotFound):
+		return apperror.Wrap(apperror.CodeNotFound, "Location not found", err)
+	default:
+		return apperror.Wrap(apperror.CodeStorageUnavailable, "Storage unavailable, retry later", err)
+	}
+}
+
+func ackResponse() protocol.Response {
+	return protocol.Response{Type: protocol.TypeAck, Payload: protocol.Empty{}}
+}
+
+func errorResponse(err error) protocol.Response {
+	appErr := classifyError(err)
+	return protocol.Response{
+		Type:    protocol.TypeError,
+		Payload: protocol.ErrorPayload{Code: string(appErr.Code), Reason: appErr.Reason, Message: appErr.Message},
+	}
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"errors"
+	"matching-service/websocket-server/internal/auth"
+	"matching-service/websocket-server/internal/cluster"
+	"matching-service/websocket-server/internal/hub"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultKickReason is sent in the close frame when the request gives none.
+const defaultKickReason = "disconnected by an administrator"
+
+// HubHandler exposes the sessions to administrators: the counters of this
+// server and disconnecting them.
+type HubHandler struct {
+	Router *cluster.Router
+	Auth   auth.Authenticator
+}
+
+func NewHubHandler(router *cluster.Router, authenticator auth.Authenticator) *HubHandler {
+	return &HubHandler{Router: router, Auth: authenticator}
+}
+
+// RequireAdmin lets through callers with the admin role only.
+func (h *HubHandler) RequireAdmin(c *gin.Context) {
+	identity, err := h.Auth.Authenticate(c.Request)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or missing token"})
+		return
+	}
+	if !identity.HasRole(auth.RoleAdmin) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin role required"})
+		return
+	}
+	c.Next()
+}
+
+func (h *HubHandler) Metrics(c *gin.Context) {
+	c.JSON(http.StatusOK, h.Router.Metrics())
+}
+
+// Kick disconnects every session of the user on every node, with the
+// "reason" query parameter in the close frame.
+func (h *HubHandler) Kick(c *gin.Context) {
+	kicked := h.Router.Kick(c.Param("user_id"), c.DefaultQuery("reason", defaultKickReason))
+	c.JSON(http.StatusOK, gin.H{"kicked": kicked})
+}
+
+// KickSession disconnects a single session of the user, on whichever node
+// holds it.
+func (h *HubHandler) KickSession(c *gin.Context) {
+	err := h.Router.KickSession(c.Param("user_id"), c.Param("session_id"), c.DefaultQuery("reason", defaultKickReason))
+	if errors.Is(err, hub.ErrNoSession) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
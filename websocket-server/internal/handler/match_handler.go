@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"matching-service/websocket-server/internal/auth"
+	"matching-service/websocket-server/internal/matcher"
+	"matching-service/websocket-server/internal/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MatchHandler serves matching over plain HTTP for clients that do not keep
+// a socket open. It accepts the same MatchQuery as the find_matches action.
+type MatchHandler struct {
+	Matcher *matcher.MatcherService
+	Auth    auth.Authenticator
+}
+
+func NewMatchHandler(matcherService *matcher.MatcherService, authenticator auth.Authenticator) *MatchHandler {
+	return &MatchHandler{Matcher: matcherService, Auth: authenticator}
+}
+
+func (h *MatchHandler) FindMatches(c *gin.Context) {
+	identity, err := h.Auth.Authenticate(c.Request)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or missing token"})
+		return
+	}
+
+	var query models.MatchQuery
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&query); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	matches, err := h.Matcher.FindPossibleMatches(c.Request.Context(), identity.UserID, query)
+	if errors.Is(err, matcher.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error finding matches for user %s: %v", identity.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find matches"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"matches": matches})
+}
@@ -1,37 +1,64 @@
 package handler
 
 import (
-	"encoding/json"
+	stdcontext "context"
+	"errors"
 	"fmt"
 	"log"
+	"matching-service/websocket-server/internal/apperror"
+	"matching-service/websocket-server/internal/auth"
+	"matching-service/websocket-server/internal/cluster"
+	"matching-service/websocket-server/internal/config"
 	"matching-service/websocket-server/internal/context"
+	"matching-service/websocket-server/internal/matcher"
 	"matching-service/websocket-server/internal/models"
+	"matching-service/websocket-server/internal/protocol"
 	"matching-service/websocket-server/internal/repository"
+	"matching-service/websocket-server/internal/validation"
 	"matching-service/websocket-server/pkg/redis"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gocql/gocql"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
+const matchRefreshInterval = 10 * time.Second
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
 	CheckOrigin:     func(r *http.Request) bool { return true },
+	// Echo the bearer subprotocol back to clients that pass their token
+	// in Sec-WebSocket-Protocol, otherwise browsers drop the connection.
+	Subprotocols: append(protocol.Subprotocols, auth.BearerSubprotocol),
 }
 
 type WebSocketHandler struct {
 	LocationRepo repository.LocationRepository
 	Cache        redis.RedisCacheHandler
+	Auth         auth.Authenticator
+	Matcher      *matcher.MatcherService
+	Validator    *validation.Validator
+	Heartbeat    config.Heartbeat
+	Outbound     config.Outbound
+	Router       *cluster.Router
 }
 
-func NewWebSocketHandler(repo repository.LocationRepository, cache redis.RedisCacheHandler) *WebSocketHandler {
-	return &WebSocketHandler{LocationRepo: repo, Cache: cache}
+func NewWebSocketHandler(repo repository.LocationRepository, cache redis.RedisCacheHandler, authenticator auth.Authenticator, matcherService *matcher.MatcherService, validator *validation.Validator, heartbeat config.Heartbeat, outbound config.Outbound, router *cluster.Router) *WebSocketHandler {
+	return &WebSocketHandler{LocationRepo: repo, Cache: cache, Auth: authenticator, Matcher: matcherService, Validator: validator, Heartbeat: heartbeat, Outbound: outbound, Router: router}
 }
 
 func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
+	identity, err := h.Auth.Authenticate(c.Request)
+	if err != nil {
+		log.Println("Rejecting unauthenticated connection:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or missing token"})
+		return
+	}
+
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Println("Error while upgrading connection:", err)
@@ -40,15 +67,39 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	userID := uuid.New().String()
+	// The connection context ends when the read loop exits or the server
+	// shuts down, cancelling every Cassandra and Redis call made for it.
+	ctx, cancel := stdcontext.WithCancel(c.Request.Context())
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close() // unblocks ReadMessage on shutdown
+	}()
+
+	client := newClient(conn, cancel, h.Heartbeat, h.Outbound)
+	defer client.stopMatchStream()
+	defer client.stopFriendStream()
+
+	// A connection that sends nothing, not even a pong, for PongWait is
+	// considered dead: the read below fails and the handler returns.
+	conn.SetReadDeadline(time.Now().Add(h.Heartbeat.PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(h.Heartbeat.PongWait))
+	})
+	go client.writePump(ctx)
+
+	userID := identity.UserID
+	session := h.Router.Register(ctx, userID, identity.Username, client)
+	defer h.Router.Unregister(ctx, session)
 
 	userContext := context.UserContext{
-		UserID: userID,
+		UserID:    userID,
+		Username:  identity.Username,
+		SessionID: session.ID,
 	}
 
-	log.Printf("Using dummy user ID: %s", userID)
-	stopChan := make(chan bool)
-	go h.Cache.RefreshTTL(userID, 60*time.Second, 30*time.Second, stopChan)
+	log.Printf("User %s (%s) connected, session %s", userID, identity.Username, session.ID)
+	go redis.KeepPresence(ctx, h.Cache, userID, session.ID, h.Heartbeat.PresenceTTL)
 
 	for {
 		log.Println("Websocket Server Reading mesaaage")
@@ -57,161 +108,398 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 			log.Println("Error while reading message:", err)
 			break
 		}
+		conn.SetReadDeadline(time.Now().Add(h.Heartbeat.PongWait))
 
-		log.Println("Websocket Server Unmarshalling the message")
-		var message models.WebSocketMessage
-		if err := json.Unmarshal(msg, &message); err != nil {
-			log.Println("Error while unmarshalling message:", err)
+		log.Println("Websocket Server decoding the message")
+		request, err := client.codec.Decode(msg)
+		if err != nil {
+			log.Println("Error while decoding message:", err)
+			response := errorResponse(err)
+			response.RequestID = request.RequestID
+			if err := client.Send(response); err != nil {
+				break
+			}
 			continue
 		}
 
 		log.Println("Websocket server processing the message by relaying to the right handler")
-		if err := h.processMessage(conn, message, &userContext); err != nil {
-			log.Println("Error processing message:", err)
+		if err := h.processMessage(ctx, client, request, &userContext); err != nil {
+			log.Println("Error sending response:", err)
+			break
 		}
 	}
-	stopChan <- true
 }
 
-func (h *WebSocketHandler) processMessage(conn *websocket.Conn, message models.WebSocketMessage, userContext *context.UserContext) error {
-	var response models.WebSocketMessage
+// processMessage runs one request and replies with a response echoing its
+// request ID: the action's result, an ack, or an error with its code.
+func (h *WebSocketHandler) processMessage(ctx stdcontext.Context, client *client, request protocol.Request, userContext *context.UserContext) error {
+	response, err := h.handleRequest(ctx, client, request, userContext)
+	if err != nil {
+		log.Printf("Error processing %s: %v", request.Type, err)
+		response = errorResponse(err)
+	}
+	response.RequestID = request.RequestID
+	return client.Send(response)
+}
+
+func (h *WebSocketHandler) handleRequest(ctx stdcontext.Context, client *client, request protocol.Request, userContext *context.UserContext) (protocol.Response, error) {
 	var err error
 
-	switch message.Action {
-	case "create":
-		return h.createLocation(message, userContext)
-	case "update":
-		return h.updateLocation(message, userContext)
-	case "delete":
-		return h.deleteLocation(userContext)
-	case "update_destination":
-		return h.updateDestination(message, userContext)
-	case "update_current_location":
-		return h.updateCurrentLocation(message, userContext)
-	case "get_location":
-		response, err = h.getUserLocation(message.UserID)
-		if err != nil {
-			log.Println("Error getting user location:", err)
-			response = models.WebSocketMessage{Error: "Failed to get location"}
+	switch payload := request.Payload.(type) {
+	case *protocol.LocationPayload:
+		if request.Type == protocol.TypeCreate {
+			err = h.createLocation(ctx, client, *payload, userContext)
+		} else {
+			err = h.updateLocation(ctx, client, *payload, userContext)
 		}
-		log.Printf("Message: %+v\n", response)
-		err = conn.WriteJSON(response)
-		if err != nil {
-			log.Println("Error sending response:", err)
-			return err
+	case *protocol.DestinationPayload:
+		err = h.updateDestination(ctx, payload.Destination, userContext)
+		if err == nil {
+			client.notifyLocationChanged()
+		}
+	case *protocol.PositionPayload:
+		err = h.updateCurrentLocation(ctx, *payload, userContext)
+		if err == nil {
+			client.notifyLocationChanged()
+		}
+	case *models.MatchQuery:
+		if request.Type == protocol.TypeSubscribeMatches {
+			h.subscribeMatches(ctx, client, request.RequestID, *payload, userContext)
+		} else {
+			return h.findMatches(ctx, *payload, userContext)
+		}
+	case *protocol.TrajectoryQuery:
+		return h.getTrajectory(ctx, *payload, userContext)
+	case *protocol.LocationQuery:
+		return h.getUserLocation(ctx, payload.UserID)
+	case *protocol.Empty:
+		switch request.Type {
+		case protocol.TypeDelete:
+			err = h.deleteLocation(ctx, userContext)
+		case protocol.TypeSubscribeFriends:
+			err = h.subscribeFriends(ctx, client, request.RequestID, userContext)
+		case protocol.TypeUnsubscribeFriends:
+			client.stopFriendStream()
+		default:
+			client.stopMatchStream()
 		}
 	default:
-		log.Println("Unknown action:", message.Action)
-		return nil
+		return protocol.Response{}, apperror.New(apperror.CodeValidation, fmt.Sprintf("unknown type %q", request.Type))
 	}
 
+	if err != nil {
+		return protocol.Response{}, err
+	}
+	return ackResponse(), nil
+}
+
+// validatePosition checks a new position of the connected user against
+// the previous one and returns the time it was taken.
+func (h *WebSocketHandler) validatePosition(ctx stdcontext.Context, position protocol.Position, timestamp *time.Time, userContext *context.UserContext) (time.Time, error) {
+	if err := h.Validator.Position("position", position.Latitude, position.Longitude); err != nil {
+		return time.Time{}, err
+	}
+	at, err := h.Validator.Timestamp("timestamp", timestamp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := h.loadLastLocation(ctx, userContext); err != nil {
+		return time.Time{}, err
+	}
+	if err := h.Validator.Movement("position", userContext.Location, position.Latitude, position.Longitude, at); err != nil {
+		return time.Time{}, err
+	}
+	return at, nil
+}
+
+// loadLastLocation fills in the point the user was last stored at before
+// the first position of a connection is checked, so that reconnecting does
+// not reset the movement check. A user with no stored point is not checked.
+func (h *WebSocketHandler) loadLastLocation(ctx stdcontext.Context, userContext *context.UserContext) error {
+	if userContext.LocationLoaded {
+		return nil
+	}
+	location, err := h.getLocationFromCacheOrDB(ctx, userContext.UserID)
+	switch {
+	case err == nil:
+		userContext.Location = location
+	case !errors.Is(err, gocql.ErrNotFound):
+		return fmt.Errorf("failed to load the last location: %w", err)
+	}
+	userContext.LocationLoaded = true
 	return nil
 }
 
-func (h *WebSocketHandler) createLocation(message models.WebSocketMessage, userContext *context.UserContext) error {
+func (h *WebSocketHandler) validateLocation(ctx stdcontext.Context, payload protocol.LocationPayload, userContext *context.UserContext) (time.Time, error) {
+	if err := h.Validator.Destination("destination", payload.Destination.Latitude, payload.Destination.Longitude); err != nil {
+		return time.Time{}, err
+	}
+	return h.validatePosition(ctx, payload.Position, payload.Timestamp, userContext)
+}
+
+func (h *WebSocketHandler) createLocation(ctx stdcontext.Context, client *client, payload protocol.LocationPayload, userContext *context.UserContext) error {
+	at, err := h.validateLocation(ctx, payload, userContext)
+	if err != nil {
+		return err
+	}
 	location := models.Location{
 		UserId:               userContext.UserID,
-		CurrentLatitude:      message.Latitude,
-		CurrentLongitude:     message.Longitude,
-		DestinationLatitude:  message.DestinationLatitude,
-		DestinationLongitude: message.DestinationLongitude,
+		CurrentLatitude:      payload.Position.Latitude,
+		CurrentLongitude:     payload.Position.Longitude,
+		DestinationLatitude:  payload.Destination.Latitude,
+		DestinationLongitude: payload.Destination.Longitude,
 		CreatedAt:            time.Now(),
-		UpdatedAt:            time.Now(),
+		UpdatedAt:            at,
 	}
 
-	err := h.LocationRepo.Create(location)
+	err = h.LocationRepo.Create(ctx, location)
 	if err != nil {
 		return err
 	}
-	go h.cacheLocation(location)
+	go func() {
+		h.cacheLocation(ctx, location)
+		client.notifyLocationChanged()
+		h.publishLocation(ctx, location)
+	}()
+	go h.recordHistory(ctx, location)
 	userContext.Location = location
 
 	return nil
 }
 
-func (h *WebSocketHandler) updateLocation(message models.WebSocketMessage, userContext *context.UserContext) error {
+func (h *WebSocketHandler) updateLocation(ctx stdcontext.Context, client *client, payload protocol.LocationPayload, userContext *context.UserContext) error {
+	at, err := h.validateLocation(ctx, payload, userContext)
+	if err != nil {
+		return err
+	}
 	location := models.Location{
 		UserId:               userContext.UserID,
-		CurrentLatitude:      message.Latitude,
-		CurrentLongitude:     message.Longitude,
-		DestinationLatitude:  message.DestinationLatitude,
-		DestinationLongitude: message.DestinationLongitude,
-		UpdatedAt:            time.Now(),
+		CurrentLatitude:      payload.Position.Latitude,
+		CurrentLongitude:     payload.Position.Longitude,
+		DestinationLatitude:  payload.Destination.Latitude,
+		DestinationLongitude: payload.Destination.Longitude,
+		UpdatedAt:            at,
 	}
-	err := h.LocationRepo.Update(location)
+	err = h.LocationRepo.Update(ctx, location)
 	if err != nil {
 		return err
 	}
-	go h.cacheLocation(location)
+	go func() {
+		h.cacheLocation(ctx, location)
+		client.notifyLocationChanged()
+		h.publishLocation(ctx, location)
+	}()
+	go h.recordHistory(ctx, location)
 	userContext.Location = location
 
 	return nil
 }
 
-func (h *WebSocketHandler) deleteLocation(userContext *context.UserContext) error {
-	userIDParsed, err := uuid.Parse(userContext.UserID)
+func (h *WebSocketHandler) deleteLocation(ctx stdcontext.Context, userContext *context.UserContext) error {
+	userIDParsed, err := parseUserID(userContext)
+	if err != nil {
+		return err
+	}
+	err = h.LocationRepo.Delete(ctx, userIDParsed)
 	if err != nil {
 		return err
 	}
-	return h.LocationRepo.Delete(userIDParsed)
+	return h.Cache.RemoveLocation(ctx, userContext.UserID)
 }
 
-func (h *WebSocketHandler) updateDestination(message models.WebSocketMessage, userContext *context.UserContext) error {
-	userIDParsed, err := uuid.Parse(userContext.UserID)
+func (h *WebSocketHandler) updateDestination(ctx stdcontext.Context, destination protocol.Position, userContext *context.UserContext) error {
+	if err := h.Validator.Destination("destination", destination.Latitude, destination.Longitude); err != nil {
+		return err
+	}
+	userIDParsed, err := parseUserID(userContext)
+	if err != nil {
+		return err
+	}
+	err = h.LocationRepo.UpdateDestination(ctx, userIDParsed, destination.Latitude, destination.Longitude)
 	if err != nil {
 		return err
 	}
-	return h.LocationRepo.UpdateDestination(userIDParsed, message.DestinationLatitude, message.DestinationLongitude)
+	userContext.Location.DestinationLatitude = destination.Latitude
+	userContext.Location.DestinationLongitude = destination.Longitude
+	return h.Cache.StoreDestination(ctx, userContext.UserID, destination.Latitude, destination.Longitude)
 }
 
-func (h *WebSocketHandler) updateCurrentLocation(message models.WebSocketMessage, userContext *context.UserContext) error {
-	userIDParsed, err := uuid.Parse(userContext.UserID)
+func (h *WebSocketHandler) updateCurrentLocation(ctx stdcontext.Context, payload protocol.PositionPayload, userContext *context.UserContext) error {
+	position := payload.Position
+	at, err := h.validatePosition(ctx, position, payload.Timestamp, userContext)
+	if err != nil {
+		return err
+	}
+	userIDParsed, err := parseUserID(userContext)
 	if err != nil {
 		return err
 	}
-	return h.LocationRepo.UpdateCurrentLocation(userIDParsed, message.Latitude, message.Longitude)
+	err = h.LocationRepo.UpdateCurrentLocation(ctx, userIDParsed, position.Latitude, position.Longitude, at)
+	if err != nil {
+		return err
+	}
+	userContext.Location.UserId = userContext.UserID
+	userContext.Location.CurrentLatitude = position.Latitude
+	userContext.Location.CurrentLongitude = position.Longitude
+	userContext.Location.UpdatedAt = at
+	go h.recordHistory(ctx, userContext.Location)
+
+	if err := h.Cache.StorePosition(ctx, userContext.UserID, position.Latitude, position.Longitude, at); err != nil {
+		return err
+	}
+	go h.publishLocation(ctx, userContext.Location)
+	return nil
 }
 
-func (h *WebSocketHandler) getUserLocation(userId string) (models.WebSocketMessage, error) {
-	location, err := h.getLocationFromCacheOrDB(userId)
+func (h *WebSocketHandler) findMatches(ctx stdcontext.Context, query models.MatchQuery, userContext *context.UserContext) (protocol.Response, error) {
+	matches, err := h.Matcher.FindPossibleMatches(ctx, userContext.UserID, query)
 	if err != nil {
-		return models.WebSocketMessage{}, fmt.Errorf("failed to get location: %w", err)
+		return protocol.Response{}, err
+	}
+	if matches == nil {
+		matches = []models.Match{}
+	}
+
+	return protocol.Response{Type: protocol.TypeMatches, Payload: protocol.MatchesPayload{Matches: matches}}, nil
+}
+
+// subscribeMatches starts streaming match diffs to this session through the
+// router, replacing any stream that is already running for this connection.
+// Every update carries the request ID of the subscription.
+func (h *WebSocketHandler) subscribeMatches(ctx stdcontext.Context, client *client, requestID string, query models.MatchQuery, userContext *context.UserContext) {
+	client.stopMatchStream()
+	ctx, client.matchCancel = stdcontext.WithCancel(ctx)
+
+	go h.Matcher.WatchMatches(ctx, userContext.UserID, query, matchRefreshInterval, client.locationChanged, func(diff matcher.MatchDiff) error {
+		return h.Router.SendToSession(userContext.UserID, userContext.SessionID, protocol.Response{
+			Type:      protocol.TypeMatchUpdate,
+			RequestID: requestID,
+			Payload:   protocol.MatchUpdatePayload{Added: diff.Added, Removed: diff.Removed},
+		}, "")
+	})
+}
+
+// subscribeFriends streams the location updates of the user's friends to
+// this session until the client unsubscribes or disconnects, replacing any
+// stream already running. Friends added or removed meanwhile are followed
+// without resubscribing. Updates of the same friend coalesce while queued.
+func (h *WebSocketHandler) subscribeFriends(ctx stdcontext.Context, client *client, requestID string, userContext *context.UserContext) error {
+	client.stopFriendStream()
+	ctx, cancel := stdcontext.WithCancel(ctx)
+	updates := make(chan models.Location, 100)
+	if err := h.Cache.SubscribeToFriendUpdates(ctx, userContext.UserID, updates); err != nil {
+		cancel()
+		return fmt.Errorf("failed to subscribe to friends: %w", err)
 	}
+	client.friendsCancel = cancel
 
-	return h.locationToWebSocketMessage(location), nil
+	go func() {
+		for location := range updates {
+			err := h.Router.SendToSession(userContext.UserID, userContext.SessionID, protocol.Response{
+				Type:      protocol.TypeFriendLocation,
+				RequestID: requestID,
+				Payload:   location,
+			}, "location:"+location.UserId)
+			if err != nil {
+				cancel()
+			}
+		}
+	}()
+	return nil
 }
 
-func (h *WebSocketHandler) getLocationFromCacheOrDB(userId string) (models.Location, error) {
-	location, err := h.Cache.Getlocation(userId)
+// parseUserID returns the connected user's ID as a UUID, which Cassandra
+// keys locations by.
+func parseUserID(userContext *context.UserContext) (uuid.UUID, error) {
+	userID, err := uuid.Parse(userContext.UserID)
+	if err != nil {
+		return uuid.UUID{}, apperror.Wrap(apperror.CodeUnauthorized, "User ID in token is not a UUID", err)
+	}
+	return userID, nil
+}
+
+func (h *WebSocketHandler) getUserLocation(ctx stdcontext.Context, userId string) (protocol.Response, error) {
+	if userId == "" {
+		return protocol.Response{}, apperror.New(apperror.CodeValidation, "user_id is required")
+	}
+	location, err := h.getLocationFromCacheOrDB(ctx, userId)
+	if err != nil {
+		return protocol.Response{}, fmt.Errorf("failed to get location: %w", err)
+	}
+
+	return protocol.Response{Type: protocol.TypeLocation, Payload: location}, nil
+}
+
+func (h *WebSocketHandler) getLocationFromCacheOrDB(ctx stdcontext.Context, userId string) (models.Location, error) {
+	location, err := h.Cache.Getlocation(ctx, userId)
 	if err == nil {
 		return location, nil
 	}
 
-	location, err = h.LocationRepo.GetByUserID(userId)
+	location, err = h.LocationRepo.GetByUserID(ctx, userId)
 	if err != nil {
 		return models.Location{}, fmt.Errorf("failed to get location from database: %w", err)
 	}
 
-	go h.cacheLocation(location)
+	go h.cacheLocation(ctx, location)
 
 	return location, nil
 }
 
-func (h *WebSocketHandler) cacheLocation(location models.Location) {
-	_, err := h.Cache.StoreLocation(location)
+// getTrajectory returns a page of the connected user's own location history.
+func (h *WebSocketHandler) getTrajectory(ctx stdcontext.Context, query protocol.TrajectoryQuery, userContext *context.UserContext) (protocol.Response, error) {
+	to := time.Now()
+	if query.To != nil {
+		to = *query.To
+	}
+	from := to.Add(-24 * time.Hour)
+	if query.From != nil {
+		from = *query.From
+	}
+
+	points, nextPageToken, err := h.LocationRepo.GetTrajectory(ctx, userContext.UserID, from, to, query.PageSize, query.PageToken)
 	if err != nil {
-		log.Printf("Failed to cache location for user %s: %v", location.UserId, err)
+		return protocol.Response{}, err
 	}
+
+	return protocol.Response{
+		Type:    protocol.TypeTrajectory,
+		Payload: protocol.TrajectoryPayload{Points: points, PageToken: nextPageToken},
+	}, nil
 }
 
-func (h *WebSocketHandler) locationToWebSocketMessage(location models.Location) models.WebSocketMessage {
-	return models.WebSocketMessage{
-		UserID:               location.UserId,
+// recordHistory, cacheLocation and publishLocation run after the response, so they are
+// detached from the connection's cancellation and only bounded by the
+// storage deadlines.
+func (h *WebSocketHandler) recordHistory(ctx stdcontext.Context, location models.Location) {
+	updatedAt := location.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = time.Now()
+	}
+	err := h.LocationRepo.AppendHistory(stdcontext.WithoutCancel(ctx), models.LocationPoint{
+		UserId:               location.UserId,
 		Latitude:             location.CurrentLatitude,
 		Longitude:            location.CurrentLongitude,
 		DestinationLatitude:  location.DestinationLatitude,
 		DestinationLongitude: location.DestinationLongitude,
-		CreatedAt:            location.CreatedAt,
-		UpdatedAt:            location.UpdatedAt,
+		UpdatedAt:            updatedAt,
+	})
+	if err != nil {
+		log.Printf("Failed to record location history for user %s: %v", location.UserId, err)
+	}
+}
+
+func (h *WebSocketHandler) cacheLocation(ctx stdcontext.Context, location models.Location) {
+	_, err := h.Cache.StoreLocation(stdcontext.WithoutCancel(ctx), location)
+	if err != nil {
+		log.Printf("Failed to cache location for user %s: %v", location.UserId, err)
+	}
+}
+
+// publishLocation announces a new position on the user's location_updates
+// channel, which the friends' connections on every node subscribe to.
+func (h *WebSocketHandler) publishLocation(ctx stdcontext.Context, location models.Location) {
+	if err := h.Cache.PublishLocationUpdate(stdcontext.WithoutCancel(ctx), location); err != nil {
+		log.Printf("Failed to publish location of user %s: %v", location.UserId, err)
 	}
 }
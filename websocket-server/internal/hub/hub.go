@@ -0,0 +1,284 @@
+// Package hub keeps the registry of live WebSocket sessions on this server,
+// so that messages can be delivered to a user wherever they are connected
+// from and sessions can be counted and kicked.
+package hub
+
+import (
+	"errors"
+	"matching-service/websocket-server/internal/protocol"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Close codes sent to sessions the hub disconnects.
+const (
+	CloseReplaced = 4000 // a newer session of the same user took the slot
+	CloseKicked   = 4001 // disconnected through Kick or KickSession
+)
+
+var ErrNoSession = errors.New("no such session")
+
+// Conn is the sending side of one connection.
+type Conn interface {
+	// Send queues a reply to the client's own request.
+	Send(response protocol.Response) error
+	// Push queues an unsolicited update; pushes with the same non-empty key
+	// may be coalesced.
+	Push(response protocol.Response, key string) error
+	// Close disconnects with a WebSocket close code.
+	Close(code int, reason string)
+}
+
+// Session is one connection of a user. A user may have several, one per
+// device.
+type Session struct {
+	ID          string
+	UserID      string
+	Username    string
+	ConnectedAt time.Time
+	conn        Conn
+}
+
+// SessionInfo describes a session without giving access to its connection.
+type SessionInfo struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	Username    string    `json:"username"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+type Metrics struct {
+	Users        int    `json:"users"`
+	Sessions     int    `json:"sessions"`
+	Registered   uint64 `json:"registered"`
+	Unregistered uint64 `json:"unregistered"`
+	Kicked       uint64 `json:"kicked"`
+	Delivered    uint64 `json:"delivered"`
+	Failed       uint64 `json:"failed"`
+}
+
+type Hub struct {
+	mu                 sync.RWMutex
+	users              map[string]map[string]*Session // user ID -> session ID -> session
+	sessions           map[string]*Session
+	maxSessionsPerUser int
+
+	registered   atomic.Uint64
+	unregistered atomic.Uint64
+	kicked       atomic.Uint64
+	delivered    atomic.Uint64
+	failed       atomic.Uint64
+}
+
+// NewHub returns an empty hub. With maxSessionsPerUser > 0, registering
+// one session too many replaces the user's oldest session; 1 enforces a
+// single session per user. 0 means no limit.
+func NewHub(maxSessionsPerUser int) *Hub {
+	return &Hub{
+		users:              map[string]map[string]*Session{},
+		sessions:           map[string]*Session{},
+		maxSessionsPerUser: maxSessionsPerUser,
+	}
+}
+
+// Register adds a connection of the user. Call Unregister with the returned
+// session once the connection is gone.
+func (h *Hub) Register(userID string, username string, conn Conn) *Session {
+	session := &Session{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		Username:    username,
+		ConnectedAt: time.Now(),
+		conn:        conn,
+	}
+
+	h.mu.Lock()
+	var replaced []*Session
+	if h.maxSessionsPerUser > 0 {
+		existing := sortedSessions(h.users[userID])
+		for len(existing) >= h.maxSessionsPerUser {
+			replaced = append(replaced, existing[0])
+			h.remove(existing[0])
+			existing = existing[1:]
+		}
+	}
+	if h.users[userID] == nil {
+		h.users[userID] = map[string]*Session{}
+	}
+	h.users[userID][session.ID] = session
+	h.sessions[session.ID] = session
+	h.mu.Unlock()
+
+	h.registered.Add(1)
+	for _, old := range replaced {
+		h.kicked.Add(1)
+		old.conn.Close(CloseReplaced, "replaced by a newer session")
+	}
+	return session
+}
+
+// Unregister removes a session. It is safe to call more than once.
+func (h *Hub) Unregister(session *Session) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.sessions[session.ID]; ok {
+		h.remove(session)
+		h.unregistered.Add(1)
+	}
+}
+
+func (h *Hub) remove(session *Session) {
+	delete(h.sessions, session.ID)
+	delete(h.users[session.UserID], session.ID)
+	if len(h.users[session.UserID]) == 0 {
+		delete(h.users, session.UserID)
+	}
+}
+
+// SendToSession pushes a message to one session.
+func (h *Hub) SendToSession(sessionID string, response protocol.Response, key string) error {
+	h.mu.RLock()
+	session, ok := h.sessions[sessionID]
+	h.mu.RUnlock()
+	if !ok {
+		return ErrNoSession
+	}
+	return h.deliver(session, response, key)
+}
+
+// SendToUser pushes a message to every session of the user and returns how
+// many accepted it.
+func (h *Hub) SendToUser(userID string, response protocol.Response, key string) int {
+	h.mu.RLock()
+	sessions := sortedSessions(h.users[userID])
+	h.mu.RUnlock()
+	return h.deliverAll(sessions, response, key)
+}
+
+// Broadcast pushes a message to every session on this server.
+func (h *Hub) Broadcast(response protocol.Response, key string) int {
+	h.mu.RLock()
+	sessions := sortedSessions(h.sessions)
+	h.mu.RUnlock()
+	return h.deliverAll(sessions, response, key)
+}
+
+func (h *Hub) deliverAll(sessions []*Session, response protocol.Response, key string) int {
+	delivered := 0
+	for _, session := range sessions {
+		if h.deliver(session, response, key) == nil {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+func (h *Hub) deliver(session *Session, response protocol.Response, key string) error {
+	if err := session.conn.Push(response, key); err != nil {
+		h.failed.Add(1)
+		return err
+	}
+	h.delivered.Add(1)
+	return nil
+}
+
+// Kick disconnects every session of the user and returns how many there
+// were.
+func (h *Hub) Kick(userID string, reason string) int {
+	h.mu.Lock()
+	sessions := sortedSessions(h.users[userID])
+	for _, session := range sessions {
+		h.remove(session)
+	}
+	h.mu.Unlock()
+
+	for _, session := range sessions {
+		h.kicked.Add(1)
+		session.conn.Close(CloseKicked, reason)
+	}
+	return len(sessions)
+}
+
+// KickSession disconnects a single session.
+func (h *Hub) KickSession(sessionID string, reason string) error {
+	h.mu.Lock()
+	session, ok := h.sessions[sessionID]
+	if ok {
+		h.remove(session)
+	}
+	h.mu.Unlock()
+	if !ok {
+		return ErrNoSession
+	}
+
+	h.kicked.Add(1)
+	session.conn.Close(CloseKicked, reason)
+	return nil
+}
+
+// Sessions lists the user's sessions, oldest first.
+func (h *Hub) Sessions(userID string) []SessionInfo {
+	h.mu.RLock()
+	sessions := sortedSessions(h.users[userID])
+	h.mu.RUnlock()
+
+	infos := make([]SessionInfo, len(sessions))
+	for i, session := range sessions {
+		infos[i] = SessionInfo{
+			ID:          session.ID,
+			UserID:      session.UserID,
+			Username:    session.Username,
+			ConnectedAt: session.ConnectedAt,
+		}
+	}
+	return infos
+}
+
+// Online reports whether the user has a session on this server.
+func (h *Hub) Online(userID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.users[userID]) > 0
+}
+
+// Users lists the users with a session on this server.
+func (h *Hub) Users() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	users := make([]string, 0, len(h.users))
+	for userID := range h.users {
+		users = append(users, userID)
+	}
+	sort.Strings(users)
+	return users
+}
+
+func (h *Hub) Metrics() Metrics {
+	h.mu.RLock()
+	users, sessions := len(h.users), len(h.sessions)
+	h.mu.RUnlock()
+	return Metrics{
+		Users:        users,
+		Sessions:     sessions,
+		Registered:   h.registered.Load(),
+		Unregistered: h.unregistered.Load(),
+		Kicked:       h.kicked.Load(),
+		Delivered:    h.delivered.Load(),
+		Failed:       h.failed.Load(),
+	}
+}
+
+func sortedSessions(sessions map[string]*Session) []*Session {
+	sorted := make([]*Session, 0, len(sessions))
+	for _, session := range sessions {
+		sorted = append(sorted, session)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ConnectedAt.Before(sorted[j].ConnectedAt)
+	})
+	return sorted
+}
@@ -6,141 +6,119 @@ import (
 	"log"
 	"matching-service/websocket-server/internal/models"
 	"matching-service/websocket-server/internal/repository"
-	"math"
+	"matching-service/websocket-server/pkg/redis"
+	"time"
 
-	"github.com/gocql/gocql"
 	"github.com/google/uuid"
-	"github.com/redis/go-redis/v9"
 )
 
 type MatcherService struct {
 	cassandraRepo repository.LocationRepository
-	redisClient   *redis.Client
-	ctx           context.Context
+	cache         redis.RedisCacheHandler
 }
 
-func NewMatcherService(cassandraRepo repository.LocationRepository, redisClient *redis.Client) *MatcherService {
+func NewMatcherService(cassandraRepo repository.LocationRepository, cache redis.RedisCacheHandler) *MatcherService {
 	return &MatcherService{
 		cassandraRepo: cassandraRepo,
-		redisClient:   redisClient,
-		ctx:           context.Background(),
+		cache:         cache,
 	}
 }
 
-func (s *MatcherService) SyncLocationToRedis() error {
-	locations, err := s.cassandraRepo.GetAllLocations()
-	if err != nil {
-		return fmt.Errorf("failed to fetch locations from Cassandra: %v", err)
-	}
-
-	// Add all locations to Redis
-	pipe := s.redisClient.Pipeline()
-	for _, loc := range locations {
-		key := loc.UserId
-		pipe.GeoAdd(s.ctx, "user_locations", &redis.GeoLocation{
-			Name:      key,
-			Longitude: loc.CurrentLongitude,
-			Latitude:  loc.CurrentLatitude,
-		})
-		// Store additional user data
-		pipe.HSet(s.ctx, key, map[string]interface{}{
-			"destination_lat": loc.DestinationLatitude,
-			"destination_lon": loc.DestinationLongitude,
-		})
-	}
-	_, err = pipe.Exec(s.ctx)
-	if err != nil {
-		return fmt.Errorf("failed to sync locations to Redis: %v", err)
-	}
+const defaultSyncBatchSize = 1000
 
-	log.Printf("Synced %d locations to Redis", len(locations))
-	return nil
+type SyncOptions struct {
+	// BatchSize is the number of rows read per Cassandra page and written
+	// per Redis pipeline.
+	BatchSize int
+	// PageState resumes a previous sync from SyncProgress.PageState.
+	PageState []byte
+	// Progress is called after every batch written to Redis.
+	Progress func(SyncProgress)
 }
 
-func (s *MatcherService) FindPossibleMatches(userID string, radius float64) ([]models.Location, error) {
-	// Get user's current location from Redis
-	key := userID
-	pos, err := s.redisClient.GeoPos(s.ctx, "user_locations", key).Result()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user location: %v", err)
-	}
-	if len(pos) == 0 || pos[0] == nil {
-		return nil, fmt.Errorf("user location not found")
-	}
-
-	// Find nearby users
-	nearby, err := s.redisClient.GeoRadius(s.ctx, "user_locations", pos[0].Longitude, pos[0].Latitude, &redis.GeoRadiusQuery{
-		Radius:    radius,
-		Unit:      "km",
-		WithCoord: true,
-		WithDist:  true,
-		Sort:      "ASC",
-	}).Result()
-	if err != nil {
-		return nil, fmt.Errorf("failed to find nearby users: %v", err)
-	}
+type SyncProgress struct {
+	Synced    int
+	Batches   int
+	PageState []byte // where to resume; nil once the sync is complete
+}
 
-	// Get user's destination
-	userDest, err := s.redisClient.HMGet(s.ctx, key, "destination_lat", "destination_lon").Result()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user destination: %v", err)
+// SyncLocationToRedis copies the locations table into Redis one page at a
+// time, so memory use is bounded by the batch size. On error the returned
+// progress holds the page state to resume from.
+func (s *MatcherService) SyncLocationToRedis(ctx context.Context, opts SyncOptions) (SyncProgress, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultSyncBatchSize
 	}
 
-	matches := []models.Location{}
-	for _, loc := range nearby {
-		if loc.Name == key {
-			continue // Skip the user themselves
+	progress := SyncProgress{PageState: opts.PageState}
+	batch := make([]models.Location, 0, opts.BatchSize)
+	for {
+		batch = batch[:0]
+		nextPageState, err := s.cassandraRepo.ScanLocations(ctx, progress.PageState, opts.BatchSize, func(loc models.Location) error {
+			batch = append(batch, loc)
+			return nil
+		})
+		if err != nil {
+			return progress, fmt.Errorf("failed to fetch locations from Cassandra: %w", err)
 		}
 
-		// Get potential match's destination
-		matchDest, err := s.redisClient.HMGet(s.ctx, loc.Name, "destination_lat", "destination_lon").Result()
+		// Add the batch to Redis in a single pipeline
+		err = s.cache.StoreLocations(ctx, batch)
 		if err != nil {
-			log.Printf("Failed to get destination for user %s: %v", loc.Name, err)
-			continue
+			return progress, fmt.Errorf("failed to sync locations to Redis: %w", err)
 		}
 
-		// Compare destinations
-		if isDestinationMatch(userDest, matchDest) {
-			uid, _ := gocql.ParseUUID(loc.Name) // Remove "user:" prefix
-			matches = append(matches, models.Location{
-				UserId:               uid.String(),
-				CurrentLatitude:      loc.Latitude,
-				CurrentLongitude:     loc.Longitude,
-				DestinationLatitude:  parseFloat(matchDest[0]),
-				DestinationLongitude: parseFloat(matchDest[1]),
-			})
+		progress.Synced += len(batch)
+		progress.Batches++
+		progress.PageState = nextPageState
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+
+		if nextPageState == nil {
+			break
 		}
 	}
 
-	return matches, nil
+	log.Printf("Synced %d locations to Redis in %d batches", progress.Synced, progress.Batches)
+	return progress, nil
 }
 
-func isDestinationMatch(dest1, dest2 []interface{}) bool {
-	const tolerance = 0.01 // Adjust as needed
-	return math.Abs(parseFloat(dest1[0])-parseFloat(dest2[0])) <= tolerance &&
-		math.Abs(parseFloat(dest1[1])-parseFloat(dest2[1])) <= tolerance
-}
+// FindPossibleMatches returns the users around userID whose trips are
+// compatible with theirs, ranked by score and filtered by the query.
+func (s *MatcherService) FindPossibleMatches(ctx context.Context, userID string, query models.MatchQuery) ([]models.Match, error) {
+	query, err := normalizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get user's current location and destination from Redis
+	user, err := s.cache.Getlocation(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user location: %w", err)
+	}
+
+	// Find nearby users
+	nearby, err := s.cache.Nearby(ctx, user.CurrentLatitude, user.CurrentLongitude, query.Radius, query.Unit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find nearby users: %w", err)
+	}
 
-func parseFloat(v interface{}) float64 {
-	f, _ := v.(float64)
-	return f
+	candidates := filterCandidates(user, nearby, query, time.Now())
+	return applyLimits(RankCandidates(user, candidates, query.MatchCriteria), query), nil
 }
 
-func (s *MatcherService) UpdateUserLocation(userID string, lat, lon float64) error {
+func (s *MatcherService) UpdateUserLocation(ctx context.Context, userID string, lat, lon float64) error {
 	// Update Cassandra
 	uid, _ := uuid.Parse(userID)
-	err := s.cassandraRepo.UpdateCurrentLocation(uid, lat, lon)
+	now := time.Now()
+	err := s.cassandraRepo.UpdateCurrentLocation(ctx, uid, lat, lon, now)
 	if err != nil {
 		return fmt.Errorf("failed to update location in Cassandra: %v", err)
 	}
 
 	// Update Redis
-	key := fmt.Sprintf("user:%s", userID)
-	_, err = s.redisClient.GeoAdd(s.ctx, "user_locations", &redis.GeoLocation{
-		Name:      key,
-		Latitude:  lat,
-		Longitude: lon,
-	}).Result()
+	err = s.cache.StorePosition(ctx, userID, lat, lon, now)
 	if err != nil {
 		return fmt.Errorf("failed to update location in Redis: %v", err)
 	}
@@ -0,0 +1,79 @@
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"matching-service/websocket-server/internal/models"
+	"matching-service/websocket-server/pkg/geo"
+	"time"
+)
+
+const (
+	DefaultRadius = 5.0
+	DefaultUnit   = "km"
+)
+
+var ErrInvalidQuery = errors.New("invalid match query")
+
+var validUnits = map[string]bool{"m": true, "km": true, "mi": true, "ft": true}
+
+// normalizeQuery fills in defaults and rejects options Redis cannot serve.
+func normalizeQuery(query models.MatchQuery) (models.MatchQuery, error) {
+	if query.Radius <= 0 {
+		query.Radius = DefaultRadius
+	}
+	if query.Unit == "" {
+		query.Unit = DefaultUnit
+	}
+	if !validUnits[query.Unit] {
+		return query, fmt.Errorf("%w: unit %q, expected one of m, km, mi, ft", ErrInvalidQuery, query.Unit)
+	}
+	if query.MaxResults < 0 || query.DestinationRadius < 0 || query.MaxAge < 0 {
+		return query, fmt.Errorf("%w: max_results, destination_radius and max_age must not be negative", ErrInvalidQuery)
+	}
+	return query, nil
+}
+
+// filterCandidates drops excluded users, stale locations and destinations
+// outside the destination radius before scoring. Locations without an
+// update time are treated as stale when MaxAge is set.
+func filterCandidates(user models.Location, candidates []models.Location, query models.MatchQuery, now time.Time) []models.Location {
+	excluded := make(map[string]bool, len(query.BlockedUsers)+len(query.DeclinedUsers))
+	for _, userID := range query.BlockedUsers {
+		excluded[userID] = true
+	}
+	for _, userID := range query.DeclinedUsers {
+		excluded[userID] = true
+	}
+	maxAge := time.Duration(query.MaxAge) * time.Second
+
+	filtered := make([]models.Location, 0, len(candidates))
+	for _, candidate := range candidates {
+		if excluded[candidate.UserId] {
+			continue
+		}
+		if maxAge > 0 && now.Sub(candidate.UpdatedAt) > maxAge {
+			continue
+		}
+		if query.DestinationRadius > 0 && geo.Distance(user.DestinationLatitude, user.DestinationLongitude,
+			candidate.DestinationLatitude, candidate.DestinationLongitude) > query.DestinationRadius {
+			continue
+		}
+		filtered = append(filtered, candidate)
+	}
+	return filtered
+}
+
+// applyLimits drops matches under the minimum score and caps the result size.
+func applyLimits(matches []models.Match, query models.MatchQuery) []models.Match {
+	limited := matches[:0]
+	for _, match := range matches {
+		if match.Score >= query.MinScore {
+			limited = append(limited, match)
+		}
+	}
+	if query.MaxResults > 0 && len(limited) > query.MaxResults {
+		limited = limited[:query.MaxResults]
+	}
+	return limited
+}
@@ -0,0 +1,101 @@
+package matcher
+
+import (
+	"matching-service/websocket-server/internal/models"
+	"matching-service/websocket-server/pkg/geo"
+	"math"
+	"sort"
+)
+
+// Trips shorter than this have no meaningful heading.
+const minTripForBearing = 50.0 // meters
+
+var DefaultCriteria = models.MatchCriteria{
+	MaxPickupDetour:      2000,
+	MaxDropoffDetour:     2000,
+	MaxBearingDifference: 45,
+}
+
+// Weights of each measurement in the final score.
+const (
+	pickupWeight  = 0.35
+	dropoffWeight = 0.35
+	bearingWeight = 0.3
+)
+
+func withDefaults(criteria models.MatchCriteria) models.MatchCriteria {
+	if criteria.MaxPickupDetour <= 0 {
+		criteria.MaxPickupDetour = DefaultCriteria.MaxPickupDetour
+	}
+	if criteria.MaxDropoffDetour <= 0 {
+		criteria.MaxDropoffDetour = DefaultCriteria.MaxDropoffDetour
+	}
+	if criteria.MaxBearingDifference <= 0 {
+		criteria.MaxBearingDifference = DefaultCriteria.MaxBearingDifference
+	}
+	return criteria
+}
+
+// ScoreCandidate compares the user's trip with a candidate's as if the user
+// drove A.origin -> B.origin -> B.destination -> A.destination:
+//
+//   - pickup detour is the extra distance of going through B's origin
+//     instead of straight to A's destination
+//   - drop-off detour is the extra distance of going through B's
+//     destination from B's origin instead of straight to A's destination
+//   - bearing difference is the angle between the two origin->destination
+//     headings
+//
+// Together the two detours add up to the total extra distance driven. The
+// candidate is rejected if any measurement exceeds its threshold.
+func ScoreCandidate(user, candidate models.Location, criteria models.MatchCriteria) (models.Match, bool) {
+	criteria = withDefaults(criteria)
+
+	direct := geo.Distance(user.CurrentLatitude, user.CurrentLongitude, user.DestinationLatitude, user.DestinationLongitude)
+	toPickup := geo.Distance(user.CurrentLatitude, user.CurrentLongitude, candidate.CurrentLatitude, candidate.CurrentLongitude)
+	pickupToUserDest := geo.Distance(candidate.CurrentLatitude, candidate.CurrentLongitude, user.DestinationLatitude, user.DestinationLongitude)
+	candidateTrip := geo.Distance(candidate.CurrentLatitude, candidate.CurrentLongitude, candidate.DestinationLatitude, candidate.DestinationLongitude)
+	dropoffToUserDest := geo.Distance(candidate.DestinationLatitude, candidate.DestinationLongitude, user.DestinationLatitude, user.DestinationLongitude)
+
+	match := models.Match{
+		Location:      candidate,
+		PickupDetour:  math.Max(0, toPickup+pickupToUserDest-direct),
+		DropoffDetour: math.Max(0, candidateTrip+dropoffToUserDest-pickupToUserDest),
+	}
+
+	if direct >= minTripForBearing && candidateTrip >= minTripForBearing {
+		match.BearingDifference = geo.BearingDifference(
+			geo.Bearing(user.CurrentLatitude, user.CurrentLongitude, user.DestinationLatitude, user.DestinationLongitude),
+			geo.Bearing(candidate.CurrentLatitude, candidate.CurrentLongitude, candidate.DestinationLatitude, candidate.DestinationLongitude),
+		)
+	}
+
+	if match.PickupDetour > criteria.MaxPickupDetour ||
+		match.DropoffDetour > criteria.MaxDropoffDetour ||
+		match.BearingDifference > criteria.MaxBearingDifference {
+		return match, false
+	}
+
+	match.Score = pickupWeight*(1-match.PickupDetour/criteria.MaxPickupDetour) +
+		dropoffWeight*(1-match.DropoffDetour/criteria.MaxDropoffDetour) +
+		bearingWeight*(1-match.BearingDifference/criteria.MaxBearingDifference)
+	return match, true
+}
+
+// RankCandidates scores every candidate and returns the accepted ones, best first.
+func RankCandidates(user models.Location, candidates []models.Location, criteria models.MatchCriteria) []models.Match {
+	matches := []models.Match{}
+	for _, candidate := range candidates {
+		if candidate.UserId == user.UserId {
+			continue
+		}
+		if match, ok := ScoreCandidate(user, candidate, criteria); ok {
+			matches = append(matches, match)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	return matches
+}
@@ -0,0 +1,73 @@
+package matcher
+
+import (
+	"context"
+	"log"
+	"matching-service/websocket-server/internal/models"
+	"time"
+)
+
+// MatchDiff holds the changes between two consecutive matching runs.
+type MatchDiff struct {
+	Added   []models.Match
+	Removed []string
+}
+
+func (d MatchDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// DiffMatches compares the current matches against the previous run, keyed
+// by user ID, and returns the diff along with the new set to diff against.
+func DiffMatches(previous map[string]models.Match, current []models.Match) (MatchDiff, map[string]models.Match) {
+	var diff MatchDiff
+	next := make(map[string]models.Match, len(current))
+	for _, match := range current {
+		next[match.UserId] = match
+		if _, ok := previous[match.UserId]; !ok {
+			diff.Added = append(diff.Added, match)
+		}
+	}
+	for userID := range previous {
+		if _, ok := next[userID]; !ok {
+			diff.Removed = append(diff.Removed, userID)
+		}
+	}
+	return diff, next
+}
+
+// WatchMatches re-runs matching for the user whenever trigger fires (the
+// user's own location changed) and every interval (to pick up nearby users
+// moving), and passes each non-empty diff to emit. The first run reports
+// every current match as added. It returns when ctx is done or emit fails.
+func (s *MatcherService) WatchMatches(ctx context.Context, userID string, query models.MatchQuery, interval time.Duration, trigger <-chan struct{}, emit func(MatchDiff) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	previous := map[string]models.Match{}
+	for {
+		matches, err := s.FindPossibleMatches(ctx, userID, query)
+		if ctx.Err() != nil {
+			return
+		} else if err != nil {
+			log.Printf("Failed to refresh matches for user %s: %v", userID, err)
+		} else {
+			var diff MatchDiff
+			diff, previous = DiffMatches(previous, matches)
+			if !diff.Empty() {
+				if err := emit(diff); err != nil {
+					log.Printf("Stopping match stream for user %s: %v", userID, err)
+					return
+				}
+			}
+		}
+
+		select {
+		case <-trigger:
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Printf("Stopping match stream for user %s", userID)
+			return
+		}
+	}
+}
@@ -14,14 +14,79 @@ type Location struct {
 	UpdatedAt            time.Time `json:"updated_at"`
 }
 
+// LocationPoint is one entry of a user's location history.
+type LocationPoint struct {
+	UserId               string    `json:"user_id"`
+	Latitude             float64   `json:"latitude"`
+	Longitude            float64   `json:"longitude"`
+	DestinationLatitude  float64   `json:"destination_latitude"`
+	DestinationLongitude float64   `json:"destination_longitude"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+// WebSocketMessage is the flat frame of clients that do not negotiate a
+// versioned subprotocol; see protocol.LegacyCodec.
 type WebSocketMessage struct {
-	Action               string    `json:"action"` // Create, Update, Delete, etc.
-	UserID               string    `json:"user_id,omitempty"`
-	Latitude             float64   `json:"current_latitude,omitempty"`
-	Longitude            float64   `json:"current_longitude,omitempty"`
-	DestinationLatitude  float64   `json:"destination_latitude,omitempty"`
-	DestinationLongitude float64   `json:"destination_longitude,omitempty"`
-	CreatedAt            time.Time `json:"created_at,omitempty"`
-	UpdatedAt            time.Time `json:"updated_at,omitempty"`
-	Error                string    `json:"error,omitempty"`
+	Action               string          `json:"action"`               // Create, Update, Delete, etc.
+	RequestID            string          `json:"request_id,omitempty"` // set by the client, echoed in the reply
+	UserID               string          `json:"user_id,omitempty"`
+	Latitude             float64         `json:"current_latitude,omitempty"`
+	Longitude            float64         `json:"current_longitude,omitempty"`
+	DestinationLatitude  float64         `json:"destination_latitude,omitempty"`
+	DestinationLongitude float64         `json:"destination_longitude,omitempty"`
+	CreatedAt            time.Time       `json:"created_at,omitempty"`
+	UpdatedAt            time.Time       `json:"updated_at,omitempty"`
+	Radius               float64         `json:"radius,omitempty"` // km, shorthand for query.radius
+	Query                *MatchQuery     `json:"query,omitempty"`  // for find_matches and subscribe_matches
+	Matches              []Match         `json:"matches,omitempty"`
+	Added                []Match         `json:"added,omitempty"`
+	Removed              []string        `json:"removed,omitempty"`
+	From                 time.Time       `json:"from,omitempty"` // for get_trajectory
+	To                   time.Time       `json:"to,omitempty"`
+	PageSize             int             `json:"page_size,omitempty"`
+	PageToken            string          `json:"page_token,omitempty"`
+	Points               []LocationPoint `json:"points,omitempty"`
+	Code                 string          `json:"code,omitempty"`   // apperror code of an error frame
+	Reason               string          `json:"reason,omitempty"` // narrows Code down, e.g. implausible_jump
+	Error                string          `json:"error,omitempty"`
+}
+
+// MatchCriteria holds the per-request thresholds a candidate trip must meet.
+// Zero values fall back to the matcher defaults.
+type MatchCriteria struct {
+	MaxPickupDetour      float64 `json:"max_pickup_detour,omitempty"`      // meters
+	MaxDropoffDetour     float64 `json:"max_dropoff_detour,omitempty"`     // meters
+	MaxBearingDifference float64 `json:"max_bearing_difference,omitempty"` // degrees
+}
+
+// MatchQuery holds the options of a single matching request. Zero values
+// fall back to the matcher defaults.
+type MatchQuery struct {
+	Radius            float64  `json:"radius,omitempty"`
+	Unit              string   `json:"unit,omitempty"` // m, km, mi or ft
+	MaxResults        int      `json:"max_results,omitempty"`
+	DestinationRadius float64  `json:"destination_radius,omitempty"` // meters between destinations
+	MinScore          float64  `json:"min_score,omitempty"`
+	BlockedUsers      []string `json:"blocked_users,omitempty"`
+	DeclinedUsers     []string `json:"declined_users,omitempty"`
+	MaxAge            int      `json:"max_age,omitempty"` // seconds, older locations are ignored
+	MatchCriteria
+}
+
+// Match is a candidate whose trip is compatible with the user's, with the
+// measurements it was scored on. Score is in [0, 1], higher is better.
+type Match struct {
+	Location
+	Score             float64 `json:"score"`
+	PickupDetour      float64 `json:"pickup_detour"`      // meters
+	DropoffDetour     float64 `json:"dropoff_detour"`     // meters
+	BearingDifference float64 `json:"bearing_difference"` // degrees
+}
+
+// Presence tells whether a user has an open connection, and when they last
+// had one.
+type Presence struct {
+	UserId   string    `json:"user_id"`
+	Online   bool      `json:"online"`
+	LastSeen time.Time `json:"last_seen"`
 }
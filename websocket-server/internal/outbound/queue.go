@@ -0,0 +1,155 @@
+// Package outbound queues the messages waiting to be written to one
+// WebSocket connection, so any goroutine can send while a single writer
+// drains the queue.
+package outbound
+
+import (
+	"errors"
+	"matching-service/websocket-server/internal/config"
+	"matching-service/websocket-server/internal/protocol"
+	"sync"
+)
+
+type Priority int
+
+const (
+	// Reply is a response to the client's own request. Replies are written
+	// before any push and are never dropped.
+	Reply Priority = iota
+	// Push is an update the server sends on its own, like match updates.
+	Push
+)
+
+var (
+	ErrClosed       = errors.New("connection closed")
+	ErrSlowConsumer = errors.New("slow consumer")
+)
+
+type message struct {
+	response protocol.Response
+	key      string
+}
+
+// Queue is a bounded two-priority queue. Pushes queued with the same key
+// coalesce: a newer one replaces the queued one in place, e.g. so only the
+// latest position of a user is written.
+type Queue struct {
+	mu         sync.Mutex
+	replies    []*message
+	pushes     []*message
+	byKey      map[string]*message
+	size       int
+	policy     config.SlowConsumerPolicy
+	closed     bool
+	overflowed bool
+	dropped    int
+	ready      chan struct{}
+}
+
+func NewQueue(size int, policy config.SlowConsumerPolicy) *Queue {
+	return &Queue{
+		byKey:  map[string]*message{},
+		size:   size,
+		policy: policy,
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+// Send queues a message. It returns ErrSlowConsumer when the queue is full
+// and the message cannot be dropped, after which the queue is closed.
+func (q *Queue) Send(priority Priority, response protocol.Response, key string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+
+	if priority == Push && key != "" {
+		if queued, ok := q.byKey[key]; ok {
+			queued.response = response
+			return nil
+		}
+	}
+
+	queue := &q.replies
+	if priority == Push {
+		queue = &q.pushes
+	}
+	if len(*queue) >= q.size {
+		if priority == Reply || q.policy != config.DropOldest {
+			q.closed = true
+			q.overflowed = true
+			q.signal()
+			return ErrSlowConsumer
+		}
+		oldest := q.pushes[0]
+		q.pushes = q.pushes[1:]
+		if oldest.key != "" {
+			delete(q.byKey, oldest.key)
+		}
+		q.dropped++
+	}
+
+	queued := &message{response: response, key: key}
+	*queue = append(*queue, queued)
+	if priority == Push && key != "" {
+		q.byKey[key] = queued
+	}
+	q.signal()
+	return nil
+}
+
+func (q *Queue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Ready receives a value whenever messages were queued since the last
+// receive. Drain the queue with Next after each one.
+func (q *Queue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Next returns the next message to write, replies first.
+func (q *Queue) Next() (protocol.Response, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var next *message
+	switch {
+	case len(q.replies) > 0:
+		next, q.replies = q.replies[0], q.replies[1:]
+	case len(q.pushes) > 0:
+		next, q.pushes = q.pushes[0], q.pushes[1:]
+		if next.key != "" {
+			delete(q.byKey, next.key)
+		}
+	default:
+		return protocol.Response{}, false
+	}
+	return next.response, true
+}
+
+// Overflowed reports whether the queue was closed because the client fell
+// behind.
+func (q *Queue) Overflowed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.overflowed
+}
+
+// Dropped returns how many pushes were dropped to make room.
+func (q *Queue) Dropped() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// Close makes every later Send fail with ErrClosed.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+}
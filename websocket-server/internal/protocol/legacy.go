@@ -0,0 +1,109 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"matching-service/websocket-server/internal/apperror"
+	"matching-service/websocket-server/internal/models"
+	"time"
+)
+
+// LegacyCodec speaks the flat models.WebSocketMessage used before the
+// envelope existed. It stays lenient, as it always was, and is kept until
+// the last clients move to SubprotocolV1.
+type LegacyCodec struct{}
+
+func (LegacyCodec) Decode(data []byte) (Request, error) {
+	var message models.WebSocketMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return Request{}, apperror.Wrap(apperror.CodeValidation, "Malformed message", err)
+	}
+	request := Request{Type: message.Action, RequestID: message.RequestID}
+
+	switch message.Action {
+	case TypeCreate, TypeUpdate:
+		request.Payload = &LocationPayload{
+			Position:    Position{Latitude: message.Latitude, Longitude: message.Longitude},
+			Destination: Position{Latitude: message.DestinationLatitude, Longitude: message.DestinationLongitude},
+			Timestamp:   optionalTime(message.UpdatedAt),
+		}
+	case TypeUpdateDestination:
+		request.Payload = &DestinationPayload{
+			Destination: Position{Latitude: message.DestinationLatitude, Longitude: message.DestinationLongitude},
+		}
+	case TypeUpdateCurrentLocation:
+		request.Payload = &PositionPayload{
+			Position:  Position{Latitude: message.Latitude, Longitude: message.Longitude},
+			Timestamp: optionalTime(message.UpdatedAt),
+		}
+	case TypeFindMatches, TypeSubscribeMatches:
+		query := legacyMatchQuery(message)
+		request.Payload = &query
+	case TypeGetTrajectory:
+		request.Payload = &TrajectoryQuery{
+			From:      optionalTime(message.From),
+			To:        optionalTime(message.To),
+			PageSize:  message.PageSize,
+			PageToken: message.PageToken,
+		}
+	case TypeGetLocation:
+		request.Payload = &LocationQuery{UserID: message.UserID}
+	case TypeDelete, TypeUnsubscribeMatches, TypeSubscribeFriends, TypeUnsubscribeFriends:
+		request.Payload = &Empty{}
+	default:
+		return request, apperror.New(apperror.CodeValidation, fmt.Sprintf("unknown action %q", message.Action))
+	}
+	return request, nil
+}
+
+// legacyMatchQuery reads the query of a matching action. A top-level radius
+// is accepted as a shorthand, in km.
+func legacyMatchQuery(message models.WebSocketMessage) models.MatchQuery {
+	var query models.MatchQuery
+	if message.Query != nil {
+		query = *message.Query
+	}
+	if query.Radius <= 0 && message.Radius > 0 {
+		query.Radius = message.Radius
+		query.Unit = "km"
+	}
+	return query
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (LegacyCodec) Encode(response Response) ([]byte, error) {
+	message := models.WebSocketMessage{Action: response.Type, RequestID: response.RequestID}
+
+	switch payload := response.Payload.(type) {
+	case ErrorPayload:
+		message.Code = payload.Code
+		message.Reason = payload.Reason
+		message.Error = payload.Message
+	case MatchesPayload:
+		message.Matches = payload.Matches
+	case MatchUpdatePayload:
+		message.Added = payload.Added
+		message.Removed = payload.Removed
+	case TrajectoryPayload:
+		message.Points = payload.Points
+		message.PageToken = payload.PageToken
+	case models.Location:
+		message.UserID = payload.UserId
+		message.Latitude = payload.CurrentLatitude
+		message.Longitude = payload.CurrentLongitude
+		message.DestinationLatitude = payload.DestinationLatitude
+		message.DestinationLongitude = payload.DestinationLongitude
+		message.CreatedAt = payload.CreatedAt
+		message.UpdatedAt = payload.UpdatedAt
+	case Empty, nil:
+	default:
+		return nil, fmt.Errorf("legacy codec cannot encode %T", response.Payload)
+	}
+	return json.Marshal(message)
+}
@@ -0,0 +1,123 @@
+package protocol
+
+import (
+	"matching-service/websocket-server/internal/models"
+	"time"
+)
+
+// Request types.
+const (
+	TypeCreate                = "create"
+	TypeUpdate                = "update"
+	TypeDelete                = "delete"
+	TypeUpdateDestination     = "update_destination"
+	TypeUpdateCurrentLocation = "update_current_location"
+	TypeFindMatches           = "find_matches"
+	TypeSubscribeMatches      = "subscribe_matches"
+	TypeUnsubscribeMatches    = "unsubscribe_matches"
+	TypeGetTrajectory         = "get_trajectory"
+	TypeGetLocation           = "get_location"
+	TypeSubscribeFriends      = "subscribe_friends"
+	TypeUnsubscribeFriends    = "unsubscribe_friends"
+)
+
+// Response types.
+const (
+	TypeAck         = "ack"
+	TypeError       = "error"
+	TypeMatches     = "matches"
+	TypeMatchUpdate = "match_update"
+	TypeTrajectory  = "trajectory"
+	TypeLocation    = "location"
+	// TypeFriendLocation is pushed when a friend's location changes, with
+	// the request ID of the subscribe_friends request.
+	TypeFriendLocation = "friend_location"
+)
+
+// Position is a point in degrees. Both fields are required, so 0 is a
+// valid coordinate rather than "not set".
+type Position struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Empty is the payload of messages that carry no data.
+type Empty struct{}
+
+// LocationPayload replaces the user's whole location (create, update).
+// Timestamp is when the position was taken, if the client knows; it may
+// not be ahead of the server clock or more than a few minutes old.
+type LocationPayload struct {
+	Position    Position   `json:"position"`
+	Destination Position   `json:"destination"`
+	Timestamp   *time.Time `json:"timestamp,omitempty"`
+}
+
+type DestinationPayload struct {
+	Destination Position `json:"destination"`
+}
+
+type PositionPayload struct {
+	Position  Position   `json:"position"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+}
+
+// TrajectoryQuery pages through the user's own history. From and To default
+// to the last 24 hours.
+type TrajectoryQuery struct {
+	From      *time.Time `json:"from,omitempty"`
+	To        *time.Time `json:"to,omitempty"`
+	PageSize  int        `json:"page_size,omitempty"`
+	PageToken string     `json:"page_token,omitempty"`
+}
+
+type LocationQuery struct {
+	UserID string `json:"user_id"`
+}
+
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Reason  string `json:"reason,omitempty"` // e.g. implausible_jump for a validation error
+	Message string `json:"message"`
+}
+
+type MatchesPayload struct {
+	Matches []models.Match `json:"matches"`
+}
+
+type MatchUpdatePayload struct {
+	Added   []models.Match `json:"added"`
+	Removed []string       `json:"removed"`
+}
+
+type TrajectoryPayload struct {
+	Points    []models.LocationPoint `json:"points"`
+	PageToken string                 `json:"page_token,omitempty"`
+}
+
+// RequestTypes maps each request type to a constructor of its payload.
+var RequestTypes = map[string]func() interface{}{
+	TypeCreate:                func() interface{} { return &LocationPayload{} },
+	TypeUpdate:                func() interface{} { return &LocationPayload{} },
+	TypeDelete:                func() interface{} { return &Empty{} },
+	TypeUpdateDestination:     func() interface{} { return &DestinationPayload{} },
+	TypeUpdateCurrentLocation: func() interface{} { return &PositionPayload{} },
+	TypeFindMatches:           func() interface{} { return &models.MatchQuery{} },
+	TypeSubscribeMatches:      func() interface{} { return &models.MatchQuery{} },
+	TypeUnsubscribeMatches:    func() interface{} { return &Empty{} },
+	TypeGetTrajectory:         func() interface{} { return &TrajectoryQuery{} },
+	TypeGetLocation:           func() interface{} { return &LocationQuery{} },
+	TypeSubscribeFriends:      func() interface{} { return &Empty{} },
+	TypeUnsubscribeFriends:    func() interface{} { return &Empty{} },
+}
+
+// ResponseTypes maps each response type to an example of its payload.
+var ResponseTypes = map[string]interface{}{
+	TypeAck:            Empty{},
+	TypeError:          ErrorPayload{},
+	TypeMatches:        MatchesPayload{},
+	TypeMatchUpdate:    MatchUpdatePayload{},
+	TypeTrajectory:     TrajectoryPayload{},
+	TypeLocation:       models.Location{},
+	TypeFriendLocation: models.Location{},
+}
@@ -0,0 +1,63 @@
+// Package protocol defines the messages of the WebSocket API and how they are
+// framed on the wire. Clients pick a framing through Sec-WebSocket-Protocol:
+//
+//	proximity.v1  versioned envelope {"v", "type", "request_id", "payload"}
+//	              with one payload type per message type, decoded strictly
+//	(none)        the legacy flat models.WebSocketMessage
+//
+// Handlers only see Request and Response, so a new version only needs a new
+// Codec.
+package protocol
+
+//go:generate go run ../../cmd/protocol_schema -out ../../docs/asyncapi.json
+
+const (
+	// Version1 is the envelope version of SubprotocolV1.
+	Version1      = 1
+	SubprotocolV1 = "proximity.v1"
+)
+
+// Subprotocols lists the framings the server offers, preferred first.
+var Subprotocols = []string{SubprotocolV1}
+
+// Envelope is the v1 wire format of every message in both directions.
+type Envelope struct {
+	V         int         `json:"v"`
+	Type      string      `json:"type"`
+	RequestID string      `json:"request_id,omitempty"`
+	Payload   interface{} `json:"payload"`
+}
+
+// Request is a decoded client message. Payload is a pointer to the type
+// registered for Type in RequestTypes.
+type Request struct {
+	Type      string
+	RequestID string
+	Payload   interface{}
+}
+
+// Response is a server message. Payload is a value of the type registered
+// for Type in ResponseTypes.
+type Response struct {
+	Type      string
+	RequestID string
+	Payload   interface{}
+}
+
+// Codec converts between wire frames and requests/responses. Decode fills
+// in the request ID even when it fails, so the error can be correlated.
+type Codec interface {
+	Decode(data []byte) (Request, error)
+	Encode(response Response) ([]byte, error)
+}
+
+// CodecFor returns the codec of a negotiated subprotocol. Anything else,
+// including "bearer" and no subprotocol at all, gets the legacy framing.
+func CodecFor(subprotocol string) Codec {
+	switch subprotocol {
+	case SubprotocolV1:
+		return V1Codec{}
+	default:
+		return LegacyCodec{}
+	}
+}
@@ -0,0 +1,151 @@
+package protocol
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+type jsonField struct {
+	name     string
+	typ      reflect.Type
+	required bool
+}
+
+// jsonFields lists the JSON fields of a struct as encoding/json sees them,
+// with embedded structs flattened. A field is required unless it is a
+// pointer or tagged omitempty.
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(f.Type)...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, jsonField{
+			name:     name,
+			typ:      f.Type,
+			required: f.Type.Kind() != reflect.Ptr && !strings.Contains(options, "omitempty"),
+		})
+	}
+	return fields
+}
+
+// Schema returns the JSON Schema of a payload type, matching what
+// V1Codec accepts.
+func Schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		required := []string{}
+		for _, field := range jsonFields(t) {
+			properties[field.name] = Schema(field.typ)
+			if field.required {
+				required = append(required, field.name)
+			}
+		}
+		schema := map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": Schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": Schema(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{}
+}
+
+func envelopeSchema(messageType string, payload reflect.Type) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"v":          map[string]interface{}{"const": Version1},
+			"type":       map[string]interface{}{"const": messageType},
+			"request_id": map[string]interface{}{"type": "string"},
+			"payload":    Schema(payload),
+		},
+		"required":             []string{"v", "type", "payload"},
+		"additionalProperties": false,
+	}
+}
+
+// AsyncAPI describes the v1 protocol as an AsyncAPI 2.6 document. It is
+// generated into docs/asyncapi.json by cmd/protocol_schema.
+func AsyncAPI() map[string]interface{} {
+	messages := map[string]interface{}{}
+	var requests, responses []interface{}
+
+	for _, name := range sortedKeys(RequestTypes) {
+		messages[name] = map[string]interface{}{
+			"name":    name,
+			"payload": envelopeSchema(name, reflect.TypeOf(RequestTypes[name]())),
+		}
+		requests = append(requests, map[string]interface{}{"$ref": "#/components/messages/" + name})
+	}
+	for _, name := range sortedKeys(ResponseTypes) {
+		messages[name] = map[string]interface{}{
+			"name":    name,
+			"payload": envelopeSchema(name, reflect.TypeOf(ResponseTypes[name])),
+		}
+		responses = append(responses, map[string]interface{}{"$ref": "#/components/messages/" + name})
+	}
+
+	return map[string]interface{}{
+		"asyncapi": "2.6.0",
+		"info": map[string]interface{}{
+			"title":       "Proximity Match WebSocket API",
+			"version":     SubprotocolV1,
+			"description": "Negotiate with Sec-WebSocket-Protocol: " + SubprotocolV1 + ". Replies echo the request_id of the message they answer.",
+		},
+		"defaultContentType": "application/json",
+		"channels": map[string]interface{}{
+			"/location": map[string]interface{}{
+				"publish":   map[string]interface{}{"message": map[string]interface{}{"oneOf": requests}},
+				"subscribe": map[string]interface{}{"message": map[string]interface{}{"oneOf": responses}},
+			},
+		},
+		"components": map[string]interface{}{"messages": messages},
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
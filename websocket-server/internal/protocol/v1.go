@@ -0,0 +1,123 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"matching-service/websocket-server/internal/apperror"
+	"reflect"
+)
+
+// V1Codec frames messages in an Envelope. Decoding is strict: unknown
+// fields, unknown types, a missing payload and missing required fields are
+// all validation errors.
+type V1Codec struct{}
+
+type rawEnvelope struct {
+	V         int             `json:"v"`
+	Type      string          `json:"type"`
+	RequestID string          `json:"request_id,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+func (V1Codec) Decode(data []byte) (Request, error) {
+	var envelope rawEnvelope
+	if err := decodeStrict(data, &envelope); err != nil {
+		// Salvage the request ID so the error can still be correlated
+		json.Unmarshal(data, &envelope)
+		return Request{RequestID: envelope.RequestID}, invalid("malformed envelope", err)
+	}
+	request := Request{Type: envelope.Type, RequestID: envelope.RequestID}
+	if envelope.V != Version1 {
+		return request, apperror.New(apperror.CodeValidation, fmt.Sprintf("unsupported version %d, expected %d", envelope.V, Version1))
+	}
+	newPayload, ok := RequestTypes[envelope.Type]
+	if !ok {
+		return request, apperror.New(apperror.CodeValidation, fmt.Sprintf("unknown type %q", envelope.Type))
+	}
+	if len(envelope.Payload) == 0 || string(envelope.Payload) == "null" {
+		return request, apperror.New(apperror.CodeValidation, "payload is required")
+	}
+
+	payload := newPayload()
+	if err := decodeStrict(envelope.Payload, payload); err != nil {
+		return request, invalid("malformed payload", err)
+	}
+	if err := checkRequired(envelope.Payload, reflect.TypeOf(payload), ""); err != nil {
+		return request, invalid("malformed payload", err)
+	}
+	request.Payload = payload
+	return request, nil
+}
+
+func (V1Codec) Encode(response Response) ([]byte, error) {
+	return json.Marshal(Envelope{
+		V:         Version1,
+		Type:      response.Type,
+		RequestID: response.RequestID,
+		Payload:   response.Payload,
+	})
+}
+
+// DecodeResponse reverses Encode, for server nodes relaying responses to
+// each other. The payload gets the type registered in ResponseTypes, so the
+// response can be re-encoded with any codec.
+func (V1Codec) DecodeResponse(data []byte) (Response, error) {
+	var envelope rawEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return Response{}, fmt.Errorf("malformed envelope: %w", err)
+	}
+	example, ok := ResponseTypes[envelope.Type]
+	if !ok {
+		return Response{}, fmt.Errorf("unknown response type %q", envelope.Type)
+	}
+	payload := reflect.New(reflect.TypeOf(example))
+	if err := json.Unmarshal(envelope.Payload, payload.Interface()); err != nil {
+		return Response{}, fmt.Errorf("malformed %s payload: %w", envelope.Type, err)
+	}
+	return Response{Type: envelope.Type, RequestID: envelope.RequestID, Payload: payload.Elem().Interface()}, nil
+}
+
+func invalid(message string, err error) error {
+	return apperror.Wrap(apperror.CodeValidation, fmt.Sprintf("%s: %v", message, err), err)
+}
+
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return fmt.Errorf("unexpected data after the message")
+	}
+	return nil
+}
+
+// checkRequired reports the first required field of t, at any depth, that
+// is absent or null in data. encoding/json cannot tell those from zero.
+func checkRequired(data json.RawMessage, t reflect.Type, path string) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	for _, field := range jsonFields(t) {
+		raw, ok := fields[field.name]
+		if !ok || string(raw) == "null" {
+			if field.required {
+				return fmt.Errorf("%s%s is required", path, field.name)
+			}
+			continue
+		}
+		if err := checkRequired(raw, field.typ, path+field.name+"."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
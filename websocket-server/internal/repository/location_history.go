@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"matching-service/websocket-server/internal/models"
+	"time"
+)
+
+const (
+	dayLayout              = "2006-01-02"
+	defaultTrajectoryPage  = 500
+	maxTrajectoryPageSize  = 5000
+	maxTrajectoryRangeDays = 31
+)
+
+// ErrInvalidTrajectoryRequest is returned for a bad range or page token.
+var ErrInvalidTrajectoryRequest = errors.New("invalid trajectory request")
+
+// trajectoryCursor is the opaque page token of GetTrajectory: the day
+// partition to continue from and the Cassandra paging state within it.
+type trajectoryCursor struct {
+	Day   string `json:"day"`
+	State []byte `json:"state,omitempty"`
+}
+
+func (r *LocationRepo) AppendHistory(ctx context.Context, point models.LocationPoint) error {
+	query := `
+        INSERT INTO ` + r.Keyspace + `.location_history (
+            user_id, day, updated_at, latitude, longitude,
+            destination_latitude, destination_longitude
+        ) VALUES (?, ?, ?, ?, ?, ?, ?)
+    `
+	q, cancel := r.write(ctx, query,
+		point.UserId,
+		point.UpdatedAt.UTC().Format(dayLayout),
+		point.UpdatedAt,
+		point.Latitude,
+		point.Longitude,
+		point.DestinationLatitude,
+		point.DestinationLongitude,
+	)
+	defer cancel()
+	return q.Exec()
+}
+
+// GetTrajectory returns the user's points between from and to, oldest first,
+// at most pageSize at a time. Pass the returned token back to get the next
+// page; an empty token means the range is exhausted.
+func (r *LocationRepo) GetTrajectory(ctx context.Context, userID string, from time.Time, to time.Time, pageSize int, pageToken string) ([]models.LocationPoint, string, error) {
+	pageSize, err := trajectoryPageSize(from, to, pageSize)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cursor := trajectoryCursor{Day: from.UTC().Format(dayLayout)}
+	if pageToken != "" {
+		cursor, err = decodeTrajectoryCursor(pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	day, err := time.Parse(dayLayout, cursor.Day)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: bad page token: %w", ErrInvalidTrajectoryRequest, err)
+	}
+	lastDay := to.UTC().Truncate(24 * time.Hour)
+
+	query := `
+	SELECT user_id, updated_at, latitude, longitude, destination_latitude, destination_longitude
+	FROM ` + r.Keyspace + `.location_history
+	WHERE user_id = ? AND day = ? AND updated_at >= ? AND updated_at < ?`
+
+	ctx, cancel := context.WithTimeout(ctx, r.Timeouts.CassandraRead)
+	defer cancel()
+
+	points := []models.LocationPoint{}
+	state := cursor.State
+	for !day.After(lastDay) {
+		iter := r.Session.Query(query, userID, day.Format(dayLayout), from, to).
+			WithContext(ctx).
+			PageSize(pageSize - len(points)).
+			PageState(state).
+			Iter()
+		nextState := iter.PageState()
+
+		var point models.LocationPoint
+		for iter.Scan(&point.UserId, &point.UpdatedAt, &point.Latitude, &point.Longitude, &point.DestinationLatitude, &point.DestinationLongitude) {
+			points = append(points, point)
+		}
+		if err := iter.Close(); err != nil {
+			return nil, "", err
+		}
+
+		if len(nextState) > 0 {
+			state = nextState
+		} else {
+			day = day.AddDate(0, 0, 1)
+			state = nil
+		}
+		if len(points) >= pageSize {
+			break
+		}
+	}
+
+	if day.After(lastDay) {
+		return points, "", nil
+	}
+	return points, encodeTrajectoryCursor(trajectoryCursor{Day: day.Format(dayLayout), State: state}), nil
+}
+
+// trajectoryPageSize validates a trajectory range and clamps the page size.
+func trajectoryPageSize(from time.Time, to time.Time, pageSize int) (int, error) {
+	if !from.Before(to) {
+		return 0, fmt.Errorf("%w: from must be before to", ErrInvalidTrajectoryRequest)
+	}
+	if to.Sub(from) > maxTrajectoryRangeDays*24*time.Hour {
+		return 0, fmt.Errorf("%w: at most %d days per request", ErrInvalidTrajectoryRequest, maxTrajectoryRangeDays)
+	}
+	if pageSize <= 0 {
+		pageSize = defaultTrajectoryPage
+	}
+	if pageSize > maxTrajectoryPageSize {
+		pageSize = maxTrajectoryPageSize
+	}
+	return pageSize, nil
+}
+
+func encodeTrajectoryCursor(cursor trajectoryCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeTrajectoryCursor(token string) (trajectoryCursor, error) {
+	var cursor trajectoryCursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor, fmt.Errorf("%w: bad page token: %w", ErrInvalidTrajectoryRequest, err)
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, fmt.Errorf("%w: bad page token: %w", ErrInvalidTrajectoryRequest, err)
+	}
+	return cursor, nil
+}
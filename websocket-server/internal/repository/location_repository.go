@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"context"
+	"matching-service/websocket-server/internal/config"
 	"matching-service/websocket-server/internal/models"
 	"time"
 
@@ -9,46 +11,79 @@ import (
 )
 
 type LocationRepository interface {
-	Create(location models.Location) error
-	GetByUserID(userID string) (models.Location, error)
-	UpdateDestination(userID uuid.UUID, latitude float64, longitude float64) error
-	UpdateCurrentLocation(userID uuid.UUID, latitude float64, longitude float64) error
-	Update(location models.Location) error
-	Delete(userID uuid.UUID) error
-	GetAllLocations() ([]models.Location, error)
+	Create(ctx context.Context, location models.Location) error
+	GetByUserID(ctx context.Context, userID string) (models.Location, error)
+	// UpdateDestination leaves updated_at alone, it is the time of the
+	// current position.
+	UpdateDestination(ctx context.Context, userID uuid.UUID, latitude float64, longitude float64) error
+	// UpdateCurrentLocation stores the position with the time it was taken
+	// at, which later positions are validated against.
+	UpdateCurrentLocation(ctx context.Context, userID uuid.UUID, latitude float64, longitude float64, at time.Time) error
+	Update(ctx context.Context, location models.Location) error
+	Delete(ctx context.Context, userID uuid.UUID) error
+	ScanLocations(ctx context.Context, pageState []byte, pageSize int, fn func(models.Location) error) ([]byte, error)
+	AppendHistory(ctx context.Context, point models.LocationPoint) error
+	GetTrajectory(ctx context.Context, userID string, from time.Time, to time.Time, pageSize int, pageToken string) ([]models.LocationPoint, string, error)
 }
 
 type LocationRepo struct {
 	Session  *gocql.Session
 	Keyspace string
+	Timeouts config.Timeouts
 }
 
-func NewLocationRepo(session *gocql.Session, keyspace string) LocationRepository {
-	return &LocationRepo{Session: session, Keyspace: keyspace}
+func NewLocationRepo(session *gocql.Session, keyspace string, timeouts config.Timeouts) LocationRepository {
+	return &LocationRepo{Session: session, Keyspace: keyspace, Timeouts: timeouts}
 }
 
-func (r *LocationRepo) GetAllLocations() ([]models.Location, error) {
-	var locations []models.Location
+// read and write bind a query to ctx with the configured per-operation
+// deadline. The returned cancel func must be called once the query is done.
+func (r *LocationRepo) read(ctx context.Context, stmt string, values ...interface{}) (*gocql.Query, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, r.Timeouts.CassandraRead)
+	return r.Session.Query(stmt, values...).WithContext(ctx), cancel
+}
+
+func (r *LocationRepo) write(ctx context.Context, stmt string, values ...interface{}) (*gocql.Query, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, r.Timeouts.CassandraWrite)
+	return r.Session.Query(stmt, values...).WithContext(ctx), cancel
+}
+
+// ScanLocations reads one page of the locations table, starting at pageState
+// (nil for the first page), and calls fn for each row. It returns the state
+// of the next page, or nil once the table is exhausted, so a scan can be
+// stopped and resumed later. An error from fn stops the scan.
+func (r *LocationRepo) ScanLocations(ctx context.Context, pageState []byte, pageSize int, fn func(models.Location) error) ([]byte, error) {
 	query := "SELECT user_id, current_latitude, current_longitude, destination_latitude, destination_longitude, created_at, updated_at FROM " + r.Keyspace + ".locations"
-	iter := r.Session.Query(query).Iter()
+	q, cancel := r.read(ctx, query)
+	defer cancel()
+	iter := q.PageSize(pageSize).PageState(pageState).Iter()
+	nextPageState := iter.PageState()
+
 	var loc models.Location
 	for iter.Scan(&loc.UserId, &loc.CurrentLatitude, &loc.CurrentLongitude, &loc.DestinationLatitude, &loc.DestinationLongitude, &loc.CreatedAt, &loc.UpdatedAt) {
-		locations = append(locations, loc)
+		if err := fn(loc); err != nil {
+			iter.Close()
+			return pageState, err
+		}
 	}
 	if err := iter.Close(); err != nil {
-		return nil, err
+		return pageState, err
+	}
+
+	if len(nextPageState) == 0 {
+		return nil, nil
 	}
-	return locations, nil
+	return nextPageState, nil
 }
 
-func (r *LocationRepo) Create(location models.Location) error {
+func (r *LocationRepo) Create(ctx context.Context, location models.Location) error {
 	query := `
         INSERT INTO ` + r.Keyspace + `.locations (
             user_id, current_latitude, current_longitude, 
             destination_latitude, destination_longitude, created_at, updated_at
         ) VALUES (?, ?, ?, ?, ?, ?, ?)
     `
-	err := r.Session.Query(query,
+	q, cancel := r.write(ctx, query,
 		location.UserId,
 		location.CurrentLatitude,
 		location.CurrentLongitude,
@@ -56,19 +91,23 @@ func (r *LocationRepo) Create(location models.Location) error {
 		location.DestinationLongitude,
 		location.CreatedAt,
 		location.UpdatedAt,
-	).Exec()
+	)
+	defer cancel()
 
-	return err
+	return q.Exec()
 }
 
-func (r *LocationRepo) GetByUserID(userID string) (models.Location, error) {
+func (r *LocationRepo) GetByUserID(ctx context.Context, userID string) (models.Location, error) {
 	var location models.Location
 	query := `
 	SELECT user_id, current_latitude, current_longitude, destination_latitude, destination_longitude, created_at, updated_at
 	FROM ` + r.Keyspace + `.locations
 	WHERE user_id = ?`
 
-	err := r.Session.Query(query, userID).Scan(
+	q, cancel := r.read(ctx, query, userID)
+	defer cancel()
+
+	err := q.Scan(
 		&location.UserId,
 		&location.CurrentLatitude,
 		&location.CurrentLongitude,
@@ -80,8 +119,8 @@ func (r *LocationRepo) GetByUserID(userID string) (models.Location, error) {
 	return location, err
 }
 
-func (r *LocationRepo) Update(location models.Location) error {
-	err := r.Session.Query(`
+func (r *LocationRepo) Update(ctx context.Context, location models.Location) error {
+	q, cancel := r.write(ctx, `
         UPDATE locations
         SET current_latitude = ?, current_longitude = ?, destination_latitude = ?, destination_longitude = ?, updated_at = ?
         WHERE user_id = ?`,
@@ -89,43 +128,46 @@ func (r *LocationRepo) Update(location models.Location) error {
 		location.CurrentLongitude,
 		location.DestinationLatitude,
 		location.DestinationLongitude,
-		time.Now(),
+		location.UpdatedAt,
 		location.UserId,
-	).Exec()
-	return err
+	)
+	defer cancel()
+	return q.Exec()
 }
 
-func (r *LocationRepo) Delete(userID uuid.UUID) error {
-	err := r.Session.Query(`
+func (r *LocationRepo) Delete(ctx context.Context, userID uuid.UUID) error {
+	q, cancel := r.write(ctx, `
         DELETE FROM locations
         WHERE user_id = ?`,
 		userID,
-	).Exec()
-	return err
+	)
+	defer cancel()
+	return q.Exec()
 }
 
-func (r *LocationRepo) UpdateDestination(userID uuid.UUID, latitude float64, longitude float64) error {
-	err := r.Session.Query(`
+func (r *LocationRepo) UpdateDestination(ctx context.Context, userID uuid.UUID, latitude float64, longitude float64) error {
+	q, cancel := r.write(ctx, `
 		UPDATE locations
-		SET destination_latitude = ?, destination_longitude = ?, updated_at = ?
+		SET destination_latitude = ?, destination_longitude = ?
 		WHERE user_id = ?`,
 		latitude,
 		longitude,
-		time.Now(),
 		userID,
-	).Exec()
-	return err
+	)
+	defer cancel()
+	return q.Exec()
 }
 
-func (r *LocationRepo) UpdateCurrentLocation(userID uuid.UUID, latitude float64, longitude float64) error {
-	err := r.Session.Query(`
+func (r *LocationRepo) UpdateCurrentLocation(ctx context.Context, userID uuid.UUID, latitude float64, longitude float64, at time.Time) error {
+	q, cancel := r.write(ctx, `
 		UPDATE locations
 		SET current_latitude = ?, current_longitude = ?, updated_at = ?
 		WHERE user_id = ?`,
 		latitude,
 		longitude,
-		time.Now(),
+		at,
 		userID,
-	).Exec()
-	return err
+	)
+	defer cancel()
+	return q.Exec()
 }
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"matching-service/websocket-server/internal/models"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+// MemoryLocationRepo is a thread-safe in-memory LocationRepository for tests
+// and local development. It mirrors the Cassandra behaviour the rest of the
+// server relies on: updates are upserts, a missing user is gocql.ErrNotFound
+// and timestamps are stored with millisecond precision.
+type MemoryLocationRepo struct {
+	mu        sync.RWMutex
+	locations map[string]models.Location
+	history   map[string]map[time.Time]models.LocationPoint
+}
+
+func NewMemoryLocationRepo() LocationRepository {
+	return &MemoryLocationRepo{
+		locations: map[string]models.Location{},
+		history:   map[string]map[time.Time]models.LocationPoint{},
+	}
+}
+
+func cassandraTime(t time.Time) time.Time {
+	return t.Truncate(time.Millisecond).UTC()
+}
+
+func (r *MemoryLocationRepo) Create(ctx context.Context, location models.Location) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	location.CreatedAt = cassandraTime(location.CreatedAt)
+	location.UpdatedAt = cassandraTime(location.UpdatedAt)
+	r.locations[location.UserId] = location
+	return nil
+}
+
+func (r *MemoryLocationRepo) GetByUserID(ctx context.Context, userID string) (models.Location, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Location{}, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	location, ok := r.locations[userID]
+	if !ok {
+		return models.Location{}, gocql.ErrNotFound
+	}
+	return location, nil
+}
+
+// upsert applies fn to the stored location, creating it like a Cassandra
+// UPDATE would when the user has no row yet.
+func (r *MemoryLocationRepo) upsert(ctx context.Context, userID string, fn func(*models.Location)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	location := r.locations[userID]
+	location.UserId = userID
+	fn(&location)
+	r.locations[userID] = location
+	return nil
+}
+
+func (r *MemoryLocationRepo) UpdateDestination(ctx context.Context, userID uuid.UUID, latitude float64, longitude float64) error {
+	return r.upsert(ctx, userID.String(), func(location *models.Location) {
+		location.DestinationLatitude = latitude
+		location.DestinationLongitude = longitude
+	})
+}
+
+func (r *MemoryLocationRepo) UpdateCurrentLocation(ctx context.Context, userID uuid.UUID, latitude float64, longitude float64, at time.Time) error {
+	return r.upsert(ctx, userID.String(), func(location *models.Location) {
+		location.CurrentLatitude = latitude
+		location.CurrentLongitude = longitude
+		location.UpdatedAt = cassandraTime(at)
+	})
+}
+
+func (r *MemoryLocationRepo) Update(ctx context.Context, location models.Location) error {
+	return r.upsert(ctx, location.UserId, func(stored *models.Location) {
+		stored.CurrentLatitude = location.CurrentLatitude
+		stored.CurrentLongitude = location.CurrentLongitude
+		stored.DestinationLatitude = location.DestinationLatitude
+		stored.DestinationLongitude = location.DestinationLongitude
+		stored.UpdatedAt = cassandraTime(location.UpdatedAt)
+	})
+}
+
+func (r *MemoryLocationRepo) Delete(ctx context.Context, userID uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.locations, userID.String())
+	return nil
+}
+
+// ScanLocations pages through users in ID order. The page state is the last
+// user ID returned, so a scan survives concurrent inserts and deletes.
+func (r *MemoryLocationRepo) ScanLocations(ctx context.Context, pageState []byte, pageSize int, fn func(models.Location) error) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return pageState, err
+	}
+	r.mu.RLock()
+	userIDs := make([]string, 0, len(r.locations))
+	for userID := range r.locations {
+		if userID > string(pageState) {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Strings(userIDs)
+	more := len(userIDs) > pageSize
+	if more {
+		userIDs = userIDs[:pageSize]
+	}
+	page := make([]models.Location, len(userIDs))
+	for i, userID := range userIDs {
+		page[i] = r.locations[userID]
+	}
+	r.mu.RUnlock()
+
+	for _, location := range page {
+		if err := fn(location); err != nil {
+			return pageState, err
+		}
+	}
+
+	if !more {
+		return nil, nil
+	}
+	return []byte(page[len(page)-1].UserId), nil
+}
+
+func (r *MemoryLocationRepo) AppendHistory(ctx context.Context, point models.LocationPoint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	point.UpdatedAt = cassandraTime(point.UpdatedAt)
+	if r.history[point.UserId] == nil {
+		r.history[point.UserId] = map[time.Time]models.LocationPoint{}
+	}
+	r.history[point.UserId][point.UpdatedAt] = point
+	return nil
+}
+
+// GetTrajectory pages by time; the page token is the update time of the last
+// point returned.
+func (r *MemoryLocationRepo) GetTrajectory(ctx context.Context, userID string, from time.Time, to time.Time, pageSize int, pageToken string) ([]models.LocationPoint, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	pageSize, err := trajectoryPageSize(from, to, pageSize)
+	if err != nil {
+		return nil, "", err
+	}
+	after := time.Time{}
+	if pageToken != "" {
+		after, err = time.Parse(time.RFC3339Nano, pageToken)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: bad page token: %w", ErrInvalidTrajectoryRequest, err)
+		}
+	}
+
+	r.mu.RLock()
+	points := []models.LocationPoint{}
+	for updatedAt, point := range r.history[userID] {
+		if updatedAt.Before(from) || !updatedAt.Before(to) {
+			continue
+		}
+		if pageToken != "" && !updatedAt.After(after) {
+			continue
+		}
+		points = append(points, point)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].UpdatedAt.Before(points[j].UpdatedAt)
+	})
+	if len(points) <= pageSize {
+		return points, "", nil
+	}
+	points = points[:pageSize]
+	return points, points[len(points)-1].UpdatedAt.Format(time.RFC3339Nano), nil
+}
@@ -0,0 +1,140 @@
+// Package validation checks client-supplied positions and timestamps before
+// they reach Cassandra or Redis.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"matching-service/websocket-server/internal/models"
+	"matching-service/websocket-server/pkg/geo"
+	"math"
+	"time"
+)
+
+// MaxGeoLatitude is the largest latitude Redis GEOADD accepts.
+const MaxGeoLatitude = 85.05112878
+
+// Reasons a value is rejected. Every error returned by a Validator wraps
+// one of them, so callers can tell them apart with errors.Is.
+var (
+	ErrNotANumber      = errors.New("not_a_number")
+	ErrOutOfRange      = errors.New("out_of_range")
+	ErrNullIsland      = errors.New("null_island")
+	ErrImplausibleJump = errors.New("implausible_jump")
+	ErrClockSkew       = errors.New("clock_skew")
+	ErrTooOld          = errors.New("too_old")
+	ErrOutOfOrder      = errors.New("out_of_order")
+)
+
+// Error is a rejected field with the reason it was rejected.
+type Error struct {
+	Field   string
+	Reason  error
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Reason
+}
+
+func reject(field string, reason error, format string, args ...interface{}) *Error {
+	return &Error{Field: field, Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+type Limits struct {
+	// MaxSpeed is the fastest plausible movement between two points, in m/s.
+	MaxSpeed float64
+	// MinJump is the distance, in meters, under which movement is never
+	// rejected, to absorb GPS jitter.
+	MinJump float64
+	// MaxClockSkew is how far in the future a client timestamp may be.
+	MaxClockSkew time.Duration
+	// MaxAge is how far in the past a client timestamp may be.
+	MaxAge time.Duration
+}
+
+// DefaultLimits allow up to 360 km/h, a client clock 30s ahead and points
+// buffered offline for up to 10 minutes.
+var DefaultLimits = Limits{
+	MaxSpeed:     100,
+	MinJump:      200,
+	MaxClockSkew: 30 * time.Second,
+	MaxAge:       10 * time.Minute,
+}
+
+type Validator struct {
+	limits Limits
+}
+
+func NewValidator(limits Limits) *Validator {
+	return &Validator{limits: limits}
+}
+
+// Position checks a current position: finite, within the Redis GEO bounds
+// and not (0, 0), which is what broken GPS stacks send.
+func (v *Validator) Position(field string, latitude float64, longitude float64) error {
+	return checkCoordinates(field, latitude, longitude, MaxGeoLatitude)
+}
+
+// Destination checks a destination. Destinations are not GEO indexed, so
+// the full latitude range is allowed.
+func (v *Validator) Destination(field string, latitude float64, longitude float64) error {
+	return checkCoordinates(field, latitude, longitude, 90)
+}
+
+func checkCoordinates(field string, latitude float64, longitude float64, maxLatitude float64) error {
+	if math.IsNaN(latitude) || math.IsInf(latitude, 0) || math.IsNaN(longitude) || math.IsInf(longitude, 0) {
+		return reject(field, ErrNotANumber, "coordinates must be finite numbers")
+	}
+	if latitude < -maxLatitude || latitude > maxLatitude {
+		return reject(field+".latitude", ErrOutOfRange, "latitude %v is outside [-%v, %v]", latitude, maxLatitude, maxLatitude)
+	}
+	if longitude < -180 || longitude > 180 {
+		return reject(field+".longitude", ErrOutOfRange, "longitude %v is outside [-180, 180]", longitude)
+	}
+	if latitude == 0 && longitude == 0 {
+		return reject(field, ErrNullIsland, "(0, 0) is not a valid position")
+	}
+	return nil
+}
+
+// Timestamp returns the time of a write: the client's timestamp when given
+// and within the allowed clock skew, the server time otherwise.
+func (v *Validator) Timestamp(field string, timestamp *time.Time) (time.Time, error) {
+	now := time.Now()
+	if timestamp == nil || timestamp.IsZero() {
+		return now, nil
+	}
+	if timestamp.After(now.Add(v.limits.MaxClockSkew)) {
+		return time.Time{}, reject(field, ErrClockSkew, "%v is %v ahead of the server", timestamp.Format(time.RFC3339), timestamp.Sub(now).Round(time.Second))
+	}
+	if timestamp.Before(now.Add(-v.limits.MaxAge)) {
+		return time.Time{}, reject(field, ErrTooOld, "%v is more than %v old", timestamp.Format(time.RFC3339), v.limits.MaxAge)
+	}
+	return *timestamp, nil
+}
+
+// Movement rejects a position the user cannot have reached from the
+// previous one in the time between them. A previous location without a
+// position or time is not checked.
+func (v *Validator) Movement(field string, previous models.Location, latitude float64, longitude float64, at time.Time) error {
+	if previous.UpdatedAt.IsZero() || (previous.CurrentLatitude == 0 && previous.CurrentLongitude == 0) {
+		return nil
+	}
+	if at.Before(previous.UpdatedAt) {
+		return reject(field, ErrOutOfOrder, "%v is before the previous point at %v", at.Format(time.RFC3339), previous.UpdatedAt.Format(time.RFC3339))
+	}
+	distance := geo.Distance(previous.CurrentLatitude, previous.CurrentLongitude, latitude, longitude)
+	if distance <= v.limits.MinJump {
+		return nil
+	}
+	elapsed := math.Max(at.Sub(previous.UpdatedAt).Seconds(), 1)
+	if speed := distance / elapsed; speed > v.limits.MaxSpeed {
+		return reject(field, ErrImplausibleJump, "moved %.0f m in %.0f s (%.0f m/s, at most %.0f m/s)", distance, elapsed, speed, v.limits.MaxSpeed)
+	}
+	return nil
+}
@@ -32,6 +32,11 @@ func Init(keyspace string) {
 	if err != nil {
 		log.Fatalf("Failed to create table: %v", err)
 	}
+
+	err = createHistoryTable(keyspace)
+	if err != nil {
+		log.Fatalf("Failed to create location history table: %v", err)
+	}
 }
 
 func GetSession() *gocql.Session {
@@ -63,3 +68,21 @@ func createTable(keyspace string) error {
 	`
 	return session.Query(query).Exec()
 }
+
+// createHistoryTable keeps every reported point. Partitions are per user and
+// UTC day so that a busy user never grows a single unbounded partition.
+func createHistoryTable(keyspace string) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS ` + keyspace + `.location_history (
+			user_id UUID,
+			day DATE,
+			updated_at TIMESTAMP,
+			latitude DOUBLE,
+			longitude DOUBLE,
+			destination_latitude DOUBLE,
+			destination_longitude DOUBLE,
+			PRIMARY KEY ((user_id, day), updated_at)
+		) WITH CLUSTERING ORDER BY (updated_at ASC);
+	`
+	return session.Query(query).Exec()
+}
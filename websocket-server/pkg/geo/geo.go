@@ -0,0 +1,44 @@
+package geo
+
+import "math"
+
+const EarthRadiusMeters = 6371008.8
+
+func toRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+func toDegrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
+
+// Distance returns the great-circle (haversine) distance in meters.
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := toRadians(lat1), toRadians(lat2)
+	dPhi := toRadians(lat2 - lat1)
+	dLambda := toRadians(lon2 - lon1)
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * EarthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Bearing returns the initial bearing from the first point to the second,
+// in degrees clockwise from north in [0, 360).
+func Bearing(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := toRadians(lat1), toRadians(lat2)
+	dLambda := toRadians(lon2 - lon1)
+
+	y := math.Sin(dLambda) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLambda)
+	return math.Mod(toDegrees(math.Atan2(y, x))+360, 360)
+}
+
+// BearingDifference returns the smallest angle between two bearings, in [0, 180].
+func BearingDifference(a, b float64) float64 {
+	diff := math.Abs(math.Mod(a-b, 360))
+	if diff > 180 {
+		diff = 360 - diff
+	}
+	return diff
+}
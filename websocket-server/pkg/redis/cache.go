@@ -2,109 +2,254 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"matching-service/websocket-server/internal/models"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// ErrNotFound is returned by Getlocation when the user has no cached position.
+var ErrNotFound = errors.New("location not found in cache")
+
 type RedisCacheHandler interface {
-	StoreLocation(location models.Location) (models.Location, error)
-	Getlocation(key string) (models.Location, error)
-	RefreshTTL(key string, ttl time.Duration, interval time.Duration, stopChan chan bool)
+	StoreLocation(ctx context.Context, location models.Location) (models.Location, error)
+	StoreLocations(ctx context.Context, locations []models.Location) error
+	StorePosition(ctx context.Context, userID string, latitude float64, longitude float64, at time.Time) error
+	StoreDestination(ctx context.Context, userID string, latitude float64, longitude float64) error
+	Getlocation(ctx context.Context, key string) (models.Location, error)
+	Nearby(ctx context.Context, latitude float64, longitude float64, radius float64, unit string) ([]models.Location, error)
+	RemoveLocation(ctx context.Context, userID string) error
+	MarkOnline(ctx context.Context, userID string, connectionID string, ttl time.Duration) error
+	MarkOffline(ctx context.Context, userID string, connectionID string) error
+	GetPresence(ctx context.Context, userID string) (models.Presence, error)
+	AddRoute(ctx context.Context, userID string, nodeID string, ttl time.Duration) error
+	RemoveRoute(ctx context.Context, userID string, nodeID string) error
+	GetRoutes(ctx context.Context, userID string) ([]string, error)
+	PublishToNode(ctx context.Context, nodeID string, message []byte) error
+	SubscribeToNode(ctx context.Context, nodeID string, handle func(message []byte)) error
+	PublishLocationUpdate(ctx context.Context, location models.Location) error
+	SubscribeToFriendUpdates(ctx context.Context, userId string, updateChan chan<- models.Location) error
+	AddFriend(ctx context.Context, userId, friendId string) error
+	RemoveFriend(ctx context.Context, userId, friendId string) error
+	GetFriends(ctx context.Context, userId string) ([]string, error)
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
 }
 
 type RedisCache struct {
-	ctx         context.Context
 	redisClient *redis.Client
+	keys        Keys
+	timeout     time.Duration
+}
+
+// NewRedisCache returns a cache whose operations are each bounded by
+// timeout, on top of the deadline of the context passed to them.
+func NewRedisCache(redisClient *redis.Client, timeout time.Duration) RedisCacheHandler {
+	return NewRedisCacheWithKeys(redisClient, DefaultKeys, timeout)
 }
 
-func NewRedisCache(ctx context.Context, redisClient *redis.Client) RedisCacheHandler {
-	return &RedisCache{ctx: ctx, redisClient: redisClient}
+// NewRedisCacheWithKeys is NewRedisCache with a custom key layout, e.g. a
+// prefixed one for tests sharing a Redis instance.
+func NewRedisCacheWithKeys(redisClient *redis.Client, keys Keys, timeout time.Duration) RedisCacheHandler {
+	return &RedisCache{redisClient: redisClient, keys: keys, timeout: timeout}
 }
 
-func (r *RedisCache) Getlocation(key string) (models.Location, error) {
+func (r *RedisCache) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, r.timeout)
+}
+
+func (r *RedisCache) Getlocation(ctx context.Context, key string) (models.Location, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 	location := models.Location{}
-	geoKey := "geo:" + key
-	geoLocation, err := r.redisClient.GeoPos(r.ctx, geoKey, key).Result()
+	geoLocation, err := r.redisClient.GeoPos(ctx, r.keys.Locations(), r.keys.Member(key)).Result()
 	if err == redis.Nil {
-		return location, fmt.Errorf("user %s not found in Redis", key)
+		return location, fmt.Errorf("user %s: %w", key, ErrNotFound)
 	} else if err != nil {
 		return location, fmt.Errorf("error getting user location from Redis: %w", err)
 	}
 
 	if len(geoLocation) == 0 || geoLocation[0] == nil {
-		return location, fmt.Errorf("no geolocation data found for user %s", key)
+		return location, fmt.Errorf("no geolocation data found for user %s: %w", key, ErrNotFound)
 	}
 	location.UserId = key
 	location.CurrentLatitude = geoLocation[0].Latitude
 	location.CurrentLongitude = geoLocation[0].Longitude
 
-	destKey := "dest:" + location.UserId
-	destination, err := r.redisClient.HMGet(r.ctx, destKey, "destination_lat", "destination_lon").Result()
+	destination, err := r.redisClient.HMGet(ctx, r.keys.Destination(location.UserId), destinationFields...).Result()
 	if err == redis.Nil {
 		log.Printf("Destination for user %s not found in Redis\n", key)
 	} else if err != nil {
 		return location, fmt.Errorf("error getting user destination from Redis: %w", err)
-	} else if len(destination) == 2 && destination[0] != nil && destination[1] != nil {
-		location.DestinationLatitude = parseFloat(destination[0])
-		location.DestinationLongitude = parseFloat(destination[1])
+	} else {
+		setDestination(&location, destination)
 	}
 
 	return location, nil
 }
 
+var destinationFields = []string{"destination_lat", "destination_lon", "updated_at"}
+
+// setDestination fills the destination and update time from an HMGET reply
+// of destinationFields. Hash values come back from Redis as strings.
+func setDestination(location *models.Location, destination []interface{}) {
+	if len(destination) != len(destinationFields) {
+		return
+	}
+	if destination[0] != nil && destination[1] != nil {
+		location.DestinationLatitude = parseFloat(destination[0])
+		location.DestinationLongitude = parseFloat(destination[1])
+	}
+	if destination[2] != nil {
+		location.UpdatedAt = time.Unix(int64(parseFloat(destination[2])), 0)
+	}
+}
+
 func parseFloat(v interface{}) float64 {
-	f, _ := v.(float64)
-	return f
+	switch value := v.(type) {
+	case float64:
+		return value
+	case string:
+		f, _ := strconv.ParseFloat(value, 64)
+		return f
+	}
+	return 0
 }
 
 // StoreLocation saves the location in Redis and returns the saved location
-func (r *RedisCache) StoreLocation(location models.Location) (models.Location, error) {
-	var err error
-	currentLocation := redis.GeoLocation{
-		Name:      location.UserId,
+func (r *RedisCache) StoreLocation(ctx context.Context, location models.Location) (models.Location, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		r.storeLocation(ctx, pipe, location)
+		return nil
+	})
+	if err != nil {
+		return models.Location{}, fmt.Errorf("could not store user in Redis: %w", err)
+	}
+
+	log.Printf("Added user %s with current location and destination.\n", location.UserId)
+	return location, nil
+}
+
+// StoreLocations writes a batch of locations in a single pipeline.
+func (r *RedisCache) StoreLocations(ctx context.Context, locations []models.Location) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	if len(locations) == 0 {
+		return nil
+	}
+	_, err := r.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, location := range locations {
+			r.storeLocation(ctx, pipe, location)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not store locations in Redis: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisCache) storeLocation(ctx context.Context, pipe redis.Pipeliner, location models.Location) {
+	pipe.GeoAdd(ctx, r.keys.Locations(), &redis.GeoLocation{
+		Name:      r.keys.Member(location.UserId),
 		Latitude:  location.CurrentLatitude,
 		Longitude: location.CurrentLongitude,
-	}
-	destination := map[string]interface{}{
+	})
+	fields := map[string]interface{}{
 		"destination_lat": location.DestinationLatitude,
 		"destination_lon": location.DestinationLongitude,
 	}
-	geoKey := "geo:" + location.UserId
+	if !location.UpdatedAt.IsZero() {
+		fields["updated_at"] = location.UpdatedAt.Unix()
+	}
+	pipe.HSet(ctx, r.keys.Destination(location.UserId), fields)
+}
 
-	_, err = r.redisClient.GeoAdd(r.ctx, geoKey, &currentLocation).Result()
+// StorePosition moves the user to the position they were at, at time at.
+func (r *RedisCache) StorePosition(ctx context.Context, userID string, latitude float64, longitude float64, at time.Time) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.GeoAdd(ctx, r.keys.Locations(), &redis.GeoLocation{
+			Name:      r.keys.Member(userID),
+			Latitude:  latitude,
+			Longitude: longitude,
+		})
+		pipe.HSet(ctx, r.keys.Destination(userID), "updated_at", at.Unix())
+		return nil
+	})
 	if err != nil {
-		return models.Location{}, fmt.Errorf("could not store user in Redis: %w", err)
+		return fmt.Errorf("could not store position for user %s: %w", userID, err)
 	}
-	r.redisClient.Expire(r.ctx, location.UserId, 60*time.Second)
+	return nil
+}
 
-	destKey := "dest:" + location.UserId
-	err = r.redisClient.HSet(r.ctx, destKey, destination).Err()
+func (r *RedisCache) StoreDestination(ctx context.Context, userID string, latitude float64, longitude float64) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	err := r.redisClient.HSet(ctx, r.keys.Destination(userID), map[string]interface{}{
+		"destination_lat": latitude,
+		"destination_lon": longitude,
+	}).Err()
 	if err != nil {
-		return models.Location{}, fmt.Errorf("error adding destination: %w", err)
+		return fmt.Errorf("could not store destination for user %s: %w", userID, err)
 	}
-
-	log.Printf("Added user %s with current location and destination.\n", location.UserId)
-	return location, nil
+	return nil
 }
 
-func (r *RedisCache) RefreshTTL(key string, ttl time.Duration, interval time.Duration, stopChan chan bool) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	select {
-	case <-ticker.C:
-		err := r.redisClient.Expire(r.ctx, key, ttl).Err()
-		if err != nil {
-			log.Printf("Could not refresh TTL for key %s : %v", key, err)
-		} else {
-			log.Printf("TTL refreshed for key %s", key)
+// Nearby returns every cached user within radius of the point, closest first,
+// with their destinations and last update time filled in. Unit is one of
+// m, km, mi or ft.
+func (r *RedisCache) Nearby(ctx context.Context, latitude float64, longitude float64, radius float64, unit string) ([]models.Location, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	nearby, err := r.redisClient.GeoRadius(ctx, r.keys.Locations(), longitude, latitude, &redis.GeoRadiusQuery{
+		Radius:    radius,
+		Unit:      unit,
+		WithCoord: true,
+		Sort:      "ASC",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find nearby users: %w", err)
+	}
+
+	pipe := r.redisClient.Pipeline()
+	destinations := make([]*redis.SliceCmd, len(nearby))
+	for i, loc := range nearby {
+		destinations[i] = pipe.HMGet(ctx, r.keys.Destination(loc.Name), destinationFields...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get destinations of nearby users: %w", err)
+	}
+
+	locations := make([]models.Location, len(nearby))
+	for i, loc := range nearby {
+		locations[i] = models.Location{
+			UserId:           loc.Name,
+			CurrentLatitude:  loc.Latitude,
+			CurrentLongitude: loc.Longitude,
 		}
-	case <-stopChan:
-		log.Printf("Stopping TTL refresh for key %s", key)
-		return
+		setDestination(&locations[i], destinations[i].Val())
+	}
+	return locations, nil
+}
+
+func (r *RedisCache) RemoveLocation(ctx context.Context, userID string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, r.keys.Locations(), r.keys.Member(userID))
+		pipe.Del(ctx, r.keys.Destination(userID))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not remove user %s from Redis: %w", userID, err)
 	}
+	return nil
 }
@@ -0,0 +1,83 @@
+package redis
+
+// Keys builds every Redis key and channel name used by the websocket-server.
+// All components go through it so that the layout stays in one place:
+//
+//	geo:locations               GEO set of current positions, member = user ID
+//	dest:<user_id>              hash with destination_lat, destination_lon and
+//	                            updated_at (unix seconds of the last write)
+//	friends:<user_id>           set of friend user IDs, kept in sync with
+//	                            Postgres by the api-server's friendsync
+//	friends_changed:<user_id>   pub/sub channel announcing changes to the
+//	                            user's friend set
+//	location_updates:<user_id>  pub/sub channel for a user's location updates
+//	presence:<user_id>          sorted set of the user's open connections,
+//	                            scored by the unix time they expire at
+//	presence:last_seen          sorted set of user IDs scored by the unix
+//	                            time they were last connected
+//	route:<user_id>             sorted set of the server nodes the user is
+//	                            connected to, scored by the unix time the
+//	                            route expires at
+//	node:<node_id>              pub/sub channel of messages for the users
+//	                            connected to a server node
+//	revoked_jti:<jti>           marks a revoked access token until it
+//	                            expires, written by the api-server on logout
+//
+// An optional prefix namespaces the whole layout, e.g. for tests sharing a
+// Redis instance.
+type Keys struct {
+	prefix string
+}
+
+var DefaultKeys = NewKeys("")
+
+func NewKeys(prefix string) Keys {
+	return Keys{prefix: prefix}
+}
+
+// Locations is the single GEO set holding every user's current position.
+func (k Keys) Locations() string {
+	return k.prefix + "geo:locations"
+}
+
+// Member is the name of a user inside the Locations GEO set.
+func (k Keys) Member(userID string) string {
+	return userID
+}
+
+func (k Keys) Destination(userID string) string {
+	return k.prefix + "dest:" + userID
+}
+
+func (k Keys) Friends(userID string) string {
+	return k.prefix + "friends:" + userID
+}
+
+func (k Keys) FriendsChanged(userID string) string {
+	return k.prefix + "friends_changed:" + userID
+}
+
+func (k Keys) LocationUpdates(userID string) string {
+	return k.prefix + "location_updates:" + userID
+}
+
+func (k Keys) Presence(userID string) string {
+	return k.prefix + "presence:" + userID
+}
+
+func (k Keys) LastSeen() string {
+	return k.prefix + "presence:last_seen"
+}
+
+func (k Keys) Routes(userID string) string {
+	return k.prefix + "route:" + userID
+}
+
+func (k Keys) Node(nodeID string) string {
+	return k.prefix + "node:" + nodeID
+}
+
+// RevokedToken is shared with the api-server, which revokes tokens.
+func (k Keys) RevokedToken(jti string) string {
+	return k.prefix + "revoked_jti:" + jti
+}
@@ -0,0 +1,521 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"matching-service/websocket-server/internal/models"
+	"matching-service/websocket-server/pkg/geo"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Redis only accepts GEO positions inside the Web Mercator bounds.
+const maxGeoLatitude = 85.05112878
+
+var unitMeters = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"mi": 1609.344,
+	"ft": 0.3048,
+}
+
+type memoryEntry struct {
+	latitude             float64
+	longitude            float64
+	hasPosition          bool
+	destinationLatitude  float64
+	destinationLongitude float64
+	updatedAt            time.Time
+}
+
+// MemoryCache is a thread-safe in-memory RedisCacheHandler for tests and
+// local development. It keeps the same observable behaviour as RedisCache:
+// update times have second precision and Nearby returns the closest first.
+type MemoryCache struct {
+	mu          sync.RWMutex
+	entries     map[string]*memoryEntry
+	connections map[string]map[string]time.Time // user ID -> connection ID -> expiry
+	lastSeen    map[string]time.Time
+	routes      map[string]map[string]time.Time // user ID -> node ID -> expiry
+	friends     map[string]map[string]struct{}
+	revoked     map[string]time.Time // jti -> expiry
+	subscribers map[string]map[*memorySubscription]struct{}
+}
+
+// memorySubscription buffers the messages of one subscriber so that a
+// publisher does not wait for it to handle them.
+type memorySubscription struct {
+	ctx      context.Context
+	messages chan []byte
+}
+
+func NewMemoryCache() RedisCacheHandler {
+	return &MemoryCache{
+		entries:     map[string]*memoryEntry{},
+		connections: map[string]map[string]time.Time{},
+		lastSeen:    map[string]time.Time{},
+		routes:      map[string]map[string]time.Time{},
+		friends:     map[string]map[string]struct{}{},
+		revoked:     map[string]time.Time{},
+		subscribers: map[string]map[*memorySubscription]struct{}{},
+	}
+}
+
+func validPosition(latitude float64, longitude float64) error {
+	if latitude < -maxGeoLatitude || latitude > maxGeoLatitude || longitude < -180 || longitude > 180 {
+		return fmt.Errorf("invalid longitude,latitude pair %f,%f", longitude, latitude)
+	}
+	return nil
+}
+
+func (m *MemoryCache) entry(userID string) *memoryEntry {
+	e, ok := m.entries[userID]
+	if !ok {
+		e = &memoryEntry{}
+		m.entries[userID] = e
+	}
+	return e
+}
+
+func (m *MemoryCache) location(userID string, e *memoryEntry) models.Location {
+	return models.Location{
+		UserId:               userID,
+		CurrentLatitude:      e.latitude,
+		CurrentLongitude:     e.longitude,
+		DestinationLatitude:  e.destinationLatitude,
+		DestinationLongitude: e.destinationLongitude,
+		UpdatedAt:            e.updatedAt,
+	}
+}
+
+func (m *MemoryCache) Getlocation(ctx context.Context, key string) (models.Location, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Location{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	e, ok := m.entries[key]
+	if !ok || !e.hasPosition {
+		return models.Location{}, fmt.Errorf("no geolocation data found for user %s: %w", key, ErrNotFound)
+	}
+	return m.location(key, e), nil
+}
+
+func (m *MemoryCache) StoreLocation(ctx context.Context, location models.Location) (models.Location, error) {
+	if err := m.StoreLocations(ctx, []models.Location{location}); err != nil {
+		return models.Location{}, fmt.Errorf("could not store user in Redis: %w", err)
+	}
+	return location, nil
+}
+
+func (m *MemoryCache) StoreLocations(ctx context.Context, locations []models.Location) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, location := range locations {
+		if err := validPosition(location.CurrentLatitude, location.CurrentLongitude); err != nil {
+			return fmt.Errorf("could not store locations in Redis: %w", err)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, location := range locations {
+		e := m.entry(location.UserId)
+		e.latitude = location.CurrentLatitude
+		e.longitude = location.CurrentLongitude
+		e.hasPosition = true
+		e.destinationLatitude = location.DestinationLatitude
+		e.destinationLongitude = location.DestinationLongitude
+		if !location.UpdatedAt.IsZero() {
+			e.updatedAt = time.Unix(location.UpdatedAt.Unix(), 0)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryCache) StorePosition(ctx context.Context, userID string, latitude float64, longitude float64, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := validPosition(latitude, longitude); err != nil {
+		return fmt.Errorf("could not store position for user %s: %w", userID, err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := m.entry(userID)
+	e.latitude = latitude
+	e.longitude = longitude
+	e.hasPosition = true
+	e.updatedAt = time.Unix(at.Unix(), 0)
+	return nil
+}
+
+func (m *MemoryCache) StoreDestination(ctx context.Context, userID string, latitude float64, longitude float64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := m.entry(userID)
+	e.destinationLatitude = latitude
+	e.destinationLongitude = longitude
+	return nil
+}
+
+func (m *MemoryCache) Nearby(ctx context.Context, latitude float64, longitude float64, radius float64, unit string) ([]models.Location, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	factor, ok := unitMeters[unit]
+	if !ok {
+		return nil, fmt.Errorf("failed to find nearby users: unsupported unit %q", unit)
+	}
+	if err := validPosition(latitude, longitude); err != nil {
+		return nil, fmt.Errorf("failed to find nearby users: %w", err)
+	}
+	maxDistance := radius * factor
+
+	m.mu.RLock()
+	type candidate struct {
+		location models.Location
+		distance float64
+	}
+	candidates := []candidate{}
+	for userID, e := range m.entries {
+		if !e.hasPosition {
+			continue
+		}
+		distance := geo.Distance(latitude, longitude, e.latitude, e.longitude)
+		if distance <= maxDistance {
+			candidates = append(candidates, candidate{m.location(userID, e), distance})
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+	locations := make([]models.Location, len(candidates))
+	for i, c := range candidates {
+		locations[i] = c.location
+	}
+	return locations, nil
+}
+
+func (m *MemoryCache) RemoveLocation(ctx context.Context, userID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, userID)
+	return nil
+}
+
+func (m *MemoryCache) MarkOnline(ctx context.Context, userID string, connectionID string, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if m.connections[userID] == nil {
+		m.connections[userID] = map[string]time.Time{}
+	}
+	m.connections[userID][connectionID] = now.Add(ttl)
+	m.lastSeen[userID] = time.Unix(now.Unix(), 0)
+	return nil
+}
+
+func (m *MemoryCache) MarkOffline(ctx context.Context, userID string, connectionID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.connections[userID], connectionID)
+	m.lastSeen[userID] = time.Unix(time.Now().Unix(), 0)
+	return nil
+}
+
+func (m *MemoryCache) GetPresence(ctx context.Context, userID string) (models.Presence, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Presence{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	presence := models.Presence{UserId: userID, LastSeen: m.lastSeen[userID]}
+	now := time.Now()
+	for _, expiresAt := range m.connections[userID] {
+		if expiresAt.After(now) {
+			presence.Online = true
+		}
+	}
+	return presence, nil
+}
+
+func (m *MemoryCache) AddRoute(ctx context.Context, userID string, nodeID string, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.routes[userID] == nil {
+		m.routes[userID] = map[string]time.Time{}
+	}
+	m.routes[userID][nodeID] = time.Now().Add(ttl)
+	return nil
+}
+
+func (m *MemoryCache) RemoveRoute(ctx context.Context, userID string, nodeID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.routes[userID], nodeID)
+	return nil
+}
+
+func (m *MemoryCache) GetRoutes(ctx context.Context, userID string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	nodes := []string{}
+	now := time.Now()
+	for nodeID, expiresAt := range m.routes[userID] {
+		if expiresAt.After(now) {
+			nodes = append(nodes, nodeID)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+func (m *MemoryCache) PublishToNode(ctx context.Context, nodeID string, message []byte) error {
+	return m.publish(ctx, DefaultKeys.Node(nodeID), message)
+}
+
+func (m *MemoryCache) SubscribeToNode(ctx context.Context, nodeID string, handle func(message []byte)) error {
+	return m.subscribe(ctx, DefaultKeys.Node(nodeID), handle)
+}
+
+func (m *MemoryCache) PublishLocationUpdate(ctx context.Context, location models.Location) error {
+	locationJSON, err := json.Marshal(location)
+	if err != nil {
+		return fmt.Errorf("error marshaling location: %w", err)
+	}
+	return m.publish(ctx, DefaultKeys.LocationUpdates(location.UserId), locationJSON)
+}
+
+// memoryMessage is a message received on one of several subscribed
+// channels.
+type memoryMessage struct {
+	channel string
+	payload []byte
+}
+
+func (m *MemoryCache) SubscribeToFriendUpdates(ctx context.Context, userId string, updateChan chan<- models.Location) error {
+	// Every channel feeds one loop, as with a single Redis subscription
+	messages := make(chan memoryMessage, 100)
+	forward := func(channel string) func([]byte) {
+		return func(payload []byte) {
+			select {
+			case messages <- memoryMessage{channel, payload}:
+			case <-ctx.Done():
+			}
+		}
+	}
+	changes := DefaultKeys.FriendsChanged(userId)
+	if err := m.subscribe(ctx, changes, forward(changes)); err != nil {
+		return err
+	}
+
+	subscribed := map[string]context.CancelFunc{}
+	follow := func() error {
+		friends, err := m.GetFriends(ctx, userId)
+		if err != nil {
+			return fmt.Errorf("error getting friends for user %s: %w", userId, err)
+		}
+		current := map[string]bool{}
+		for friendId := range subscribed {
+			current[friendId] = true
+		}
+		added, removed := diffFriends(current, friends)
+		for _, friendId := range added {
+			channel := DefaultKeys.LocationUpdates(friendId)
+			friendCtx, cancel := context.WithCancel(ctx)
+			if err := m.subscribe(friendCtx, channel, forward(channel)); err != nil {
+				cancel()
+				return err
+			}
+			subscribed[friendId] = cancel
+		}
+		for _, friendId := range removed {
+			subscribed[friendId]()
+			delete(subscribed, friendId)
+		}
+		return nil
+	}
+	if err := follow(); err != nil {
+		return err
+	}
+
+	go func() {
+		defer close(updateChan)
+		for {
+			select {
+			case msg := <-messages:
+				if msg.channel == changes {
+					if err := follow(); err != nil {
+						log.Printf("Error following friends of user %s: %v", userId, err)
+					}
+					continue
+				}
+				var location models.Location
+				if err := json.Unmarshal(msg.payload, &location); err != nil {
+					log.Printf("Error unmarshaling location: %v", err)
+					continue
+				}
+				select {
+				case updateChan <- location:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (m *MemoryCache) AddFriend(ctx context.Context, userId, friendId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	if m.friends[userId] == nil {
+		m.friends[userId] = map[string]struct{}{}
+	}
+	m.friends[userId][friendId] = struct{}{}
+	m.mu.Unlock()
+	return m.publish(ctx, DefaultKeys.FriendsChanged(userId), []byte(userId))
+}
+
+func (m *MemoryCache) RemoveFriend(ctx context.Context, userId, friendId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	delete(m.friends[userId], friendId)
+	m.mu.Unlock()
+	return m.publish(ctx, DefaultKeys.FriendsChanged(userId), []byte(userId))
+}
+
+func (m *MemoryCache) GetFriends(ctx context.Context, userId string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	friends := make([]string, 0, len(m.friends[userId]))
+	for friendId := range m.friends[userId] {
+		friends = append(friends, friendId)
+	}
+	sort.Strings(friends)
+	return friends, nil
+}
+
+func (m *MemoryCache) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !expiresAt.After(time.Now()) {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revoked[jti] = expiresAt
+	return nil
+}
+
+func (m *MemoryCache) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	expiresAt, ok := m.revoked[jti]
+	return ok && expiresAt.After(time.Now()), nil
+}
+
+func (m *MemoryCache) publish(ctx context.Context, channel string, message []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.RLock()
+	subscriptions := make([]*memorySubscription, 0, len(m.subscribers[channel]))
+	for subscription := range m.subscribers[channel] {
+		subscriptions = append(subscriptions, subscription)
+	}
+	m.mu.RUnlock()
+
+	for _, subscription := range subscriptions {
+		select {
+		case subscription.messages <- message:
+		case <-subscription.ctx.Done():
+		case <-ctx.Done():
+			return fmt.Errorf("error publishing to channel %s: %w", channel, ctx.Err())
+		}
+	}
+	return nil
+}
+
+func (m *MemoryCache) subscribe(ctx context.Context, channel string, handle func(message []byte)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	subscription := &memorySubscription{ctx: ctx, messages: make(chan []byte, 100)}
+	m.mu.Lock()
+	if m.subscribers[channel] == nil {
+		m.subscribers[channel] = map[*memorySubscription]struct{}{}
+	}
+	m.subscribers[channel][subscription] = struct{}{}
+	m.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case message := <-subscription.messages:
+				handle(message)
+			case <-ctx.Done():
+				m.mu.Lock()
+				delete(m.subscribers[channel], subscription)
+				if len(m.subscribers[channel]) == 0 {
+					delete(m.subscribers, channel)
+				}
+				m.mu.Unlock()
+				return
+			}
+		}
+	}()
+	return nil
+}
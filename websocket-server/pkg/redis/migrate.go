@@ -0,0 +1,157 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Layouts written before Keys existed.
+const (
+	legacyGeoPrefix     = "geo:"           // geo:<id> GEO set per user (RedisCache)
+	legacyUserLocations = "user_locations" // shared GEO set (MatcherService)
+	legacyMemberPrefix  = "user:"          // user:<id> members in user_locations
+)
+
+type MigrationStats struct {
+	Positions    int
+	Destinations int
+	DeletedKeys  int
+}
+
+// MigrateLegacyKeys rewrites positions and destinations stored under the old
+// layouts into the layout described by keys:
+//
+//   - geo:<id> sets holding a single <id> member are merged into Locations
+//   - user_locations members, with or without the user: prefix, are merged
+//     into Locations
+//   - bare <id> destination hashes are moved to Destination(<id>) unless a
+//     newer destination already exists there
+//
+// With dryRun set nothing is written and the stats report what would change.
+func MigrateLegacyKeys(ctx context.Context, client *redis.Client, keys Keys, dryRun bool) (MigrationStats, error) {
+	var stats MigrationStats
+
+	var cursor uint64
+	for {
+		legacyKeys, next, err := client.Scan(ctx, cursor, legacyGeoPrefix+"*", 100).Result()
+		if err != nil {
+			return stats, fmt.Errorf("error scanning legacy geo keys: %w", err)
+		}
+		for _, key := range legacyKeys {
+			// The live index matches geo:* too, prefixed or not
+			if key == keys.Locations() || key == DefaultKeys.Locations() {
+				continue
+			}
+			userID := strings.TrimPrefix(key, legacyGeoPrefix)
+			migrated, err := migratePosition(ctx, client, keys, key, userID, userID, dryRun, &stats)
+			if err != nil {
+				return stats, err
+			}
+			// Keys that held no position of their user are not ours to delete
+			if !migrated {
+				continue
+			}
+			if err := deleteKey(ctx, client, key, dryRun, &stats); err != nil {
+				return stats, err
+			}
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+
+	members, err := client.ZRange(ctx, legacyUserLocations, 0, -1).Result()
+	if err != nil {
+		return stats, fmt.Errorf("error reading %s: %w", legacyUserLocations, err)
+	}
+	for _, member := range members {
+		userID := strings.TrimPrefix(member, legacyMemberPrefix)
+		if _, err := migratePosition(ctx, client, keys, legacyUserLocations, member, userID, dryRun, &stats); err != nil {
+			return stats, err
+		}
+		if err := migrateDestination(ctx, client, keys, userID, dryRun, &stats); err != nil {
+			return stats, err
+		}
+	}
+	if len(members) > 0 {
+		if err := deleteKey(ctx, client, legacyUserLocations, dryRun, &stats); err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+// migratePosition reports whether a position was found for member in key
+// and copied, or would be with dryRun set.
+func migratePosition(ctx context.Context, client *redis.Client, keys Keys, key, member, userID string, dryRun bool, stats *MigrationStats) (bool, error) {
+	pos, err := client.GeoPos(ctx, key, member).Result()
+	if err != nil {
+		if redis.HasErrorPrefix(err, "WRONGTYPE") {
+			log.Printf("%s is not a GEO set, skipping", key)
+			return false, nil
+		}
+		return false, fmt.Errorf("error reading position of %s in %s: %w", member, key, err)
+	}
+	if len(pos) == 0 || pos[0] == nil {
+		log.Printf("No position for %s in %s, skipping", member, key)
+		return false, nil
+	}
+
+	stats.Positions++
+	if dryRun {
+		return true, nil
+	}
+	// NX keeps positions already written in the new layout, which are newer
+	err = client.Do(ctx, "GEOADD", keys.Locations(), "NX", pos[0].Longitude, pos[0].Latitude, keys.Member(userID)).Err()
+	if err != nil {
+		return false, fmt.Errorf("error writing position of user %s: %w", userID, err)
+	}
+	return true, nil
+}
+
+func migrateDestination(ctx context.Context, client *redis.Client, keys Keys, userID string, dryRun bool, stats *MigrationStats) error {
+	destination, err := client.HMGet(ctx, userID, "destination_lat", "destination_lon").Result()
+	if err != nil {
+		if redis.HasErrorPrefix(err, "WRONGTYPE") {
+			return nil
+		}
+		return fmt.Errorf("error reading legacy destination of user %s: %w", userID, err)
+	}
+	if len(destination) != 2 || destination[0] == nil || destination[1] == nil {
+		return nil
+	}
+
+	stats.Destinations++
+	if dryRun {
+		stats.DeletedKeys++
+		return nil
+	}
+	_, err = client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSetNX(ctx, keys.Destination(userID), "destination_lat", destination[0])
+		pipe.HSetNX(ctx, keys.Destination(userID), "destination_lon", destination[1])
+		pipe.Del(ctx, userID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error moving destination of user %s: %w", userID, err)
+	}
+	stats.DeletedKeys++
+	return nil
+}
+
+func deleteKey(ctx context.Context, client *redis.Client, key string, dryRun bool, stats *MigrationStats) error {
+	stats.DeletedKeys++
+	if dryRun {
+		return nil
+	}
+	if err := client.Del(ctx, key).Err(); err != nil {
+		return fmt.Errorf("error deleting legacy key %s: %w", key, err)
+	}
+	return nil
+}
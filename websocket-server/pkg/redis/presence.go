@@ -0,0 +1,93 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"matching-service/websocket-server/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MarkOnline registers or refreshes one connection of the user for ttl. A
+// user is online while any of their connections has not expired, so a
+// second device or a crashed server node does not confuse the state.
+func (r *RedisCache) MarkOnline(ctx context.Context, userID string, connectionID string, ttl time.Duration) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	now := time.Now()
+	_, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		key := r.keys.Presence(userID)
+		pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Unix(), 10))
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Add(ttl).Unix()), Member: connectionID})
+		pipe.Expire(ctx, key, ttl)
+		pipe.ZAdd(ctx, r.keys.LastSeen(), redis.Z{Score: float64(now.Unix()), Member: userID})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not mark user %s online: %w", userID, err)
+	}
+	return nil
+}
+
+// MarkOffline removes one connection of the user and records the time.
+func (r *RedisCache) MarkOffline(ctx context.Context, userID string, connectionID string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, r.keys.Presence(userID), connectionID)
+		pipe.ZAdd(ctx, r.keys.LastSeen(), redis.Z{Score: float64(time.Now().Unix()), Member: userID})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not mark user %s offline: %w", userID, err)
+	}
+	return nil
+}
+
+func (r *RedisCache) GetPresence(ctx context.Context, userID string) (models.Presence, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	presence := models.Presence{UserId: userID}
+
+	pipe := r.redisClient.Pipeline()
+	connections := pipe.ZCount(ctx, r.keys.Presence(userID), strconv.FormatInt(time.Now().Unix(), 10), "+inf")
+	lastSeen := pipe.ZScore(ctx, r.keys.LastSeen(), userID)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return presence, fmt.Errorf("could not get presence of user %s: %w", userID, err)
+	}
+
+	presence.Online = connections.Val() > 0
+	if seen := lastSeen.Val(); seen > 0 {
+		presence.LastSeen = time.Unix(int64(seen), 0)
+	}
+	return presence, nil
+}
+
+// KeepPresence marks the connection online and refreshes it every ttl/2
+// until ctx is done, then marks it offline. Run it for the life of the
+// connection.
+func KeepPresence(ctx context.Context, cache RedisCacheHandler, userID string, connectionID string, ttl time.Duration) {
+	refresh := func() {
+		if err := cache.MarkOnline(ctx, userID, connectionID, ttl); err != nil {
+			log.Printf("Could not refresh presence of user %s: %v", userID, err)
+		}
+	}
+	refresh()
+
+	ticker := time.NewTicker(ttl / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			refresh()
+		case <-ctx.Done():
+			if err := cache.MarkOffline(context.WithoutCancel(ctx), userID, connectionID); err != nil {
+				log.Printf("Could not clear presence of user %s: %v", userID, err)
+			}
+			return
+		}
+	}
+}
@@ -6,16 +6,20 @@ import (
 	"fmt"
 	"log"
 	"matching-service/websocket-server/internal/models"
+
+	"github.com/redis/go-redis/v9"
 )
 
-func (r *RedisCache) PublishLocationUpdate(location models.Location) error {
+func (r *RedisCache) PublishLocationUpdate(ctx context.Context, location models.Location) error {
 	locationJSON, err := json.Marshal(location)
 	if err != nil {
 		return fmt.Errorf("error marshaling location: %w", err)
 	}
 
-	channel := fmt.Sprintf("location_updates:%s", location.UserId)
-	err = r.redisClient.Publish(r.ctx, channel, locationJSON).Err()
+	channel := r.keys.LocationUpdates(location.UserId)
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	err = r.redisClient.Publish(ctx, channel, locationJSON).Err()
 	if err != nil {
 		return fmt.Errorf("error publishing to channel %s: %w", channel, err)
 	}
@@ -23,90 +27,151 @@ func (r *RedisCache) PublishLocationUpdate(location models.Location) error {
 	return nil
 }
 
-func (r *RedisCache) SubscribeToFriendUpdates(userId string, updateChan chan<- models.Location) {
-	friends, err := r.GetFriends(userId)
-	if err != nil {
-		log.Printf("Error getting friends for user %s: %v", userId, err)
-		return
+// SubscribeToFriendUpdates streams the location updates of the user's
+// friends to updateChan and follows changes to the friend list. It returns
+// once subscribed; updates are then sent from another goroutine until ctx
+// is done, when updateChan is closed.
+func (r *RedisCache) SubscribeToFriendUpdates(ctx context.Context, userId string, updateChan chan<- models.Location) error {
+	// Listen for changes before reading the list, so none is missed
+	changes := r.keys.FriendsChanged(userId)
+	pubsub := r.redisClient.Subscribe(ctx, changes)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return fmt.Errorf("error subscribing to channel %s: %w", changes, err)
 	}
-
-	channels := make([]string, len(friends))
-	for i, friendId := range friends {
-		channels[i] = fmt.Sprintf("location_updates:%s", friendId)
+	subscribed := map[string]bool{}
+	if err := r.syncFriendChannels(ctx, pubsub, userId, subscribed); err != nil {
+		pubsub.Close()
+		return err
 	}
 
-	pubsub := r.redisClient.Subscribe(r.ctx, channels...)
-	defer pubsub.Close()
-
-	for {
-		msg, err := pubsub.ReceiveMessage(r.ctx)
-		if err != nil {
-			log.Printf("Error receiving message: %v", err)
-			continue
+	go func() {
+		defer close(updateChan)
+		defer pubsub.Close()
+		// Channel reconnects and resubscribes after a lost connection, and
+		// is closed with the subscription
+		messages := pubsub.Channel()
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				if msg.Channel == changes {
+					if err := r.syncFriendChannels(ctx, pubsub, userId, subscribed); err != nil {
+						log.Printf("Error following friends of user %s: %v", userId, err)
+					}
+					continue
+				}
+
+				var location models.Location
+				if err := json.Unmarshal([]byte(msg.Payload), &location); err != nil {
+					log.Printf("Error unmarshaling location: %v", err)
+					continue
+				}
+				select {
+				case updateChan <- location:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
 		}
+	}()
+	return nil
+}
 
-		var location models.Location
-		err = json.Unmarshal([]byte(msg.Payload), &location)
-		if err != nil {
-			log.Printf("Error unmarshaling location: %v", err)
-			continue
+// syncFriendChannels subscribes to the channels of new friends and
+// unsubscribes from those of removed ones.
+func (r *RedisCache) syncFriendChannels(ctx context.Context, pubsub *redis.PubSub, userId string, subscribed map[string]bool) error {
+	friends, err := r.GetFriends(ctx, userId)
+	if err != nil {
+		return fmt.Errorf("error getting friends for user %s: %w", userId, err)
+	}
+
+	added, removed := diffFriends(subscribed, friends)
+	if len(added) > 0 {
+		if err := pubsub.Subscribe(ctx, r.locationChannels(added)...); err != nil {
+			return fmt.Errorf("error subscribing to friends of user %s: %w", userId, err)
+		}
+		for _, friendId := range added {
+			subscribed[friendId] = true
+		}
+	}
+	if len(removed) > 0 {
+		if err := pubsub.Unsubscribe(ctx, r.locationChannels(removed)...); err != nil {
+			return fmt.Errorf("error unsubscribing from friends of user %s: %w", userId, err)
+		}
+		for _, friendId := range removed {
+			delete(subscribed, friendId)
 		}
+	}
+	return nil
+}
 
-		updateChan <- location
+func (r *RedisCache) locationChannels(userIds []string) []string {
+	channels := make([]string, len(userIds))
+	for i, userId := range userIds {
+		channels[i] = r.keys.LocationUpdates(userId)
 	}
+	return channels
 }
 
-func (r *RedisCache) StartLocationUpdateWorker(ctx context.Context, userId string) {
-	updateChan := make(chan models.Location, 100)
-	go r.SubscribeToFriendUpdates(userId, updateChan)
-
-	for {
-		select {
-		case location := <-updateChan:
-			log.Printf("Received location update for friend %s: lat %f, lon %f",
-				location.UserId, location.CurrentLatitude, location.CurrentLongitude)
-			// Process the location update (e.g., update UI, trigger notifications, etc.)
-		case <-ctx.Done():
-			log.Println("Shutting down worker for user:", userId)
-			return
+// diffFriends returns the friends missing from subscribed and the
+// subscribed users that are no longer friends.
+func diffFriends(subscribed map[string]bool, friends []string) (added []string, removed []string) {
+	current := make(map[string]bool, len(friends))
+	for _, friendId := range friends {
+		current[friendId] = true
+		if !subscribed[friendId] {
+			added = append(added, friendId)
 		}
 	}
+	for friendId := range subscribed {
+		if !current[friendId] {
+			removed = append(removed, friendId)
+		}
+	}
+	return added, removed
 }
 
-// Existing friend-related functions
-func (r *RedisCache) AddFriend(userId, friendId string) error {
-	key := fmt.Sprintf("friends:%s", userId)
-	_, err := r.redisClient.SAdd(r.ctx, key, friendId).Result()
+// AddFriend and RemoveFriend announce the change on the user's
+// friends_changed channel, so open friend subscriptions on every node
+// follow it.
+func (r *RedisCache) AddFriend(ctx context.Context, userId, friendId string) error {
+	key := r.keys.Friends(userId)
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.redisClient.SAdd(ctx, key, friendId).Result()
 	if err != nil {
 		return err
 	}
-
-	// Resubscribe to include the new friend's channel
-	// This is a simplified approach; in practice, you might want to manage subscriptions more carefully
-	go r.refreshSubscriptions(userId)
-
-	return nil
+	return r.publishFriendsChanged(ctx, userId)
 }
 
-func (r *RedisCache) RemoveFriend(userId, friendId string) error {
-	key := fmt.Sprintf("friends:%s", userId)
-	err := r.redisClient.SRem(r.ctx, key, friendId).Err()
+func (r *RedisCache) RemoveFriend(ctx context.Context, userId, friendId string) error {
+	key := r.keys.Friends(userId)
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	err := r.redisClient.SRem(ctx, key, friendId).Err()
 	if err != nil {
 		return err
 	}
-
-	// Resubscribe to exclude the removed friend's channel
-	go r.refreshSubscriptions(userId)
-
-	return nil
+	return r.publishFriendsChanged(ctx, userId)
 }
 
-func (r *RedisCache) GetFriends(userId string) ([]string, error) {
-	key := fmt.Sprintf("friends:%s", userId)
-	return r.redisClient.SMembers(r.ctx, key).Result()
+func (r *RedisCache) GetFriends(ctx context.Context, userId string) ([]string, error) {
+	key := r.keys.Friends(userId)
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return r.redisClient.SMembers(ctx, key).Result()
 }
 
-func (r *RedisCache) refreshSubscriptions(userId string) {
-	// Implementation to refresh subscriptions when friend list changes
-	// This is a placeholder and would need to be implemented based on your specific subscription management approach
+func (r *RedisCache) publishFriendsChanged(ctx context.Context, userId string) error {
+	channel := r.keys.FriendsChanged(userId)
+	if err := r.redisClient.Publish(ctx, channel, userId).Err(); err != nil {
+		return fmt.Errorf("error publishing to channel %s: %w", channel, err)
+	}
+	return nil
 }
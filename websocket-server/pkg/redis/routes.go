@@ -0,0 +1,94 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// AddRoute records for ttl that the user is connected to the server node.
+// Routes of nodes that crashed expire on their own.
+func (r *RedisCache) AddRoute(ctx context.Context, userID string, nodeID string, ttl time.Duration) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	now := time.Now()
+	_, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		key := r.keys.Routes(userID)
+		pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Unix(), 10))
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Add(ttl).Unix()), Member: nodeID})
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not route user %s to node %s: %w", userID, nodeID, err)
+	}
+	return nil
+}
+
+func (r *RedisCache) RemoveRoute(ctx context.Context, userID string, nodeID string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	if err := r.redisClient.ZRem(ctx, r.keys.Routes(userID), nodeID).Err(); err != nil {
+		return fmt.Errorf("could not remove route of user %s to node %s: %w", userID, nodeID, err)
+	}
+	return nil
+}
+
+// GetRoutes returns the nodes the user is connected to.
+func (r *RedisCache) GetRoutes(ctx context.Context, userID string) ([]string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	nodes, err := r.redisClient.ZRangeByScore(ctx, r.keys.Routes(userID), &redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("could not get routes of user %s: %w", userID, err)
+	}
+	return nodes, nil
+}
+
+func (r *RedisCache) PublishToNode(ctx context.Context, nodeID string, message []byte) error {
+	channel := r.keys.Node(nodeID)
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	if err := r.redisClient.Publish(ctx, channel, message).Err(); err != nil {
+		return fmt.Errorf("error publishing to channel %s: %w", channel, err)
+	}
+	return nil
+}
+
+// SubscribeToNode returns once the node's channel is subscribed to. handle
+// is then called from another goroutine with every message until ctx is
+// done.
+func (r *RedisCache) SubscribeToNode(ctx context.Context, nodeID string, handle func(message []byte)) error {
+	channel := r.keys.Node(nodeID)
+	pubsub := r.redisClient.Subscribe(ctx, channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return fmt.Errorf("error subscribing to channel %s: %w", channel, err)
+	}
+
+	go func() {
+		defer pubsub.Close()
+		// Channel reconnects and resubscribes after a lost connection
+		messages := pubsub.Channel()
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					log.Printf("Subscription to channel %s closed", channel)
+					return
+				}
+				handle([]byte(msg.Payload))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,32 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RevokeToken puts an access token on the deny-list until it expires, after
+// which it is rejected anyway.
+func (r *RedisCache) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	if err := r.redisClient.Set(ctx, r.keys.RevokedToken(jti), 1, ttl).Err(); err != nil {
+		return fmt.Errorf("could not revoke token %s: %w", jti, err)
+	}
+	return nil
+}
+
+func (r *RedisCache) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	n, err := r.redisClient.Exists(ctx, r.keys.RevokedToken(jti)).Result()
+	if err != nil {
+		return false, fmt.Errorf("could not check revocation of token %s: %w", jti, err)
+	}
+	return n > 0, nil
+}
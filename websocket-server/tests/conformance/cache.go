@@ -0,0 +1,294 @@
+package conformance
+
+import (
+	"context"
+	"matching-service/websocket-server/internal/models"
+	"matching-service/websocket-server/pkg/redis"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RunCache checks the RedisCacheHandler contract against the cache returned
+// by newCache. newCache should return an empty cache, e.g. one under a fresh
+// key prefix.
+func RunCache(t *testing.T, newCache func(t *testing.T) redis.RedisCacheHandler) {
+	ctx := context.Background()
+
+	t.Run("StoreAndGet", func(t *testing.T) {
+		cache := newCache(t)
+		location := models.Location{
+			UserId:               uuid.New().String(),
+			CurrentLatitude:      37.7749,
+			CurrentLongitude:     -122.4194,
+			DestinationLatitude:  40.7128,
+			DestinationLongitude: -74.0060,
+			UpdatedAt:            time.Now(),
+		}
+		if _, err := cache.StoreLocation(ctx, location); err != nil {
+			t.Fatalf("Failed to cache location: %v", err)
+		}
+		saved, err := cache.Getlocation(ctx, location.UserId)
+		if err != nil {
+			t.Fatalf("Failed to get cached location: %v", err)
+		}
+		// GEO positions are stored as 52 bit geohashes
+		if !near(saved.CurrentLatitude, location.CurrentLatitude) || !near(saved.CurrentLongitude, location.CurrentLongitude) {
+			t.Errorf("Expected position %v,%v, got %v,%v", location.CurrentLatitude, location.CurrentLongitude, saved.CurrentLatitude, saved.CurrentLongitude)
+		}
+		if saved.DestinationLatitude != location.DestinationLatitude || saved.DestinationLongitude != location.DestinationLongitude {
+			t.Errorf("Expected destination %v,%v, got %v,%v", location.DestinationLatitude, location.DestinationLongitude, saved.DestinationLatitude, saved.DestinationLongitude)
+		}
+		if saved.UpdatedAt.Unix() != location.UpdatedAt.Unix() {
+			t.Errorf("Expected updated_at %v, got %v", location.UpdatedAt.Unix(), saved.UpdatedAt.Unix())
+		}
+	})
+
+	t.Run("GetMissing", func(t *testing.T) {
+		cache := newCache(t)
+		if _, err := cache.Getlocation(ctx, uuid.New().String()); err == nil {
+			t.Errorf("Expected an error for an unknown user")
+		}
+	})
+
+	t.Run("PositionAndDestination", func(t *testing.T) {
+		cache := newCache(t)
+		userID := uuid.New().String()
+		at := time.Now().Add(-time.Minute)
+		if err := cache.StorePosition(ctx, userID, 51.5, -0.12, at); err != nil {
+			t.Fatalf("Failed to store position: %v", err)
+		}
+		if err := cache.StoreDestination(ctx, userID, 48.85, 2.35); err != nil {
+			t.Fatalf("Failed to store destination: %v", err)
+		}
+		saved, err := cache.Getlocation(ctx, userID)
+		if err != nil {
+			t.Fatalf("Failed to get cached location: %v", err)
+		}
+		if !near(saved.CurrentLatitude, 51.5) || saved.DestinationLatitude != 48.85 || saved.DestinationLongitude != 2.35 {
+			t.Errorf("Unexpected cached location: %+v", saved)
+		}
+		// updated_at is the time of the position, not of the last write
+		if saved.UpdatedAt.Unix() != at.Unix() {
+			t.Errorf("Expected updated_at %v, got %v", at.Unix(), saved.UpdatedAt.Unix())
+		}
+	})
+
+	t.Run("InvalidPosition", func(t *testing.T) {
+		cache := newCache(t)
+		if err := cache.StorePosition(ctx, uuid.New().String(), 89, 0, time.Now()); err == nil {
+			t.Errorf("Expected latitudes beyond the GEO bounds to be rejected")
+		}
+	})
+
+	t.Run("Nearby", func(t *testing.T) {
+		cache := newCache(t)
+		// San Francisco, Oakland (~13 km) and Los Angeles (~560 km)
+		sf, oakland, la := uuid.New().String(), uuid.New().String(), uuid.New().String()
+		err := cache.StoreLocations(ctx, []models.Location{
+			{UserId: la, CurrentLatitude: 34.0522, CurrentLongitude: -118.2437},
+			{UserId: oakland, CurrentLatitude: 37.8044, CurrentLongitude: -122.2712, DestinationLatitude: 37.3382, DestinationLongitude: -121.8863},
+			{UserId: sf, CurrentLatitude: 37.7749, CurrentLongitude: -122.4194},
+		})
+		if err != nil {
+			t.Fatalf("Failed to cache locations: %v", err)
+		}
+
+		nearby, err := cache.Nearby(ctx, 37.7749, -122.4194, 20, "km")
+		if err != nil {
+			t.Fatalf("Failed to find nearby users: %v", err)
+		}
+		if len(nearby) != 2 || nearby[0].UserId != sf || nearby[1].UserId != oakland {
+			t.Fatalf("Expected [%s %s] closest first, got %+v", sf, oakland, nearby)
+		}
+		if nearby[1].DestinationLatitude != 37.3382 {
+			t.Errorf("Expected Nearby to fill in destinations, got %+v", nearby[1])
+		}
+
+		nearby, err = cache.Nearby(ctx, 37.7749, -122.4194, 1000, "mi")
+		if err != nil {
+			t.Fatalf("Failed to find nearby users: %v", err)
+		}
+		if len(nearby) != 3 {
+			t.Errorf("Expected 3 users within 1000 mi, got %d", len(nearby))
+		}
+	})
+
+	t.Run("Presence", func(t *testing.T) {
+		cache := newCache(t)
+		userID := uuid.New().String()
+
+		presence, err := cache.GetPresence(ctx, userID)
+		if err != nil {
+			t.Fatalf("Failed to get presence: %v", err)
+		}
+		if presence.Online || !presence.LastSeen.IsZero() {
+			t.Errorf("Expected an unknown user to be offline and never seen, got %+v", presence)
+		}
+
+		for _, connectionID := range []string{"phone", "laptop"} {
+			if err := cache.MarkOnline(ctx, userID, connectionID, time.Minute); err != nil {
+				t.Fatalf("Failed to mark online: %v", err)
+			}
+		}
+		if err := cache.MarkOffline(ctx, userID, "phone"); err != nil {
+			t.Fatalf("Failed to mark offline: %v", err)
+		}
+		if presence, _ := cache.GetPresence(ctx, userID); !presence.Online {
+			t.Errorf("Expected the user to stay online through a second connection")
+		}
+
+		if err := cache.MarkOffline(ctx, userID, "laptop"); err != nil {
+			t.Fatalf("Failed to mark offline: %v", err)
+		}
+		presence, err = cache.GetPresence(ctx, userID)
+		if err != nil {
+			t.Fatalf("Failed to get presence: %v", err)
+		}
+		if presence.Online || time.Since(presence.LastSeen) > 5*time.Second {
+			t.Errorf("Expected the user to be offline and just seen, got %+v", presence)
+		}
+	})
+
+	t.Run("Routes", func(t *testing.T) {
+		cache := newCache(t)
+		userID := uuid.New().String()
+		for _, nodeID := range []string{"node-a", "node-b"} {
+			if err := cache.AddRoute(ctx, userID, nodeID, time.Minute); err != nil {
+				t.Fatalf("Failed to add route: %v", err)
+			}
+		}
+		if err := cache.RemoveRoute(ctx, userID, "node-a"); err != nil {
+			t.Fatalf("Failed to remove route: %v", err)
+		}
+		nodes, err := cache.GetRoutes(ctx, userID)
+		if err != nil {
+			t.Fatalf("Failed to get routes: %v", err)
+		}
+		if len(nodes) != 1 || nodes[0] != "node-b" {
+			t.Errorf("Expected the user to be routed to node-b only, got %v", nodes)
+		}
+	})
+
+	t.Run("NodeChannel", func(t *testing.T) {
+		cache := newCache(t)
+		nodeID := uuid.New().String()
+		subCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		received := make(chan string, 1)
+		if err := cache.SubscribeToNode(subCtx, nodeID, func(message []byte) { received <- string(message) }); err != nil {
+			t.Fatalf("Failed to subscribe: %v", err)
+		}
+		if err := cache.PublishToNode(ctx, nodeID, []byte("hello")); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+		select {
+		case message := <-received:
+			if message != "hello" {
+				t.Errorf("Expected hello, got %q", message)
+			}
+		case <-time.After(2 * time.Second):
+			t.Errorf("Expected the message to reach the subscriber")
+		}
+	})
+
+	t.Run("FriendUpdates", func(t *testing.T) {
+		cache := newCache(t)
+		userID, friendID := uuid.New().String(), uuid.New().String()
+		subCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		updates := make(chan models.Location, 10)
+		if err := cache.SubscribeToFriendUpdates(subCtx, userID, updates); err != nil {
+			t.Fatalf("Failed to subscribe: %v", err)
+		}
+
+		// A friend added after subscribing is followed
+		if err := cache.AddFriend(ctx, userID, friendID); err != nil {
+			t.Fatalf("Failed to add friend: %v", err)
+		}
+		location := models.Location{UserId: friendID, CurrentLatitude: 51.5, CurrentLongitude: -0.12}
+		if !receiveUpdate(t, cache, updates, location) {
+			t.Fatalf("Expected the update of a newly added friend")
+		}
+
+		// A removed one no longer is
+		if err := cache.RemoveFriend(ctx, userID, friendID); err != nil {
+			t.Fatalf("Failed to remove friend: %v", err)
+		}
+		time.Sleep(200 * time.Millisecond)
+		if err := cache.PublishLocationUpdate(ctx, location); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+		select {
+		case update := <-updates:
+			t.Errorf("Expected no update of a removed friend, got %+v", update)
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		cancel()
+		select {
+		case _, ok := <-updates:
+			if ok {
+				t.Errorf("Expected no more updates after cancelling")
+			}
+		case <-time.After(2 * time.Second):
+			t.Errorf("Expected the updates channel to be closed after cancelling")
+		}
+	})
+
+	t.Run("RevokedTokens", func(t *testing.T) {
+		cache := newCache(t)
+		jti, expired := uuid.New().String(), uuid.New().String()
+		if err := cache.RevokeToken(ctx, jti, time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("Failed to revoke token: %v", err)
+		}
+		if err := cache.RevokeToken(ctx, expired, time.Now().Add(-time.Minute)); err != nil {
+			t.Fatalf("Failed to revoke token: %v", err)
+		}
+		if revoked, err := cache.IsTokenRevoked(ctx, jti); err != nil || !revoked {
+			t.Errorf("Expected the token to be revoked, got %v, %v", revoked, err)
+		}
+		// An expired token needs no entry
+		if revoked, err := cache.IsTokenRevoked(ctx, expired); err != nil || revoked {
+			t.Errorf("Expected no entry for an expired token, got %v, %v", revoked, err)
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		cache := newCache(t)
+		userID := uuid.New().String()
+		if err := cache.StorePosition(ctx, userID, 37.7749, -122.4194, time.Now()); err != nil {
+			t.Fatalf("Failed to store position: %v", err)
+		}
+		if err := cache.RemoveLocation(ctx, userID); err != nil {
+			t.Fatalf("Failed to remove location: %v", err)
+		}
+		if _, err := cache.Getlocation(ctx, userID); err == nil {
+			t.Errorf("Expected removed user to be gone")
+		}
+	})
+}
+
+// receiveUpdate publishes location until it arrives on updates, as a new
+// subscription may take a moment to become active.
+func receiveUpdate(t *testing.T, cache redis.RedisCacheHandler, updates <-chan models.Location, location models.Location) bool {
+	deadline := time.After(2 * time.Second)
+	for {
+		if err := cache.PublishLocationUpdate(context.Background(), location); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+		select {
+		case update := <-updates:
+			return update.UserId == location.UserId
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-4
+}
@@ -0,0 +1,19 @@
+// Package conformance holds behaviour tests shared by every implementation
+// of the storage interfaces, so the in-memory ones used in tests and local
+// development stay interchangeable with Cassandra and Redis.
+package conformance
+
+import (
+	"testing"
+
+	"github.com/joho/godotenv"
+)
+
+// RequireBackends loads .env.test and skips the test when it is missing,
+// i.e. when no live Cassandra and Redis are configured.
+func RequireBackends(t *testing.T) {
+	t.Helper()
+	if err := godotenv.Load(".env.test"); err != nil {
+		t.Skip("skipping: .env.test not found, no live backends configured")
+	}
+}
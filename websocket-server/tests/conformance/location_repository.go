@@ -0,0 +1,244 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"matching-service/websocket-server/internal/models"
+	"matching-service/websocket-server/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/google/uuid"
+)
+
+// RunLocationRepository checks the LocationRepository contract against the
+// repository returned by newRepo. Each subtest uses fresh user IDs, so the
+// repository may be shared with other data.
+func RunLocationRepository(t *testing.T, newRepo func(t *testing.T) repository.LocationRepository) {
+	ctx := context.Background()
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		repo := newRepo(t)
+		now := time.Now()
+		location := models.Location{
+			UserId:               uuid.New().String(),
+			CurrentLatitude:      37.7749,
+			CurrentLongitude:     -122.4194,
+			DestinationLatitude:  40.7128,
+			DestinationLongitude: -74.0060,
+			CreatedAt:            now,
+			UpdatedAt:            now,
+		}
+		if err := repo.Create(ctx, location); err != nil {
+			t.Fatalf("Failed to create location: %v", err)
+		}
+		saved, err := repo.GetByUserID(ctx, location.UserId)
+		if err != nil {
+			t.Fatalf("Failed to get location: %v", err)
+		}
+		if saved.UserId != location.UserId || saved.CurrentLatitude != location.CurrentLatitude ||
+			saved.DestinationLongitude != location.DestinationLongitude {
+			t.Errorf("Expected %+v, got %+v", location, saved)
+		}
+		if !saved.UpdatedAt.Equal(now.Truncate(time.Millisecond)) {
+			t.Errorf("Expected updated_at %v, got %v", now.Truncate(time.Millisecond), saved.UpdatedAt)
+		}
+	})
+
+	t.Run("GetMissing", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.GetByUserID(ctx, uuid.New().String()); !errors.Is(err, gocql.ErrNotFound) {
+			t.Errorf("Expected gocql.ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("PartialUpdates", func(t *testing.T) {
+		repo := newRepo(t)
+		userID := uuid.New()
+		// A point buffered offline keeps the time it was taken at
+		at := time.Now().Add(-5 * time.Minute).Truncate(time.Millisecond)
+		if err := repo.UpdateCurrentLocation(ctx, userID, 51.5, -0.12, at); err != nil {
+			t.Fatalf("Failed to update current location: %v", err)
+		}
+		if err := repo.UpdateDestination(ctx, userID, 48.85, 2.35); err != nil {
+			t.Fatalf("Failed to update destination: %v", err)
+		}
+		saved, err := repo.GetByUserID(ctx, userID.String())
+		if err != nil {
+			t.Fatalf("Failed to get location: %v", err)
+		}
+		if saved.CurrentLatitude != 51.5 || saved.CurrentLongitude != -0.12 ||
+			saved.DestinationLatitude != 48.85 || saved.DestinationLongitude != 2.35 {
+			t.Errorf("Unexpected location after partial updates: %+v", saved)
+		}
+		if !saved.UpdatedAt.Equal(at) {
+			t.Errorf("Expected updated_at %v, got %v", at, saved.UpdatedAt)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo := newRepo(t)
+		userID := uuid.New()
+		if err := repo.Create(ctx, models.Location{UserId: userID.String(), CreatedAt: time.Now(), UpdatedAt: time.Now()}); err != nil {
+			t.Fatalf("Failed to create location: %v", err)
+		}
+		if err := repo.Delete(ctx, userID); err != nil {
+			t.Fatalf("Failed to delete location: %v", err)
+		}
+		if _, err := repo.GetByUserID(ctx, userID.String()); !errors.Is(err, gocql.ErrNotFound) {
+			t.Errorf("Expected gocql.ErrNotFound after delete, got %v", err)
+		}
+	})
+
+	t.Run("ScanLocations", func(t *testing.T) {
+		repo := newRepo(t)
+		created := map[string]bool{}
+		for i := 0; i < 5; i++ {
+			userID := uuid.New().String()
+			created[userID] = true
+			if err := repo.Create(ctx, models.Location{UserId: userID, CreatedAt: time.Now(), UpdatedAt: time.Now()}); err != nil {
+				t.Fatalf("Failed to create location: %v", err)
+			}
+		}
+
+		seen := map[string]int{}
+		var state []byte
+		for pages := 0; ; pages++ {
+			if pages > 10000 {
+				t.Fatalf("ScanLocations did not terminate")
+			}
+			next, err := repo.ScanLocations(ctx, state, 2, func(location models.Location) error {
+				seen[location.UserId]++
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Failed to scan locations: %v", err)
+			}
+			if len(next) == 0 {
+				break
+			}
+			state = next
+		}
+		for userID := range created {
+			if seen[userID] != 1 {
+				t.Errorf("Expected user %s to be scanned once, got %d", userID, seen[userID])
+			}
+		}
+	})
+
+	t.Run("Trajectory", func(t *testing.T) {
+		repo := newRepo(t)
+		userID := uuid.New().String()
+		start := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+		for i := 0; i < 5; i++ {
+			point := models.LocationPoint{
+				UserId:    userID,
+				Latitude:  float64(i),
+				Longitude: float64(i),
+				UpdatedAt: start.Add(time.Duration(i) * time.Minute),
+			}
+			if err := repo.AppendHistory(ctx, point); err != nil {
+				t.Fatalf("Failed to append history: %v", err)
+			}
+		}
+
+		points := []models.LocationPoint{}
+		token := ""
+		for pages := 0; ; pages++ {
+			if pages > 100 {
+				t.Fatalf("GetTrajectory did not terminate")
+			}
+			page, next, err := repo.GetTrajectory(ctx, userID, start, start.Add(4*time.Minute), 2, token)
+			if err != nil {
+				t.Fatalf("Failed to get trajectory: %v", err)
+			}
+			points = append(points, page...)
+			if next == "" {
+				break
+			}
+			token = next
+		}
+		// to is exclusive, so the last point is left out
+		if len(points) != 4 {
+			t.Fatalf("Expected 4 points, got %d", len(points))
+		}
+		for i, point := range points {
+			if point.Latitude != float64(i) {
+				t.Errorf("Expected point %d to have latitude %d, got %v", i, i, point.Latitude)
+			}
+		}
+
+		if _, _, err := repo.GetTrajectory(ctx, userID, start, start.Add(-time.Minute), 0, ""); err == nil {
+			t.Errorf("Expected an error for an inverted time range")
+		}
+	})
+
+	t.Run("TrajectoryAcrossDays", func(t *testing.T) {
+		repo := newRepo(t)
+		userID, otherID := uuid.New().String(), uuid.New().String()
+		// Three points before UTC midnight and two after, with another
+		// user's points at the same times and one point before the range
+		midnight := time.Now().UTC().Truncate(24 * time.Hour)
+		from, to := midnight.Add(-3*time.Minute), midnight.Add(2*time.Minute+time.Second)
+		record := func(userID string, at time.Time, latitude float64) {
+			if err := repo.AppendHistory(ctx, models.LocationPoint{UserId: userID, Latitude: latitude, UpdatedAt: at}); err != nil {
+				t.Fatalf("Failed to append history: %v", err)
+			}
+		}
+		record(userID, from.Add(-10*time.Minute), -1)
+		for i := 0; i < 5; i++ {
+			at := from.Add(time.Duration(i) * time.Minute)
+			record(userID, at, float64(i))
+			record(otherID, at, 100)
+		}
+
+		// Pages of two split the second page across the day boundary
+		var pages [][]models.LocationPoint
+		token := ""
+		for {
+			if len(pages) > 10 {
+				t.Fatalf("GetTrajectory did not terminate")
+			}
+			page, next, err := repo.GetTrajectory(ctx, userID, from, to, 2, token)
+			if err != nil {
+				t.Fatalf("Failed to get trajectory: %v", err)
+			}
+			pages = append(pages, page)
+			if next == "" {
+				break
+			}
+			if len(pages) == 1 {
+				// A token can be used again, e.g. to retry a lost page
+				again, againNext, err := repo.GetTrajectory(ctx, userID, from, to, 2, next)
+				if err != nil || len(again) != 2 || again[0].Latitude != 2 || againNext == "" {
+					t.Fatalf("Expected to resume at the third point with more to come, got %+v, %q (%v)", again, againNext, err)
+				}
+			}
+			token = next
+		}
+
+		var points []models.LocationPoint
+		for _, page := range pages {
+			if len(page) > 2 {
+				t.Errorf("Expected pages of at most 2 points, got %d", len(page))
+			}
+			points = append(points, page...)
+		}
+		if len(points) != 5 {
+			t.Fatalf("Expected the 5 points of the user within the range, got %+v", points)
+		}
+		for i, point := range points {
+			if point.UserId != userID || point.Latitude != float64(i) {
+				t.Errorf("Expected point %d of %s, got %+v", i, userID, point)
+			}
+		}
+
+		if _, _, err := repo.GetTrajectory(ctx, userID, from, to, 2, "not-a-token"); !errors.Is(err, repository.ErrInvalidTrajectoryRequest) {
+			t.Errorf("Expected ErrInvalidTrajectoryRequest for a bad page token, got %v", err)
+		}
+		if _, _, err := repo.GetTrajectory(ctx, userID, to.AddDate(0, 0, -32), to, 0, ""); !errors.Is(err, repository.ErrInvalidTrajectoryRequest) {
+			t.Errorf("Expected ErrInvalidTrajectoryRequest for a range over 31 days, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"matching-service/websocket-server/internal/auth"
+	"matching-service/websocket-server/pkg/redis"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+const testSecret = "test_secret"
+
+func signToken(t *testing.T, secret, subject string, expiresAt time.Time) string {
+	return signTokenWithID(t, secret, subject, uuid.New().String(), expiresAt)
+}
+
+func signTokenWithID(t *testing.T, secret, subject, jti string, expiresAt time.Time) string {
+	claims := &auth.Claims{
+		Username: "johndoe",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    auth.DefaultAudience.Issuer,
+			Audience:  jwt.ClaimStrings{auth.DefaultAudience.Audience},
+			Subject:   subject,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return token
+}
+
+func TestAuthenticateTokenSources(t *testing.T) {
+	authenticator := auth.NewJWTAuthenticator(testSecret, auth.DefaultAudience, redis.NewMemoryCache())
+	userID := "550e8400-e29b-41d4-a716-446655440000"
+	token := signToken(t, testSecret, userID, time.Now().Add(time.Hour))
+
+	header := httptest.NewRequest(http.MethodGet, "/location", nil)
+	header.Header.Set("Authorization", "Bearer "+token)
+
+	protocol := httptest.NewRequest(http.MethodGet, "/location", nil)
+	protocol.Header.Set("Sec-WebSocket-Protocol", "bearer, "+token)
+
+	query := httptest.NewRequest(http.MethodGet, "/location?token="+token, nil)
+
+	for name, req := range map[string]*http.Request{"header": header, "protocol": protocol, "query": query} {
+		identity, err := authenticator.Authenticate(req)
+		if err != nil {
+			t.Fatalf("%s: expected token to be accepted, got %v", name, err)
+		}
+		if identity.UserID != userID {
+			t.Errorf("%s: expected user ID %s, got %s", name, userID, identity.UserID)
+		}
+		if identity.Username != "johndoe" {
+			t.Errorf("%s: expected username johndoe, got %s", name, identity.Username)
+		}
+	}
+}
+
+func TestAuthenticateRejectsBadTokens(t *testing.T) {
+	authenticator := auth.NewJWTAuthenticator(testSecret, auth.DefaultAudience, redis.NewMemoryCache())
+	userID := "550e8400-e29b-41d4-a716-446655440000"
+
+	missing := httptest.NewRequest(http.MethodGet, "/location", nil)
+	if _, err := authenticator.Authenticate(missing); !errors.Is(err, auth.ErrMissingToken) {
+		t.Errorf("Expected ErrMissingToken, got %v", err)
+	}
+
+	tokens := map[string]string{
+		"wrong secret": signToken(t, "other_secret", userID, time.Now().Add(time.Hour)),
+		"expired":      signToken(t, testSecret, userID, time.Now().Add(-time.Hour)),
+		"no subject":   signToken(t, testSecret, "", time.Now().Add(time.Hour)),
+		"no jti":       signTokenWithID(t, testSecret, userID, "", time.Now().Add(time.Hour)),
+	}
+	for name, token := range tokens {
+		req := httptest.NewRequest(http.MethodGet, "/location", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if _, err := authenticator.Authenticate(req); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+	// A token meant for another audience
+	other := auth.NewJWTAuthenticator(testSecret, auth.Audience{Issuer: auth.DefaultAudience.Issuer, Audience: "other"}, redis.NewMemoryCache())
+	req := httptest.NewRequest(http.MethodGet, "/location", nil)
+	req.Header.Set("Authorization", "Bearer "+signToken(t, testSecret, userID, time.Now().Add(time.Hour)))
+	if _, err := other.Authenticate(req); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for another audience, got %v", err)
+	}
+}
+
+func TestAuthenticateRejectsRevokedTokens(t *testing.T) {
+	cache := redis.NewMemoryCache()
+	authenticator := auth.NewJWTAuthenticator(testSecret, auth.DefaultAudience, cache)
+	jti := uuid.New().String()
+	expiresAt := time.Now().Add(time.Hour)
+	token := signTokenWithID(t, testSecret, "550e8400-e29b-41d4-a716-446655440000", jti, expiresAt)
+
+	req := httptest.NewRequest(http.MethodGet, "/location", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if _, err := authenticator.Authenticate(req); err != nil {
+		t.Fatalf("Expected token to be accepted, got %v", err)
+	}
+
+	if err := cache.RevokeToken(context.Background(), jti, expiresAt); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if _, err := authenticator.Authenticate(req); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Errorf("Expected ErrRevokedToken, got %v", err)
+	}
+}
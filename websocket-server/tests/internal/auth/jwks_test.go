@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"matching-service/websocket-server/internal/auth"
+	"matching-service/websocket-server/pkg/redis"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+// jwksServer publishes Ed25519 keys the way the api-server does.
+type jwksServer struct {
+	mu   sync.Mutex
+	keys map[string]ed25519.PrivateKey
+}
+
+func (s *jwksServer) add(t *testing.T, kid string) ed25519.PrivateKey {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[kid] = key
+	return key
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []map[string]string{}
+	for kid, key := range s.keys {
+		keys = append(keys, map[string]string{
+			"kty": "OKP", "use": "sig", "alg": "EdDSA", "kid": kid, "crv": "Ed25519",
+			"x": base64.RawURLEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+}
+
+func signEdDSA(t *testing.T, kid string, key ed25519.PrivateKey) string {
+	claims := &auth.Claims{
+		Username: "johndoe",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    auth.DefaultAudience.Issuer,
+			Audience:  jwt.ClaimStrings{auth.DefaultAudience.Audience},
+			Subject:   "550e8400-e29b-41d4-a716-446655440000",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestJWKSAuthenticator(t *testing.T) {
+	server := &jwksServer{keys: map[string]ed25519.PrivateKey{}}
+	oldKey := server.add(t, "old")
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	keys := auth.NewJWKS(httpServer.URL)
+	if err := keys.Start(ctx, time.Hour); err != nil {
+		t.Fatalf("Failed to fetch keys: %v", err)
+	}
+	authenticator := auth.NewJWKSAuthenticator(keys, auth.DefaultAudience, redis.NewMemoryCache())
+
+	authenticate := func(token string) error {
+		req := httptest.NewRequest(http.MethodGet, "/location", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		_, err := authenticator.Authenticate(req)
+		return err
+	}
+
+	if err := authenticate(signEdDSA(t, "old", oldKey)); err != nil {
+		t.Fatalf("Expected token to be accepted, got %v", err)
+	}
+
+	// A key published after the last fetch is picked up on first use
+	newKey := server.add(t, "new")
+	if err := authenticate(signEdDSA(t, "new", newKey)); err != nil {
+		t.Errorf("Expected a token of a rotated in key to be accepted, got %v", err)
+	}
+
+	_, unknownKey, _ := ed25519.GenerateKey(rand.Reader)
+	if err := authenticate(signEdDSA(t, "unknown", unknownKey)); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for an unknown key, got %v", err)
+	}
+	if err := authenticate(signEdDSA(t, "old", unknownKey)); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for a wrong signature, got %v", err)
+	}
+	if err := authenticate(signToken(t, testSecret, "550e8400-e29b-41d4-a716-446655440000", time.Now().Add(time.Hour))); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for an HS256 token, got %v", err)
+	}
+}
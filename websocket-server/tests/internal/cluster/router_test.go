@@ -0,0 +1,139 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"matching-service/websocket-server/internal/cluster"
+	"matching-service/websocket-server/internal/hub"
+	"matching-service/websocket-server/internal/models"
+	"matching-service/websocket-server/internal/protocol"
+	"matching-service/websocket-server/pkg/redis"
+	"testing"
+	"time"
+)
+
+// fakeConn hands pushed messages and close codes to channels.
+type fakeConn struct {
+	pushed chan protocol.Response
+	closed chan int
+}
+
+func (c *fakeConn) Send(response protocol.Response) error {
+	return c.Push(response, "")
+}
+
+func (c *fakeConn) Push(response protocol.Response, key string) error {
+	c.pushed <- response
+	return nil
+}
+
+func (c *fakeConn) Close(code int, reason string) {
+	if c.closed != nil {
+		c.closed <- code
+	}
+}
+
+// startNodes starts two routers sharing one Redis.
+func startNodes(t *testing.T, ctx context.Context) (*cluster.Router, *cluster.Router) {
+	cache := redis.NewMemoryCache()
+	nodeA := cluster.NewRouter("a", hub.NewHub(0), cache, time.Minute)
+	nodeB := cluster.NewRouter("b", hub.NewHub(0), cache, time.Minute)
+	for _, router := range []*cluster.Router{nodeA, nodeB} {
+		if err := router.Start(ctx); err != nil {
+			t.Fatalf("Failed to start router: %v", err)
+		}
+	}
+	return nodeA, nodeB
+}
+
+func TestSendReachesUserOnAnotherNode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nodeA, nodeB := startNodes(t, ctx)
+
+	conn := &fakeConn{pushed: make(chan protocol.Response, 1)}
+	session := nodeB.Register(ctx, "alice", "alice", conn)
+
+	location := models.Location{UserId: "bob", CurrentLatitude: 51.5, CurrentLongitude: -0.12}
+	if delivered := nodeA.SendToUser("alice", protocol.Response{Type: protocol.TypeFriendLocation, Payload: location}, "location:bob"); delivered != 1 {
+		t.Fatalf("Expected the message to be published to node b, got %d deliveries", delivered)
+	}
+	select {
+	case response := <-conn.pushed:
+		// The payload is typed again, so the legacy codec can encode it
+		if got, ok := response.Payload.(models.Location); !ok || got != location {
+			t.Errorf("Expected %+v, got %#v", location, response.Payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the message to reach alice on node b")
+	}
+
+	nodeB.Unregister(ctx, session)
+	if delivered := nodeA.SendToUser("alice", protocol.Response{Type: protocol.TypeFriendLocation, Payload: location}, ""); delivered != 0 {
+		t.Errorf("Expected no route after alice disconnected, got %d deliveries", delivered)
+	}
+}
+
+func TestSessionSendAndKickReachAnotherNode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	nodeA, nodeB := startNodes(t, ctx)
+
+	phone := &fakeConn{pushed: make(chan protocol.Response, 1), closed: make(chan int, 1)}
+	laptop := &fakeConn{pushed: make(chan protocol.Response, 1), closed: make(chan int, 1)}
+	nodeA.Register(ctx, "alice", "alice", phone)
+	laptopSession := nodeB.Register(ctx, "alice", "alice", laptop)
+
+	update := protocol.Response{Type: protocol.TypeMatchUpdate, Payload: protocol.MatchUpdatePayload{}}
+	if err := nodeA.SendToSession("alice", laptopSession.ID, update, ""); err != nil {
+		t.Fatalf("Failed to send to a session on node b: %v", err)
+	}
+	select {
+	case <-laptop.pushed:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the message to reach the laptop on node b")
+	}
+	if len(phone.pushed) != 0 {
+		t.Errorf("Expected the other session not to receive the message")
+	}
+	if err := nodeA.SendToSession("bob", "missing", update, ""); !errors.Is(err, hub.ErrNoSession) {
+		t.Errorf("Expected ErrNoSession for a user without routes, got %v", err)
+	}
+
+	// A session kick closes the laptop on node b only
+	if err := nodeA.KickSession("alice", laptopSession.ID, "test"); err != nil {
+		t.Fatalf("Failed to kick a session on node b: %v", err)
+	}
+	select {
+	case code := <-laptop.closed:
+		if code != hub.CloseKicked {
+			t.Errorf("Expected the laptop to be kicked, got close code %d", code)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the laptop on node b to be kicked")
+	}
+	if len(phone.closed) != 0 {
+		t.Errorf("Expected the phone to stay connected")
+	}
+	if err := nodeA.KickSession("bob", "missing", "test"); !errors.Is(err, hub.ErrNoSession) {
+		t.Errorf("Expected ErrNoSession for a user without routes, got %v", err)
+	}
+
+	// Reconnect the laptop on node b for the kick of every session
+	laptop = &fakeConn{pushed: make(chan protocol.Response, 1), closed: make(chan int, 1)}
+	nodeB.Register(ctx, "alice", "alice", laptop)
+	if kicked := nodeA.Kick("alice", "test"); kicked != 2 {
+		t.Errorf("Expected one local session and one node to be kicked, got %d", kicked)
+	}
+	for name, conn := range map[string]*fakeConn{"phone": phone, "laptop": laptop} {
+		select {
+		case code := <-conn.closed:
+			if code != hub.CloseKicked {
+				t.Errorf("Expected the %s to be kicked, got close code %d", name, code)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected the %s to be kicked", name)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"matching-service/websocket-server/internal/auth"
+	"matching-service/websocket-server/internal/cluster"
+	"matching-service/websocket-server/internal/handler"
+	"matching-service/websocket-server/internal/hub"
+	"matching-service/websocket-server/internal/protocol"
+	"matching-service/websocket-server/pkg/redis"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+const hubTestSecret = "0123456789abcdef0123456789abcdef"
+
+// closedConn records the close code of a session.
+type closedConn struct {
+	code int
+}
+
+func (c *closedConn) Send(response protocol.Response) error             { return nil }
+func (c *closedConn) Push(response protocol.Response, key string) error { return nil }
+func (c *closedConn) Close(code int, reason string)                     { c.code = code }
+
+func signRoles(t *testing.T, roles ...string) string {
+	claims := &auth.Claims{
+		Username: "admin",
+		Roles:    roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			Issuer:    auth.DefaultAudience.Issuer,
+			Audience:  jwt.ClaimStrings{auth.DefaultAudience.Audience},
+			Subject:   uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(hubTestSecret))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestSessionAdminRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sessions := hub.NewHub(0)
+	phone, laptop := &closedConn{}, &closedConn{}
+	phoneSession := sessions.Register("alice", "alice", phone)
+	sessions.Register("alice", "alice", laptop)
+
+	cache := redis.NewMemoryCache()
+	hubHandler := handler.NewHubHandler(cluster.NewRouter("test", sessions, cache, time.Minute), auth.NewJWTAuthenticator(hubTestSecret, auth.DefaultAudience, cache))
+	r := gin.New()
+	admin := r.Group("/", hubHandler.RequireAdmin)
+	admin.GET("/metrics/sessions", hubHandler.Metrics)
+	admin.DELETE("/sessions/:user_id", hubHandler.Kick)
+	admin.DELETE("/sessions/:user_id/:session_id", hubHandler.KickSession)
+
+	adminToken, userToken := signRoles(t, "user", "admin"), signRoles(t, "user")
+	tests := []struct {
+		method string
+		path   string
+		token  string
+		code   int
+	}{
+		{http.MethodGet, "/metrics/sessions", "", http.StatusUnauthorized},
+		{http.MethodGet, "/metrics/sessions", userToken, http.StatusForbidden},
+		{http.MethodGet, "/metrics/sessions", adminToken, http.StatusOK},
+		{http.MethodDelete, "/sessions/alice/" + phoneSession.ID, userToken, http.StatusForbidden},
+		{http.MethodDelete, "/sessions/alice/" + phoneSession.ID, adminToken, http.StatusNoContent},
+		{http.MethodDelete, "/sessions/alice/" + phoneSession.ID, adminToken, http.StatusNotFound},
+		{http.MethodDelete, "/sessions/alice", adminToken, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.path, tt.code, w.Code)
+		}
+	}
+
+	if phone.code != hub.CloseKicked || laptop.code != hub.CloseKicked {
+		t.Errorf("Expected both sessions to be kicked, got %d and %d", phone.code, laptop.code)
+	}
+	if sessions.Online("alice") {
+		t.Errorf("Expected alice to be offline")
+	}
+}
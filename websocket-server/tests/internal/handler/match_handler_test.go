@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"matching-service/websocket-server/internal/auth"
+	"matching-service/websocket-server/internal/handler"
+	"matching-service/websocket-server/internal/matcher"
+	"matching-service/websocket-server/internal/models"
+	"matching-service/websocket-server/internal/repository"
+	"matching-service/websocket-server/pkg/redis"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// A trip across San Francisco, two riders heading the same way and one
+// heading the other way.
+var (
+	rider  = models.Location{UserId: uuid.NewString(), CurrentLatitude: 37.7749, CurrentLongitude: -122.4194, DestinationLatitude: 37.8044, DestinationLongitude: -122.2712}
+	nearby = models.Location{UserId: uuid.NewString(), CurrentLatitude: 37.7760, CurrentLongitude: -122.4170, DestinationLatitude: 37.8080, DestinationLongitude: -122.2690}
+	// further is about 700 m from rider
+	further  = models.Location{UserId: uuid.NewString(), CurrentLatitude: 37.7790, CurrentLongitude: -122.4120, DestinationLatitude: 37.8095, DestinationLongitude: -122.2650}
+	opposite = models.Location{UserId: uuid.NewString(), CurrentLatitude: 37.7750, CurrentLongitude: -122.4190, DestinationLatitude: 37.7450, DestinationLongitude: -122.5700}
+)
+
+// seedRiders caches the riders, further with a position ten minutes old.
+func seedRiders(t *testing.T, cache redis.RedisCacheHandler) {
+	now := time.Now()
+	locations := []models.Location{rider, nearby, further, opposite}
+	for i := range locations {
+		locations[i].UpdatedAt = now
+	}
+	locations[2].UpdatedAt = now.Add(-10 * time.Minute)
+	if err := cache.StoreLocations(context.Background(), locations); err != nil {
+		t.Fatalf("Failed to cache locations: %v", err)
+	}
+}
+
+func TestFindMatchesQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cache := redis.NewMemoryCache()
+	seedRiders(t, cache)
+	matchHandler := handler.NewMatchHandler(matcher.NewMatcherService(repository.NewMemoryLocationRepo(), cache), auth.NewGatewayAuthenticator())
+	r := gin.New()
+	r.POST("/matches", matchHandler.FindMatches)
+
+	tests := []struct {
+		name    string
+		body    string
+		code    int
+		matches []string
+	}{
+		{name: "defaults", body: "", code: http.StatusOK, matches: []string{nearby.UserId, further.UserId}},
+		{name: "radius in meters", body: `{"radius":500,"unit":"m"}`, code: http.StatusOK, matches: []string{nearby.UserId}},
+		{name: "max results", body: `{"max_results":1}`, code: http.StatusOK, matches: []string{nearby.UserId}},
+		{name: "max age", body: `{"max_age":60}`, code: http.StatusOK, matches: []string{nearby.UserId}},
+		{name: "blocked", body: `{"blocked_users":["` + nearby.UserId + `"]}`, code: http.StatusOK, matches: []string{further.UserId}},
+		{name: "unknown unit", body: `{"unit":"parsec"}`, code: http.StatusBadRequest},
+		{name: "negative max age", body: `{"max_age":-1}`, code: http.StatusBadRequest},
+		{name: "malformed", body: `{"radius":"far"}`, code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/matches", strings.NewReader(tt.body))
+		req.Header.Set(auth.UserIDHeader, rider.UserId)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d (%s)", tt.name, tt.code, w.Code, w.Body.String())
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var response struct {
+			Matches []models.Match `json:"matches"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", tt.name, err)
+		}
+		if got := matchIDs(response.Matches); !sameIDs(got, tt.matches...) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.matches, got)
+		}
+	}
+}
+
+// sameIDs compares IDs in order, as matches are ranked.
+func sameIDs(got []string, want ...string) bool {
+	return strings.Join(got, ",") == strings.Join(want, ",")
+}
+
+func matchIDs(matches []models.Match) []string {
+	ids := make([]string, len(matches))
+	for i, match := range matches {
+		ids[i] = match.UserId
+	}
+	return ids
+}
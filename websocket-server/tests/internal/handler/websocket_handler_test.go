@@ -0,0 +1,372 @@
+package handler
+
+import (
+	"context"
+	"matching-service/websocket-server/internal/auth"
+	"matching-service/websocket-server/internal/cluster"
+	"matching-service/websocket-server/internal/config"
+	"matching-service/websocket-server/internal/handler"
+	"matching-service/websocket-server/internal/hub"
+	"matching-service/websocket-server/internal/matcher"
+	"matching-service/websocket-server/internal/models"
+	"matching-service/websocket-server/internal/protocol"
+	"matching-service/websocket-server/internal/repository"
+	"matching-service/websocket-server/internal/validation"
+	"matching-service/websocket-server/pkg/redis"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// testServer runs a handler backed by the in-memory storage.
+type testServer struct {
+	url   string
+	cache redis.RedisCacheHandler
+}
+
+func newTestServer(t *testing.T, heartbeat config.Heartbeat) *testServer {
+	gin.SetMode(gin.TestMode)
+	repo := repository.NewMemoryLocationRepo()
+	cache := redis.NewMemoryCache()
+	matcherService := matcher.NewMatcherService(repo, cache)
+	wsHandler := handler.NewWebSocketHandler(repo, cache, auth.NewGatewayAuthenticator(), matcherService, validation.NewValidator(validation.DefaultLimits), heartbeat, config.DefaultOutbound, cluster.NewRouter("test", hub.NewHub(0), cache, heartbeat.PresenceTTL))
+
+	r := gin.New()
+	r.GET("/location", wsHandler.HandleWebSocket)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return &testServer{url: "ws" + strings.TrimPrefix(server.URL, "http") + "/location", cache: cache}
+}
+
+// dial connects as the user identified by the gateway headers, offering the
+// given subprotocols.
+func (s *testServer) dial(t *testing.T, userID string, subprotocols ...string) *websocket.Conn {
+	header := http.Header{}
+	header.Set(auth.UserIDHeader, userID)
+	dialer := websocket.Dialer{Subprotocols: subprotocols}
+	conn, _, err := dialer.Dial(s.url, header)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func dial(t *testing.T, userID string, subprotocols ...string) *websocket.Conn {
+	return newTestServer(t, config.DefaultHeartbeat).dial(t, userID, subprotocols...)
+}
+
+func roundTrip(t *testing.T, conn *websocket.Conn, request interface{}) models.WebSocketMessage {
+	t.Helper()
+	if err := conn.WriteJSON(request); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var response models.WebSocketMessage
+	if err := conn.ReadJSON(&response); err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	return response
+}
+
+func TestAcksAndErrorsEchoRequestID(t *testing.T) {
+	userID := uuid.New().String()
+	conn := dial(t, userID)
+
+	tests := []struct {
+		name    string
+		request models.WebSocketMessage
+		action  string
+		code    string
+	}{
+		{
+			name:    "update acked",
+			request: models.WebSocketMessage{Action: "update_current_location", RequestID: "r1", Latitude: 37.7749, Longitude: -122.4194},
+			action:  "ack",
+		},
+		{
+			name:    "own location",
+			request: models.WebSocketMessage{Action: "get_location", RequestID: "r2", UserID: userID},
+			action:  "location",
+		},
+		{
+			name:    "unknown user",
+			request: models.WebSocketMessage{Action: "get_location", RequestID: "r3", UserID: uuid.New().String()},
+			action:  "error",
+			code:    "not_found",
+		},
+		{
+			name:    "unknown action",
+			request: models.WebSocketMessage{Action: "teleport", RequestID: "r4"},
+			action:  "error",
+			code:    "validation",
+		},
+		{
+			name:    "null island",
+			request: models.WebSocketMessage{Action: "update_current_location", RequestID: "r6", Latitude: 0, Longitude: 0},
+			action:  "error",
+			code:    "validation",
+		},
+		{
+			name:    "teleport to New York",
+			request: models.WebSocketMessage{Action: "update_current_location", RequestID: "r7", Latitude: 40.7128, Longitude: -74.0060},
+			action:  "error",
+			code:    "validation",
+		},
+		{
+			name:    "invalid query",
+			request: models.WebSocketMessage{Action: "find_matches", RequestID: "r5", Query: &models.MatchQuery{Unit: "parsec"}},
+			action:  "error",
+			code:    "validation",
+		},
+	}
+
+	for _, tt := range tests {
+		response := roundTrip(t, conn, tt.request)
+		if response.RequestID != tt.request.RequestID {
+			t.Errorf("%s: expected request_id %q, got %q", tt.name, tt.request.RequestID, response.RequestID)
+		}
+		if response.Action != tt.action || response.Code != tt.code {
+			t.Errorf("%s: expected %s/%q, got %s/%q (%s)", tt.name, tt.action, tt.code, response.Action, response.Code, response.Error)
+		}
+	}
+
+	response := roundTrip(t, conn, map[string]interface{}{"action": "update", "current_latitude": "north"})
+	if response.Action != "error" || response.Code != "validation" {
+		t.Errorf("malformed message: expected a validation error, got %+v", response)
+	}
+}
+
+func TestMovementCheckedAcrossReconnects(t *testing.T) {
+	server := newTestServer(t, config.DefaultHeartbeat)
+	userID := uuid.New().String()
+
+	conn := server.dial(t, userID)
+	sf := models.WebSocketMessage{Action: "update_current_location", RequestID: "m1", Latitude: 37.7749, Longitude: -122.4194}
+	if response := roundTrip(t, conn, sf); response.Action != "ack" {
+		t.Fatalf("Expected the first position to be acked, got %+v", response)
+	}
+	conn.Close()
+
+	// A new connection starts from the stored point, not from nowhere
+	conn = server.dial(t, userID)
+	newYork := models.WebSocketMessage{Action: "update_current_location", RequestID: "m2", Latitude: 40.7128, Longitude: -74.0060}
+	if response := roundTrip(t, conn, newYork); response.Action != "error" || response.Code != "validation" {
+		t.Errorf("Expected the jump after reconnecting to be rejected, got %+v", response)
+	}
+	nearby := models.WebSocketMessage{Action: "update_current_location", RequestID: "m3", Latitude: 37.7755, Longitude: -122.4180}
+	if response := roundTrip(t, conn, nearby); response.Action != "ack" {
+		t.Errorf("Expected a nearby position to be acked, got %+v", response)
+	}
+}
+
+func TestV1Envelope(t *testing.T) {
+	userID := uuid.New().String()
+	conn := dial(t, userID, protocol.SubprotocolV1)
+	if conn.Subprotocol() != protocol.SubprotocolV1 {
+		t.Fatalf("Expected %s to be negotiated, got %q", protocol.SubprotocolV1, conn.Subprotocol())
+	}
+
+	tests := []struct {
+		name     string
+		frame    string
+		response string
+	}{
+		{
+			name:     "position on the equator",
+			frame:    `{"v":1,"type":"update_current_location","request_id":"r1","payload":{"position":{"latitude":0,"longitude":9.5}}}`,
+			response: `{"v":1,"type":"ack","request_id":"r1","payload":{}}`,
+		},
+		{
+			name:     "unknown field",
+			frame:    `{"v":1,"type":"update_destination","request_id":"r2","payload":{"destination":{"latitude":1,"longitude":2},"eta":5}}`,
+			response: `{"v":1,"type":"error","request_id":"r2","payload":{"code":"validation","message":"malformed payload: json: unknown field \"eta\""}}`,
+		},
+	}
+	for _, tt := range tests {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(tt.frame)); err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		if string(data) != tt.response {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.response, data)
+		}
+	}
+
+	var response protocol.Envelope
+	if err := conn.WriteJSON(protocol.Envelope{V: 1, Type: protocol.TypeGetLocation, RequestID: "r3", Payload: protocol.LocationQuery{UserID: userID}}); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	if err := conn.ReadJSON(&response); err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	location, _ := response.Payload.(map[string]interface{})
+	if response.Type != protocol.TypeLocation || location["current_latitude"] != 0.0 || location["current_longitude"] != 9.5 {
+		t.Errorf("Expected the stored position back, got %+v", response)
+	}
+}
+
+func TestHeartbeatAndPresence(t *testing.T) {
+	server := newTestServer(t, config.Heartbeat{
+		PingInterval: 50 * time.Millisecond,
+		PongWait:     200 * time.Millisecond,
+		WriteWait:    time.Second,
+		PresenceTTL:  time.Minute,
+	})
+	userID := uuid.New().String()
+	conn := server.dial(t, userID)
+
+	presence := waitForPresence(t, server.cache, userID, true)
+	if presence.LastSeen.IsZero() {
+		t.Errorf("Expected last_seen to be set while online")
+	}
+
+	// Reading answers pings, so the connection outlives PongWait
+	pings := 0
+	conn.SetPingHandler(func(data string) error {
+		pings++
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	if _, _, err := conn.ReadMessage(); !isTimeout(err) {
+		t.Fatalf("Expected the read to time out on a live connection, got %v", err)
+	}
+	if pings < 2 {
+		t.Errorf("Expected the server to keep pinging, got %d pings", pings)
+	}
+
+	// A second connection that never answers pings is closed after PongWait
+	silent := server.dial(t, uuid.New().String())
+	time.Sleep(400 * time.Millisecond)
+	silent.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := silent.ReadMessage(); err == nil || isTimeout(err) {
+		t.Errorf("Expected the server to close a silent connection, got %v", err)
+	}
+
+	conn.Close()
+	waitForPresence(t, server.cache, userID, false)
+}
+
+func waitForPresence(t *testing.T, cache redis.RedisCacheHandler, userID string, online bool) models.Presence {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		presence, err := cache.GetPresence(context.Background(), userID)
+		if err != nil {
+			t.Fatalf("Failed to get presence: %v", err)
+		}
+		if presence.Online == online {
+			return presence
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected online=%t, got %+v", online, presence)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+func TestSubscribeFriends(t *testing.T) {
+	server := newTestServer(t, config.DefaultHeartbeat)
+	userID, friendID := uuid.New().String(), uuid.New().String()
+	conn := server.dial(t, userID, protocol.SubprotocolV1)
+	friend := server.dial(t, friendID)
+
+	if err := server.cache.AddFriend(context.Background(), userID, friendID); err != nil {
+		t.Fatalf("Failed to add friend: %v", err)
+	}
+	var response protocol.Envelope
+	if err := conn.WriteJSON(protocol.Envelope{V: 1, Type: protocol.TypeSubscribeFriends, RequestID: "f1", Payload: protocol.Empty{}}); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	if err := conn.ReadJSON(&response); err != nil || response.Type != protocol.TypeAck {
+		t.Fatalf("Expected the subscription to be acked, got %+v (%v)", response, err)
+	}
+
+	move := models.WebSocketMessage{Action: "update_current_location", Latitude: 37.7749, Longitude: -122.4194}
+	if response := roundTrip(t, friend, move); response.Action != "ack" {
+		t.Fatalf("Expected the friend's update to be acked, got %+v", response)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&response); err != nil {
+		t.Fatalf("Failed to read friend location: %v", err)
+	}
+	location, _ := response.Payload.(map[string]interface{})
+	if response.Type != protocol.TypeFriendLocation || response.RequestID != "f1" || location["user_id"] != friendID {
+		t.Errorf("Expected the friend's location for request f1, got %+v", response)
+	}
+}
+
+func TestMatchStreamDiffs(t *testing.T) {
+	server := newTestServer(t, config.DefaultHeartbeat)
+	seedRiders(t, server.cache)
+	conn := server.dial(t, rider.UserId)
+
+	subscribe := models.WebSocketMessage{Action: "subscribe_matches", RequestID: "s1", Query: &models.MatchQuery{}}
+	if err := conn.WriteJSON(subscribe); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	update := readAcked(t, conn, "match_update")
+	if update.RequestID != "s1" || !sameIDs(matchIDs(update.Added), nearby.UserId, further.UserId) || len(update.Removed) != 0 {
+		t.Fatalf("Expected nearby and further added for s1, got %+v", update)
+	}
+
+	// further drives off and a newcomer shows up; the rider moving a few
+	// meters re-runs the matching
+	ctx := context.Background()
+	if err := server.cache.StorePosition(ctx, further.UserId, 34.0522, -118.2437, time.Now()); err != nil {
+		t.Fatalf("Failed to move further: %v", err)
+	}
+	newcomer := nearby
+	newcomer.UserId = uuid.NewString()
+	newcomer.UpdatedAt = time.Now()
+	if _, err := server.cache.StoreLocation(ctx, newcomer); err != nil {
+		t.Fatalf("Failed to cache newcomer: %v", err)
+	}
+	if err := conn.WriteJSON(models.WebSocketMessage{Action: "update_current_location", RequestID: "m1", Latitude: 37.7750, Longitude: -122.4194}); err != nil {
+		t.Fatalf("Failed to move: %v", err)
+	}
+	update = readAcked(t, conn, "match_update")
+	if !sameIDs(matchIDs(update.Added), newcomer.UserId) || !sameIDs(update.Removed, further.UserId) {
+		t.Errorf("Expected newcomer added and further removed, got %+v", update)
+	}
+}
+
+// readAcked reads frames until it has seen an ack and returns the frame of
+// the given action, which may arrive before or after the ack.
+func readAcked(t *testing.T, conn *websocket.Conn, action string) models.WebSocketMessage {
+	t.Helper()
+	var found *models.WebSocketMessage
+	acked := false
+	for !acked || found == nil {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var message models.WebSocketMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("Failed to read %s: %v", action, err)
+		}
+		switch message.Action {
+		case "ack":
+			acked = true
+		case action:
+			found = &message
+		default:
+			t.Fatalf("Unexpected message %+v", message)
+		}
+	}
+	return *found
+}
@@ -0,0 +1,95 @@
+package hub
+
+import (
+	"errors"
+	"matching-service/websocket-server/internal/hub"
+	"matching-service/websocket-server/internal/protocol"
+	"sync"
+	"testing"
+)
+
+type fakeConn struct {
+	mu         sync.Mutex
+	pushed     []protocol.Response
+	closedWith int
+}
+
+func (c *fakeConn) Send(response protocol.Response) error {
+	return c.Push(response, "")
+}
+
+func (c *fakeConn) Push(response protocol.Response, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closedWith != 0 {
+		return errors.New("closed")
+	}
+	c.pushed = append(c.pushed, response)
+	return nil
+}
+
+func (c *fakeConn) Close(code int, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closedWith = code
+}
+
+func TestTargetedSendAndBroadcast(t *testing.T) {
+	sessions := hub.NewHub(0)
+	phone, laptop, other := &fakeConn{}, &fakeConn{}, &fakeConn{}
+	phoneSession := sessions.Register("alice", "alice", phone)
+	sessions.Register("alice", "alice", laptop)
+	sessions.Register("bob", "bob", other)
+
+	update := protocol.Response{Type: protocol.TypeFriendLocation}
+	if delivered := sessions.SendToUser("alice", update, ""); delivered != 2 {
+		t.Errorf("Expected delivery to both of alice's devices, got %d", delivered)
+	}
+	if err := sessions.SendToSession(phoneSession.ID, update, ""); err != nil {
+		t.Errorf("Failed to send to a session: %v", err)
+	}
+	if delivered := sessions.Broadcast(update, ""); delivered != 3 {
+		t.Errorf("Expected a broadcast to reach 3 sessions, got %d", delivered)
+	}
+	if len(phone.pushed) != 3 || len(laptop.pushed) != 2 || len(other.pushed) != 1 {
+		t.Errorf("Unexpected deliveries: phone %d, laptop %d, other %d", len(phone.pushed), len(laptop.pushed), len(other.pushed))
+	}
+
+	sessions.Unregister(phoneSession)
+	sessions.Unregister(phoneSession)
+	if err := sessions.SendToSession(phoneSession.ID, update, ""); !errors.Is(err, hub.ErrNoSession) {
+		t.Errorf("Expected ErrNoSession after unregistering, got %v", err)
+	}
+	if got := len(sessions.Sessions("alice")); got != 1 {
+		t.Errorf("Expected alice to have 1 session left, got %d", got)
+	}
+
+	metrics := sessions.Metrics()
+	if metrics.Users != 2 || metrics.Sessions != 2 || metrics.Registered != 3 || metrics.Unregistered != 1 || metrics.Delivered != 6 {
+		t.Errorf("Unexpected metrics: %+v", metrics)
+	}
+}
+
+func TestSessionLimitAndKick(t *testing.T) {
+	sessions := hub.NewHub(1)
+	first, second := &fakeConn{}, &fakeConn{}
+	sessions.Register("alice", "alice", first)
+	sessions.Register("alice", "alice", second)
+
+	if first.closedWith != hub.CloseReplaced {
+		t.Errorf("Expected the older session to be replaced, got close code %d", first.closedWith)
+	}
+	if !sessions.Online("alice") || len(sessions.Sessions("alice")) != 1 {
+		t.Errorf("Expected alice to keep exactly one session")
+	}
+
+	if kicked := sessions.Kick("alice", "banned"); kicked != 1 {
+		t.Errorf("Expected 1 kicked session, got %d", kicked)
+	}
+	if second.closedWith != hub.CloseKicked || sessions.Online("alice") {
+		t.Errorf("Expected alice to be kicked, got close code %d", second.closedWith)
+	}
+	if metrics := sessions.Metrics(); metrics.Kicked != 2 || metrics.Sessions != 0 {
+		t.Errorf("Unexpected metrics: %+v", metrics)
+	}
+}
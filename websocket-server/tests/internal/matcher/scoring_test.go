@@ -0,0 +1,77 @@
+package matcher
+
+import (
+	"matching-service/websocket-server/internal/matcher"
+	"matching-service/websocket-server/internal/models"
+	"matching-service/websocket-server/pkg/geo"
+	"math"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	// San Francisco to New York is roughly 4130 km
+	distance := geo.Distance(37.7749, -122.4194, 40.7128, -74.0060)
+	if math.Abs(distance-4129000) > 10000 {
+		t.Errorf("Expected about 4129 km, got %.0f m", distance)
+	}
+
+	// One degree of longitude shrinks with latitude, one degree of latitude does not
+	equator := geo.Distance(0, 0, 0, 1)
+	north := geo.Distance(60, 0, 60, 1)
+	if math.Abs(north-equator/2) > 1000 {
+		t.Errorf("Expected a degree of longitude at 60N to be half of one at the equator, got %.0f and %.0f", north, equator)
+	}
+}
+
+func TestRankCandidates(t *testing.T) {
+	user := models.Location{
+		UserId:               "user",
+		CurrentLatitude:      37.7749,
+		CurrentLongitude:     -122.4194,
+		DestinationLatitude:  37.8044,
+		DestinationLongitude: -122.2712,
+	}
+	candidates := []models.Location{
+		user,
+		{
+			// Same direction, slightly different but close destination
+			UserId:               "close",
+			CurrentLatitude:      37.7760,
+			CurrentLongitude:     -122.4170,
+			DestinationLatitude:  37.8080,
+			DestinationLongitude: -122.2690,
+		},
+		{
+			// Same direction, destination further away
+			UserId:               "further",
+			CurrentLatitude:      37.7790,
+			CurrentLongitude:     -122.4120,
+			DestinationLatitude:  37.8095,
+			DestinationLongitude: -122.2650,
+		},
+		{
+			// Opposite direction
+			UserId:               "opposite",
+			CurrentLatitude:      37.7750,
+			CurrentLongitude:     -122.4190,
+			DestinationLatitude:  37.7450,
+			DestinationLongitude: -122.5700,
+		},
+	}
+
+	matches := matcher.RankCandidates(user, candidates, models.MatchCriteria{})
+	if len(matches) != 2 {
+		t.Fatalf("Expected 2 matches, got %d: %+v", len(matches), matches)
+	}
+	if matches[0].UserId != "close" || matches[1].UserId != "further" {
+		t.Errorf("Expected matches ranked close, further, got %s, %s", matches[0].UserId, matches[1].UserId)
+	}
+	if matches[0].Score <= matches[1].Score || matches[0].Score > 1 {
+		t.Errorf("Expected descending scores in (0, 1], got %f, %f", matches[0].Score, matches[1].Score)
+	}
+
+	strict := matcher.RankCandidates(user, candidates, models.MatchCriteria{MaxPickupDetour: 100, MaxDropoffDetour: 100})
+	if len(strict) != 0 {
+		t.Errorf("Expected no matches with strict criteria, got %+v", strict)
+	}
+}
@@ -0,0 +1,64 @@
+package matcher
+
+import (
+	"context"
+	"errors"
+	"matching-service/websocket-server/internal/matcher"
+	"matching-service/websocket-server/internal/models"
+	"matching-service/websocket-server/internal/repository"
+	"matching-service/websocket-server/pkg/redis"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSyncResumesFromPageState(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryLocationRepo()
+	cache := redis.NewMemoryCache()
+	userIDs := make([]string, 7)
+	for i := range userIDs {
+		userIDs[i] = uuid.New().String()
+		location := models.Location{UserId: userIDs[i], CurrentLatitude: float64(i + 1), CurrentLongitude: float64(i + 1), UpdatedAt: time.Now()}
+		if err := repo.Create(ctx, location); err != nil {
+			t.Fatalf("Failed to create location: %v", err)
+		}
+	}
+	service := matcher.NewMatcherService(repo, cache)
+
+	// Stop after the second batch of three, as a restart would
+	stopped, cancel := context.WithCancel(ctx)
+	var reported []matcher.SyncProgress
+	progress, err := service.SyncLocationToRedis(stopped, matcher.SyncOptions{
+		BatchSize: 3,
+		Progress: func(p matcher.SyncProgress) {
+			reported = append(reported, p)
+			if p.Batches == 2 {
+				cancel()
+			}
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the sync to stop with the context, got %v", err)
+	}
+	if len(reported) != 2 || reported[0].Synced != 3 || reported[1].Synced != 6 {
+		t.Fatalf("Expected progress after 3 and 6 locations, got %+v", reported)
+	}
+	if progress.Synced != 6 || progress.Batches != 2 || progress.PageState == nil {
+		t.Fatalf("Expected 6 locations in 2 batches and a page state to resume from, got %+v", progress)
+	}
+
+	progress, err = service.SyncLocationToRedis(ctx, matcher.SyncOptions{BatchSize: 3, PageState: progress.PageState})
+	if err != nil {
+		t.Fatalf("Failed to resume the sync: %v", err)
+	}
+	if progress.Synced != 1 || progress.Batches != 1 || progress.PageState != nil {
+		t.Errorf("Expected the last location in one batch and no page state, got %+v", progress)
+	}
+	for _, userID := range userIDs {
+		if _, err := cache.Getlocation(ctx, userID); err != nil {
+			t.Errorf("Expected user %s in the cache: %v", userID, err)
+		}
+	}
+}
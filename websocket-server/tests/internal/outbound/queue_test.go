@@ -0,0 +1,97 @@
+package outbound
+
+import (
+	"errors"
+	"matching-service/websocket-server/internal/config"
+	"matching-service/websocket-server/internal/outbound"
+	"matching-service/websocket-server/internal/protocol"
+	"testing"
+)
+
+func response(requestID string) protocol.Response {
+	return protocol.Response{Type: protocol.TypeAck, RequestID: requestID}
+}
+
+func drain(q *outbound.Queue) []string {
+	var requestIDs []string
+	for {
+		next, ok := q.Next()
+		if !ok {
+			return requestIDs
+		}
+		requestIDs = append(requestIDs, next.RequestID)
+	}
+}
+
+func assertOrder(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestRepliesBeforePushes(t *testing.T) {
+	q := outbound.NewQueue(10, config.DropOldest)
+	q.Send(outbound.Push, response("push1"), "")
+	q.Send(outbound.Reply, response("reply1"), "")
+	q.Send(outbound.Push, response("push2"), "")
+	q.Send(outbound.Reply, response("reply2"), "")
+
+	select {
+	case <-q.Ready():
+	default:
+		t.Fatalf("Expected the queue to be ready")
+	}
+	assertOrder(t, drain(q), "reply1", "reply2", "push1", "push2")
+}
+
+func TestCoalescing(t *testing.T) {
+	q := outbound.NewQueue(10, config.DropOldest)
+	q.Send(outbound.Push, response("alice@1"), "location:alice")
+	q.Send(outbound.Push, response("bob@1"), "location:bob")
+	q.Send(outbound.Push, response("alice@2"), "location:alice")
+	assertOrder(t, drain(q), "alice@2", "bob@1")
+
+	// Once written, the next update for the key is queued again
+	q.Send(outbound.Push, response("alice@3"), "location:alice")
+	assertOrder(t, drain(q), "alice@3")
+}
+
+func TestDropOldest(t *testing.T) {
+	q := outbound.NewQueue(2, config.DropOldest)
+	for _, requestID := range []string{"push1", "push2", "push3"} {
+		if err := q.Send(outbound.Push, response(requestID), ""); err != nil {
+			t.Fatalf("Expected pushes to be dropped rather than fail, got %v", err)
+		}
+	}
+	if q.Dropped() != 1 {
+		t.Errorf("Expected 1 dropped push, got %d", q.Dropped())
+	}
+	assertOrder(t, drain(q), "push2", "push3")
+
+	// Replies are never dropped, a full reply queue means the client is gone
+	q.Send(outbound.Reply, response("reply1"), "")
+	q.Send(outbound.Reply, response("reply2"), "")
+	if err := q.Send(outbound.Reply, response("reply3"), ""); !errors.Is(err, outbound.ErrSlowConsumer) {
+		t.Errorf("Expected ErrSlowConsumer for a full reply queue, got %v", err)
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	q := outbound.NewQueue(1, config.Disconnect)
+	q.Send(outbound.Push, response("push1"), "")
+	if err := q.Send(outbound.Push, response("push2"), ""); !errors.Is(err, outbound.ErrSlowConsumer) {
+		t.Fatalf("Expected ErrSlowConsumer, got %v", err)
+	}
+	if !q.Overflowed() {
+		t.Errorf("Expected the queue to report the overflow")
+	}
+	if err := q.Send(outbound.Reply, response("reply1"), ""); !errors.Is(err, outbound.ErrClosed) {
+		t.Errorf("Expected ErrClosed after an overflow, got %v", err)
+	}
+}
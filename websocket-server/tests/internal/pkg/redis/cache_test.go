@@ -3,23 +3,21 @@ package redis
 import (
 	"context"
 	"fmt"
-	"log"
+	"matching-service/websocket-server/internal/config"
 	"matching-service/websocket-server/internal/models"
 	"matching-service/websocket-server/internal/repository"
 	"matching-service/websocket-server/pkg/database"
 	"matching-service/websocket-server/pkg/redis"
+	"matching-service/websocket-server/tests/conformance"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/joho/godotenv"
 )
 
 func TestCache(t *testing.T) {
-	if err := godotenv.Load(".env.test"); err != nil {
-		log.Fatalf("Error loading .env.test file")
-	}
+	conformance.RequireBackends(t)
 
 	// Set up real Cassandra session
 	keyspace := os.Getenv("CASSANDRA_KEYSPACE")
@@ -27,7 +25,7 @@ func TestCache(t *testing.T) {
 	database.Init(keyspace)
 	session := database.GetSession()
 	// Create the repo with the real session
-	repo := repository.NewLocationRepo(session, keyspace)
+	repo := repository.NewLocationRepo(session, keyspace, config.DefaultTimeouts)
 
 	// redis connection
 	redisHost := os.Getenv("REDIS_HOST")
@@ -35,7 +33,7 @@ func TestCache(t *testing.T) {
 	redis.InitClient(context.Background(), redisPort, redisHost)
 
 	redisClient := redis.GetClient()
-	redisCache := redis.NewRedisCache(context.Background(), redisClient)
+	redisCache := redis.NewRedisCache(redisClient, config.DefaultTimeouts.Redis)
 
 	userId := uuid.New().String()
 	// Create a sample location
@@ -50,11 +48,11 @@ func TestCache(t *testing.T) {
 	}
 
 	// Test the Create method
-	err := repo.Create(location)
+	err := repo.Create(context.Background(), location)
 	if err != nil {
 		t.Fatalf("Failed to create location: %v", err)
 	}
-	savedLoc, err := redisCache.StoreLocation(location)
+	savedLoc, err := redisCache.StoreLocation(context.Background(), location)
 	if err != nil {
 		t.Fatalf("Failed to cache location: %v", err)
 	}
@@ -63,7 +61,7 @@ func TestCache(t *testing.T) {
 	}
 
 	// Optionally, retrieve and validate the record
-	savedLocation, err := repo.GetByUserID(userId)
+	savedLocation, err := repo.GetByUserID(context.Background(), userId)
 	if err != nil {
 		t.Fatalf("Failed to get location: %v", err)
 	}
@@ -71,7 +69,7 @@ func TestCache(t *testing.T) {
 		t.Errorf("Expected user ID %v, got %v", location.UserId, savedLocation.UserId)
 	}
 
-	savedCacheLocation, err := redisCache.Getlocation(savedLoc.UserId)
+	savedCacheLocation, err := redisCache.Getlocation(context.Background(), savedLoc.UserId)
 	if err != nil {
 		t.Fatalf("Failed to retrieve from cache location: %v", err)
 	}
@@ -79,3 +77,28 @@ func TestCache(t *testing.T) {
 		t.Errorf("Expected user ID from cache %v, got %v", location.UserId, savedLoc.UserId)
 	}
 }
+
+func TestMemoryCache(t *testing.T) {
+	conformance.RunCache(t, func(t *testing.T) redis.RedisCacheHandler {
+		return redis.NewMemoryCache()
+	})
+}
+
+func TestRedisCache(t *testing.T) {
+	conformance.RequireBackends(t)
+
+	redis.InitClient(context.Background(), os.Getenv("REDIS_PORT"), os.Getenv("REDIS_HOST"))
+	client := redis.GetClient()
+	conformance.RunCache(t, func(t *testing.T) redis.RedisCacheHandler {
+		// A fresh prefix per subtest keeps Nearby results to its own users
+		prefix := "test:" + uuid.New().String() + ":"
+		t.Cleanup(func() {
+			stale, _ := client.Keys(context.Background(), prefix+"*").Result()
+			if len(stale) > 0 {
+				client.Del(context.Background(), stale...)
+			}
+		})
+		keys := redis.NewKeys(prefix)
+		return redis.NewRedisCacheWithKeys(client, keys, config.DefaultTimeouts.Redis)
+	})
+}
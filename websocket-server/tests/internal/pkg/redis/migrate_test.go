@@ -0,0 +1,94 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"matching-service/websocket-server/pkg/redis"
+	"matching-service/websocket-server/tests/conformance"
+	"os"
+	"testing"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// migrationDB is a scratch database the migration test flushes, as the
+// legacy layouts are not namespaced by a prefix.
+const migrationDB = 15
+
+func TestMigrateLegacyKeys(t *testing.T) {
+	conformance.RequireBackends(t)
+
+	ctx := context.Background()
+	client := goredis.NewClient(&goredis.Options{
+		Addr: fmt.Sprintf("%s:%s", os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT")),
+		DB:   migrationDB,
+	})
+	t.Cleanup(func() {
+		client.FlushDB(context.Background())
+		client.Close()
+	})
+	if err := client.FlushDB(ctx).Err(); err != nil {
+		t.Fatalf("Failed to flush scratch database: %v", err)
+	}
+
+	keys := redis.DefaultKeys
+	// The live index, a per-user geo:<id> set, a geo:<id> set without its
+	// user and the shared user_locations set with a bare destination hash
+	seed := []error{
+		client.GeoAdd(ctx, keys.Locations(), &goredis.GeoLocation{Name: "live", Latitude: 37.7749, Longitude: -122.4194}).Err(),
+		client.GeoAdd(ctx, "geo:alice", &goredis.GeoLocation{Name: "alice", Latitude: 34.0522, Longitude: -118.2437}).Err(),
+		client.GeoAdd(ctx, "geo:carol", &goredis.GeoLocation{Name: "someone", Latitude: 40.7128, Longitude: -74.0060}).Err(),
+		client.GeoAdd(ctx, "user_locations", &goredis.GeoLocation{Name: "user:dave", Latitude: 37.8044, Longitude: -122.2712}).Err(),
+		client.HSet(ctx, "dave", "destination_lat", 37.3382, "destination_lon", -121.8863).Err(),
+	}
+	for _, err := range seed {
+		if err != nil {
+			t.Fatalf("Failed to seed legacy keys: %v", err)
+		}
+	}
+	want := redis.MigrationStats{Positions: 2, Destinations: 1, DeletedKeys: 3}
+
+	stats, err := redis.MigrateLegacyKeys(ctx, client, keys, true)
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if stats != want {
+		t.Errorf("Dry run: expected %+v, got %+v", want, stats)
+	}
+	if n := client.Exists(ctx, "geo:alice", "geo:carol", "user_locations", "dave").Val(); n != 4 {
+		t.Errorf("Expected the dry run to keep every legacy key, %d of 4 left", n)
+	}
+	if n := client.ZCard(ctx, keys.Locations()).Val(); n != 1 {
+		t.Errorf("Expected the dry run not to write positions, got %d members", n)
+	}
+	if n := client.Exists(ctx, keys.Destination("dave")).Val(); n != 0 {
+		t.Errorf("Expected the dry run not to write destinations")
+	}
+
+	stats, err = redis.MigrateLegacyKeys(ctx, client, keys, false)
+	if err != nil {
+		t.Fatalf("Migration failed: %v", err)
+	}
+	if stats != want {
+		t.Errorf("Migration: expected %+v, got %+v", want, stats)
+	}
+	if n := client.Exists(ctx, "geo:alice", "user_locations", "dave").Val(); n != 0 {
+		t.Errorf("Expected migrated legacy keys to be deleted, %d left", n)
+	}
+	if n := client.Exists(ctx, "geo:carol").Val(); n != 1 {
+		t.Errorf("Expected a geo key without its user's position to be kept")
+	}
+	members := client.ZRange(ctx, keys.Locations(), 0, -1).Val()
+	if len(members) != 3 {
+		t.Fatalf("Expected live, alice and dave in the live index, got %v", members)
+	}
+	for _, member := range []string{"live", "alice", "dave"} {
+		if _, err := client.ZScore(ctx, keys.Locations(), member).Result(); err != nil {
+			t.Errorf("Expected %s in the live index: %v", member, err)
+		}
+	}
+	destination := client.HMGet(ctx, keys.Destination("dave"), "destination_lat", "destination_lon").Val()
+	if destination[0] != "37.3382" || destination[1] != "-121.8863" {
+		t.Errorf("Expected dave's destination to be moved, got %v", destination)
+	}
+}
@@ -0,0 +1,84 @@
+package protocol
+
+import (
+	"errors"
+	"matching-service/websocket-server/internal/apperror"
+	"matching-service/websocket-server/internal/models"
+	"matching-service/websocket-server/internal/protocol"
+	"testing"
+)
+
+func TestV1DecodeIsStrict(t *testing.T) {
+	codec := protocol.V1Codec{}
+
+	request, err := codec.Decode([]byte(`{"v":1,"type":"update_current_location","request_id":"r1","payload":{"position":{"latitude":0,"longitude":-0.12}}}`))
+	if err != nil {
+		t.Fatalf("Expected a zero latitude to be accepted, got %v", err)
+	}
+	payload, ok := request.Payload.(*protocol.PositionPayload)
+	if !ok || payload.Position.Latitude != 0 || payload.Position.Longitude != -0.12 || request.RequestID != "r1" {
+		t.Fatalf("Unexpected request: %+v", request)
+	}
+
+	rejected := map[string]string{
+		"unknown field":    `{"v":1,"type":"update_current_location","request_id":"r2","payload":{"position":{"latitude":1,"longitude":1},"speed":3}}`,
+		"missing field":    `{"v":1,"type":"update_current_location","request_id":"r2","payload":{"position":{"latitude":1}}}`,
+		"null field":       `{"v":1,"type":"update_current_location","request_id":"r2","payload":{"position":{"latitude":1,"longitude":null}}}`,
+		"missing payload":  `{"v":1,"type":"delete","request_id":"r2"}`,
+		"unknown type":     `{"v":1,"type":"teleport","request_id":"r2","payload":{}}`,
+		"unknown version":  `{"v":2,"type":"delete","request_id":"r2","payload":{}}`,
+		"envelope field":   `{"v":1,"type":"delete","request_id":"r2","payload":{},"action":"delete"}`,
+		"wrong field type": `{"v":1,"type":"get_location","request_id":"r2","payload":{"user_id":42}}`,
+	}
+	for name, frame := range rejected {
+		request, err := codec.Decode([]byte(frame))
+		var appErr *apperror.Error
+		if !errors.As(err, &appErr) || appErr.Code != apperror.CodeValidation {
+			t.Errorf("%s: expected a validation error, got %v", name, err)
+		}
+		if request.RequestID != "r2" {
+			t.Errorf("%s: expected request_id r2 to be kept, got %q", name, request.RequestID)
+		}
+	}
+}
+
+func TestV1EncodeKeepsZeroCoordinates(t *testing.T) {
+	data, err := protocol.V1Codec{}.Encode(protocol.Response{
+		Type:      protocol.TypeLocation,
+		RequestID: "r1",
+		Payload:   models.Location{UserId: "u1"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	const want = `{"v":1,"type":"location","request_id":"r1","payload":{"user_id":"u1","current_latitude":0,"current_longitude":0,`
+	if string(data[:len(want)]) != want {
+		t.Errorf("Expected frame to start with %s, got %s", want, data)
+	}
+}
+
+func TestLegacyDecode(t *testing.T) {
+	request, err := protocol.LegacyCodec{}.Decode([]byte(`{"action":"find_matches","request_id":"r1","radius":3}`))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	query, ok := request.Payload.(*models.MatchQuery)
+	if !ok || query.Radius != 3 || query.Unit != "km" {
+		t.Errorf("Expected the radius shorthand in km, got %+v", request.Payload)
+	}
+
+	if _, err := (protocol.LegacyCodec{}).Decode([]byte(`{"action":"teleport"}`)); err == nil {
+		t.Errorf("Expected unknown actions to be rejected")
+	}
+}
+
+func TestCodecFor(t *testing.T) {
+	if _, ok := protocol.CodecFor(protocol.SubprotocolV1).(protocol.V1Codec); !ok {
+		t.Errorf("Expected %s to use the v1 codec", protocol.SubprotocolV1)
+	}
+	for _, subprotocol := range []string{"", "bearer"} {
+		if _, ok := protocol.CodecFor(subprotocol).(protocol.LegacyCodec); !ok {
+			t.Errorf("Expected %q to use the legacy codec", subprotocol)
+		}
+	}
+}
@@ -1,23 +1,22 @@
 package repository
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"matching-service/websocket-server/internal/config"
 	"matching-service/websocket-server/internal/models"
 	"matching-service/websocket-server/internal/repository"
 	"matching-service/websocket-server/pkg/database"
+	"matching-service/websocket-server/tests/conformance"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/joho/godotenv"
 )
 
 func TestCreateLocationIntegration(t *testing.T) {
-	if err := godotenv.Load(".env.test"); err != nil {
-		log.Fatalf("Error loading .env.test file")
-	}
+	conformance.RequireBackends(t)
 
 	// Set up real Cassandra session
 	keyspace := os.Getenv("CASSANDRA_KEYSPACE")
@@ -25,7 +24,7 @@ func TestCreateLocationIntegration(t *testing.T) {
 	database.Init(keyspace)
 	session := database.GetSession()
 	// Create the repo with the real session
-	repo := repository.NewLocationRepo(session, keyspace)
+	repo := repository.NewLocationRepo(session, keyspace, config.DefaultTimeouts)
 
 	userId := uuid.New().String()
 	// Create a sample location
@@ -40,13 +39,13 @@ func TestCreateLocationIntegration(t *testing.T) {
 	}
 
 	// Test the Create method
-	err := repo.Create(location)
+	err := repo.Create(context.Background(), location)
 	if err != nil {
 		t.Fatalf("Failed to create location: %v", err)
 	}
 
 	// Optionally, retrieve and validate the record
-	savedLocation, err := repo.GetByUserID(userId)
+	savedLocation, err := repo.GetByUserID(context.Background(), userId)
 	if err != nil {
 		t.Fatalf("Failed to get location: %v", err)
 	}
@@ -55,3 +54,20 @@ func TestCreateLocationIntegration(t *testing.T) {
 		t.Errorf("Expected user ID %v, got %v", location.UserId, savedLocation.UserId)
 	}
 }
+
+func TestMemoryLocationRepository(t *testing.T) {
+	conformance.RunLocationRepository(t, func(t *testing.T) repository.LocationRepository {
+		return repository.NewMemoryLocationRepo()
+	})
+}
+
+func TestCassandraLocationRepository(t *testing.T) {
+	conformance.RequireBackends(t)
+
+	keyspace := os.Getenv("CASSANDRA_KEYSPACE")
+	database.Init(keyspace)
+	repo := repository.NewLocationRepo(database.GetSession(), keyspace, config.DefaultTimeouts)
+	conformance.RunLocationRepository(t, func(t *testing.T) repository.LocationRepository {
+		return repo
+	})
+}
@@ -0,0 +1,85 @@
+package validation
+
+import (
+	"errors"
+	"matching-service/websocket-server/internal/models"
+	"matching-service/websocket-server/internal/validation"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPosition(t *testing.T) {
+	validator := validation.NewValidator(validation.DefaultLimits)
+
+	tests := []struct {
+		name      string
+		latitude  float64
+		longitude float64
+		want      error
+	}{
+		{"valid", 37.7749, -122.4194, nil},
+		{"equator", 0, 9.5, nil},
+		{"NaN", math.NaN(), 0, validation.ErrNotANumber},
+		{"infinite", 10, math.Inf(1), validation.ErrNotANumber},
+		{"latitude 300", 300, 0, validation.ErrOutOfRange},
+		{"beyond GEO bounds", 86, 0, validation.ErrOutOfRange},
+		{"longitude", 10, -181, validation.ErrOutOfRange},
+		{"null island", 0, 0, validation.ErrNullIsland},
+	}
+	for _, tt := range tests {
+		err := validator.Position("position", tt.latitude, tt.longitude)
+		if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	if err := validator.Destination("destination", 86, 0); err != nil {
+		t.Errorf("Expected destinations beyond the GEO bounds to be accepted, got %v", err)
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	validator := validation.NewValidator(validation.DefaultLimits)
+
+	if at, err := validator.Timestamp("timestamp", nil); err != nil || time.Since(at) > time.Second {
+		t.Errorf("Expected a missing timestamp to default to now, got %v, %v", at, err)
+	}
+	recent := time.Now().Add(-time.Minute)
+	if at, err := validator.Timestamp("timestamp", &recent); err != nil || !at.Equal(recent) {
+		t.Errorf("Expected a recent timestamp to be kept, got %v, %v", at, err)
+	}
+	for reason, rejected := range map[error]time.Time{
+		validation.ErrClockSkew: time.Now().Add(time.Hour),
+		validation.ErrTooOld:    time.Now().Add(-time.Hour),
+	} {
+		var validationErr *validation.Error
+		_, err := validator.Timestamp("timestamp", &rejected)
+		if !errors.Is(err, reason) || !errors.As(err, &validationErr) || validationErr.Field != "timestamp" {
+			t.Errorf("Expected %v to be rejected for %v, got %v", rejected, reason, err)
+		}
+	}
+}
+
+func TestMovement(t *testing.T) {
+	validator := validation.NewValidator(validation.DefaultLimits)
+	start := time.Now()
+	previous := models.Location{CurrentLatitude: 37.7749, CurrentLongitude: -122.4194, UpdatedAt: start}
+
+	// ~13 km to Oakland
+	if err := validator.Movement("position", previous, 37.8044, -122.2712, start.Add(15*time.Minute)); err != nil {
+		t.Errorf("Expected driving to Oakland in 15 minutes to be plausible, got %v", err)
+	}
+	if err := validator.Movement("position", previous, 37.8044, -122.2712, start.Add(10*time.Second)); !errors.Is(err, validation.ErrImplausibleJump) {
+		t.Errorf("Expected reaching Oakland in 10 seconds to be rejected, got %v", err)
+	}
+	if err := validator.Movement("position", previous, 37.7750, -122.4195, start); err != nil {
+		t.Errorf("Expected GPS jitter to be accepted, got %v", err)
+	}
+	if err := validator.Movement("position", previous, 37.7750, -122.4195, start.Add(-time.Minute)); !errors.Is(err, validation.ErrOutOfOrder) {
+		t.Errorf("Expected a point older than the previous one to be rejected, got %v", err)
+	}
+	if err := validator.Movement("position", models.Location{}, 37.8044, -122.2712, start); err != nil {
+		t.Errorf("Expected the first point to be accepted, got %v", err)
+	}
+}